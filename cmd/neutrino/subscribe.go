@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"github.com/gorilla/websocket"
 	log "github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -9,44 +10,101 @@ import (
 )
 
 var (
-	emptyOnChainMsg = neutrinodtypes.OnChainEventResponse{}
 	emptyGeneralMsg = neutrinodtypes.GeneralMessageResponse{}
 	emptyErrorMsg   = neutrinodtypes.MessageErrorResponse{}
 )
 
 var subscribeCmd = cli.Command{
 	Name:   "subscribe",
-	Usage:  "subscribes to neutrinod events related to provided wallet descriptor",
+	Usage:  "subscribes to neutrinod events related to provided wallet descriptors, xpubs or addresses",
 	Action: subscribeAction,
 	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "descriptor",
+			Usage: "wallet descriptor, can be repeated to watch several descriptors",
+		},
+		&cli.StringSliceFlag{
+			Name:  "xpub",
+			Usage: "extended public key whose receive and change branches are watched, can be repeated",
+		},
 		&cli.StringFlag{
-			Name:     "descriptor",
-			Usage:    "wallet descriptor",
-			Required: true,
+			Name:  "script_type",
+			Usage: "script type of the xpub addresses: p2wpkh, p2sh-p2wpkh or p2pkh",
+			Value: "p2wpkh",
+		},
+		&cli.StringSliceFlag{
+			Name:  "address",
+			Usage: "address to watch, confidential or not, can be repeated",
 		},
 		&cli.IntFlag{
-			Name:     "block_height",
-			Usage:    "block height to watch from",
-			Required: true,
+			Name:  "block_height",
+			Usage: "block height to watch from",
+		},
+		&cli.TimestampFlag{
+			Name:   "birthday",
+			Usage:  "wallet birthday, the watch starts from the first block mined at or after 2 hours before it",
+			Layout: "2006-01-02T15:04:05",
+		},
+		&cli.StringFlag{
+			Name:  "block_hash",
+			Usage: "hash of the block to watch from",
+		},
+		&cli.StringSliceFlag{
+			Name:  "blinding_key",
+			Usage: "hex private blinding key used to unblind outputs, can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "master_blinding_key",
+			Usage: "hex SLIP-77 master blinding key used to unblind outputs",
+		},
+		&cli.UintFlag{
+			Name:  "confirmations",
+			Usage: "number of confirmations to notify for every event, it is notified as reverted if its block is disconnected before",
+		},
+		&cli.StringFlag{
+			Name:  "asset",
+			Usage: "hex id of the asset whose utxos are notified as assetUtxo events",
 		},
 		&cli.StringSliceFlag{
 			Name: "events",
 			Usage: "events to watch for:\n" +
 				"	unspentUtxo -> unspent utxo\n" +
-				"	spentUtxo -> spent utxo\n",
+				"	spentUtxo -> spent utxo\n" +
+				"	issuance -> asset issued spending an utxo\n" +
+				"	reissuance -> asset reissued spending an utxo\n" +
+				"	assetUtxo -> unspent utxo of the given asset\n" +
+				"	pegin -> utxo funded by a peg-in claim\n" +
+				"	pegout -> utxo spent to peg-out to the mainchain\n",
 		},
 	},
 }
 
 func subscribeAction(ctx *cli.Context) error {
+	descriptors := ctx.StringSlice("descriptor")
+	addresses := ctx.StringSlice("address")
+	extendedKeys := make([]neutrinodtypes.ExtendedKey, 0)
+	for _, v := range ctx.StringSlice("xpub") {
+		extendedKeys = append(extendedKeys, neutrinodtypes.ExtendedKey{
+			Key:        v,
+			ScriptType: ctx.String("script_type"),
+		})
+	}
+	if len(descriptors) == 0 && len(extendedKeys) == 0 && len(addresses) == 0 {
+		return errors.New("at least one of descriptor, xpub or address is required")
+	}
+
 	conn, cleanup, err := getNeutrinodConnection()
 	if err != nil {
 		return err
 	}
 	defer cleanup()
 
-	descriptor := ctx.String("descriptor")
 	blockHeight := ctx.Int("block_height")
+	blockHash := ctx.String("block_hash")
+	var birthday int64
+	if t := ctx.Timestamp("birthday"); t != nil {
+		birthday = t.Unix()
+	}
 
 	eventsType := ctx.StringSlice("events")
 	events := make([]neutrinodtypes.EventType, 0, len(eventsType))
@@ -55,10 +113,18 @@ func subscribeAction(ctx *cli.Context) error {
 	}
 
 	req := neutrinodtypes.SubscriptionRequestWs{
-		ActionType:       neutrinodtypes.Register,
-		EventTypes:       events,
-		DescriptorWallet: descriptor,
-		StartBlockHeight: blockHeight,
+		ActionType:        neutrinodtypes.Register,
+		EventTypes:        events,
+		DescriptorWallets: descriptors,
+		ExtendedKeys:      extendedKeys,
+		Addresses:         addresses,
+		StartBlockHeight:  blockHeight,
+		BirthdayTime:      birthday,
+		StartBlockHash:    blockHash,
+		BlindingKeys:      ctx.StringSlice("blinding_key"),
+		MasterBlindingKey: ctx.String("master_blinding_key"),
+		ConfirmationDepth: uint32(ctx.Uint("confirmations")),
+		AssetID:           ctx.String("asset"),
 	}
 
 	reqBytes, err := json.Marshal(req)
@@ -94,10 +160,35 @@ func subscribeAction(ctx *cli.Context) error {
 			return err
 		}
 
-		if onChainMsg != emptyOnChainMsg {
-			if onChainMsg.TxID != "" {
+		if onChainMsg.TxID != "" {
+			if onChainMsg.ConflictTxID != "" {
+				log.Warnf("tx_id: %v conflicts with tx_id: %v", onChainMsg.TxID, onChainMsg.ConflictTxID)
+				continue
+			}
+			if onChainMsg.Reverted {
+				log.Infof("tx_id: %v reverted", onChainMsg.TxID)
+				continue
+			}
+			if onChainMsg.Unconfirmed {
+				log.Infof("tx_id: %v unconfirmed", onChainMsg.TxID)
+				continue
+			}
+			if onChainMsg.Confirmations > 1 {
+				log.Infof("tx_id: %v, confirmations: %v", onChainMsg.TxID, onChainMsg.Confirmations)
+				continue
+			}
+
+			if d := onChainMsg.Derivation; d != nil {
+				log.Infof("tx_id: %v, branch: %v, index: %v", onChainMsg.TxID, d.Branch, d.Index)
+			} else {
 				log.Infof("tx_id: %v", onChainMsg.TxID)
 			}
+
+			for _, out := range onChainMsg.Outputs {
+				if out.Asset != "" {
+					log.Infof("vout: %v, value: %v, asset: %v", out.Index, out.Value, out.Asset)
+				}
+			}
 		}
 
 		if generalMsg != emptyGeneralMsg {
@@ -3,29 +3,41 @@ package main
 import (
 	"context"
 	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
 	"github.com/vulpemventures/neutrino-elements/internal/config"
 	dbpg "github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/pg"
 	neutrinodws "github.com/vulpemventures/neutrino-elements/internal/interface/web-socket"
 	"github.com/vulpemventures/neutrino-elements/pkg/blockservice"
 	"github.com/vulpemventures/neutrino-elements/pkg/node"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
 	"os"
 	"os/signal"
 	"syscall"
 )
 
 func main() {
+	app := cli.NewApp()
+	app.Name = "neutrinod"
+	app.Usage = "Neutrino Elements daemon"
+	app.Action = startAction
+	app.Commands = append(
+		app.Commands,
+		&exportSnapshotCmd,
+		&importSnapshotCmd,
+		&verifyCmd,
+	)
+
+	if err := app.Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func startAction(*cli.Context) error {
 	if err := config.LoadConfig(); err != nil {
 		log.Fatal(err)
 	}
 
-	dbManager, err := dbpg.NewDbService(dbpg.DbConfig{
-		DbUser:             config.GetString(config.DbUserKey),
-		DbPassword:         config.GetString(config.DbPassKey),
-		DbHost:             config.GetString(config.DbHostKey),
-		DbPort:             config.GetInt(config.DbPortKey),
-		DbName:             config.GetString(config.DbNameKey),
-		MigrationSourceURL: config.GetString(config.DbMigrationPath),
-	})
+	dbManager, err := newDbService()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -40,11 +52,31 @@ func main() {
 		log.Fatal(err)
 	}
 
+	repoSubscription, err := dbpg.NewSubscriptionRepositoryImpl(dbManager)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repoUtxo, err := dbpg.NewUtxoRepositoryImpl(dbManager)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	repoTxHistory, err := dbpg.NewTxHistoryRepositoryImpl(dbManager)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	nodeCfg := node.NodeConfig{
 		Network:        config.GetString(config.NetworkKey),
 		UserAgent:      "neutrino-elements:test",
 		FiltersDB:      repoFilter,
 		BlockHeadersDB: repoHeader,
+		FilterRetention: node.FilterRetention{
+			LastBlocks:  uint32(config.GetInt(config.FilterRetentionBlocksKey)),
+			SinceHeight: uint32(config.GetInt(config.FilterRetentionHeightKey)),
+		},
+		LazyFilters: config.GetBool(config.LazyFiltersKey),
 	}
 
 	blockSvc := blockservice.NewEsploraBlockService(config.GetString(config.ExplorerUrlKey))
@@ -52,8 +84,12 @@ func main() {
 	elementsNeutrinoServer, err := neutrinodws.NewElementsNeutrinoServer(
 		nodeCfg,
 		blockSvc,
+		repoSubscription,
+		repoUtxo,
+		repoTxHistory,
 		config.GetString(config.PeerUrlKey),
 		config.GetString(config.NeutrinoDUrlKey),
+		scanner.WithRescanWorkers(config.GetInt(config.RescanWorkersKey)),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -68,4 +104,17 @@ func main() {
 	if err := <-errC; err != nil {
 		log.Panicf("neutrinod: neutrino-elements daemon noticed error while running: %s", err)
 	}
+
+	return nil
+}
+
+func newDbService() (*dbpg.DbService, error) {
+	return dbpg.NewDbService(dbpg.DbConfig{
+		DbUser:             config.GetString(config.DbUserKey),
+		DbPassword:         config.GetString(config.DbPassKey),
+		DbHost:             config.GetString(config.DbHostKey),
+		DbPort:             config.GetInt(config.DbPortKey),
+		DbName:             config.GetString(config.DbNameKey),
+		MigrationSourceURL: config.GetString(config.DbMigrationPath),
+	})
 }
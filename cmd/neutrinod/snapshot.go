@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/vulpemventures/neutrino-elements/internal/config"
+	dbpg "github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/pg"
+	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+	"github.com/vulpemventures/neutrino-elements/pkg/snapshot"
+)
+
+var exportSnapshotCmd = cli.Command{
+	Name:   "export-snapshot",
+	Usage:  "exports block headers and filters to a snapshot file",
+	Action: exportSnapshotAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Usage:    "path of the snapshot file to create",
+			Required: true,
+		},
+		&cli.UintFlag{
+			Name:  "height",
+			Usage: "height up to which headers and filters are exported, 0 means chain tip",
+		},
+	},
+}
+
+var importSnapshotCmd = cli.Command{
+	Name:   "import-snapshot",
+	Usage:  "verifies and imports block headers and filters from a snapshot file",
+	Action: importSnapshotAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "file",
+			Usage:    "path of the snapshot file to import",
+			Required: true,
+		},
+	},
+}
+
+func exportSnapshotAction(ctx *cli.Context) error {
+	network, headerDB, filterDB, err := snapshotDeps()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(ctx.String("file"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := snapshot.Export(
+		context.Background(),
+		file,
+		network,
+		headerDB,
+		filterDB,
+		uint32(ctx.Uint("height")),
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"neutrinod: exported snapshot up to height %v with %v filters",
+		info.EndHeight, info.NumFilters,
+	)
+
+	return file.Sync()
+}
+
+func importSnapshotAction(ctx *cli.Context) error {
+	network, headerDB, filterDB, err := snapshotDeps()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(ctx.String("file"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := snapshot.Import(
+		context.Background(),
+		file,
+		network,
+		headerDB,
+		filterDB,
+	)
+	if err != nil {
+		return err
+	}
+
+	log.Infof(
+		"neutrinod: imported snapshot up to height %v with %v filters",
+		info.EndHeight, info.NumFilters,
+	)
+
+	return nil
+}
+
+func snapshotDeps() (
+	protocol.Magic,
+	repository.BlockHeaderRepository,
+	repository.FilterRepository,
+	error,
+) {
+	if err := config.LoadConfig(); err != nil {
+		return protocol.Magic{}, nil, nil, err
+	}
+
+	network, ok := protocol.Networks[config.GetString(config.NetworkKey)]
+	if !ok {
+		return protocol.Magic{}, nil, nil, fmt.Errorf(
+			"unsupported network %s", config.GetString(config.NetworkKey),
+		)
+	}
+
+	dbManager, err := newDbService()
+	if err != nil {
+		return protocol.Magic{}, nil, nil, err
+	}
+
+	headerDB, err := dbpg.NewHeaderRepositoryImpl(dbManager)
+	if err != nil {
+		return protocol.Magic{}, nil, nil, err
+	}
+
+	filterDB, err := dbpg.NewFilterRepositoryImpl(dbManager)
+	if err != nil {
+		return protocol.Magic{}, nil, nil, err
+	}
+
+	return network, headerDB, filterDB, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	log "github.com/sirupsen/logrus"
+	"github.com/urfave/cli/v2"
+	"github.com/vulpemventures/neutrino-elements/internal/config"
+	"github.com/vulpemventures/neutrino-elements/pkg/consistency"
+	"github.com/vulpemventures/neutrino-elements/pkg/node"
+	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
+)
+
+const verifyPollInterval = 2 * time.Second
+
+var verifyCmd = cli.Command{
+	Name:   "verify",
+	Usage:  "checks the consistency of stored block headers and filters",
+	Action: verifyAction,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "repair",
+			Usage: "delete broken headers and orphan filters, download missing filters from the peer",
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "max time to wait for missing filters to be downloaded",
+			Value: time.Minute,
+		},
+	},
+}
+
+func verifyAction(ctx *cli.Context) error {
+	network, headerDB, filterDB, err := snapshotDeps()
+	if err != nil {
+		return err
+	}
+
+	genesisHash, err := chainhash.NewHashFromStr(protocol.GetCheckpoints(network)[0])
+	if err != nil {
+		return err
+	}
+
+	report, err := consistency.Verify(context.Background(), headerDB, filterDB, genesisHash)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range report.Problems {
+		log.Warnf("neutrinod: %v", p)
+	}
+
+	if report.IsConsistent() {
+		log.Infof("neutrinod: headers and filters are consistent up to height %v", report.TipHeight)
+		return nil
+	}
+
+	log.Infof("neutrinod: found %v problems up to height %v", len(report.Problems), report.TipHeight)
+
+	if !ctx.Bool("repair") {
+		return nil
+	}
+
+	if err := consistency.Repair(context.Background(), headerDB, filterDB, report, nil); err != nil {
+		return err
+	}
+
+	// the node syncs again the deleted headers with their filters, the
+	// filters still missing are explicitly requested
+	nodeSvc, err := node.New(node.NodeConfig{
+		Network:        config.GetString(config.NetworkKey),
+		UserAgent:      "neutrino-elements:verify",
+		FiltersDB:      filterDB,
+		BlockHeadersDB: headerDB,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := nodeSvc.Start(config.GetString(config.PeerUrlKey)); err != nil {
+		return err
+	}
+	defer nodeSvc.Stop()
+
+	report, err = consistency.Verify(context.Background(), headerDB, filterDB, genesisHash)
+	if err != nil {
+		return err
+	}
+
+	if err := consistency.Repair(context.Background(), headerDB, filterDB, report, nodeSvc); err != nil {
+		return err
+	}
+
+	timeout := time.After(ctx.Duration("timeout"))
+	ticker := time.NewTicker(verifyPollInterval)
+	defer ticker.Stop()
+
+	for !report.IsConsistent() {
+		select {
+		case <-timeout:
+			for _, p := range report.Problems {
+				log.Warnf("neutrinod: %v", p)
+			}
+			log.Warnf("neutrinod: %v problems left after repair", len(report.Problems))
+			return nil
+		case <-ticker.C:
+			report, err = consistency.Verify(context.Background(), headerDB, filterDB, genesisHash)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Infof("neutrinod: repaired headers and filters up to height %v", report.TipHeight)
+
+	return nil
+}
@@ -31,6 +31,14 @@ const (
 	DbNameKey = "DB_NAME"
 	// DbMigrationPath is the path to migration files
 	DbMigrationPath = "DB_MIGRATION_PATH"
+	// FilterRetentionBlocksKey keeps only the filters of the last N blocks, 0 keeps all of them
+	FilterRetentionBlocksKey = "FILTER_RETENTION_BLOCKS"
+	// FilterRetentionHeightKey keeps only the filters from the given height, 0 keeps all of them
+	FilterRetentionHeightKey = "FILTER_RETENTION_HEIGHT"
+	// LazyFiltersKey makes the node sync headers only, filters are fetched when scanned
+	LazyFiltersKey = "LAZY_FILTERS"
+	// RescanWorkersKey is the number of workers matching in parallel the filters of historical rescans
+	RescanWorkersKey = "RESCAN_WORKERS"
 )
 
 var (
@@ -53,6 +61,10 @@ func LoadConfig() error {
 	vip.SetDefault(DbPortKey, 5432)
 	vip.SetDefault(DbNameKey, "neutrino-elements")
 	vip.SetDefault(DbMigrationPath, "file://internal/infrastructure/storage/db/pg/migration")
+	vip.SetDefault(FilterRetentionBlocksKey, 0)
+	vip.SetDefault(FilterRetentionHeightKey, 0)
+	vip.SetDefault(LazyFiltersKey, false)
+	vip.SetDefault(RescanWorkersKey, 4)
 
 	networkName := GetString(NetworkKey)
 	if networkName != network.Liquid.Name &&
@@ -0,0 +1,188 @@
+package application
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+const (
+	// DefaultTxHistoryLimit and MaxTxHistoryLimit bound the number of entries
+	// of a history page
+	DefaultTxHistoryLimit = 25
+	MaxTxHistoryLimit     = 100
+)
+
+var (
+	ErrInvalidCursor      = errors.New("invalid history cursor")
+	ErrInvalidHeightRange = errors.New("invalid history height range")
+)
+
+// TxHistoryQuery selects a page of the transaction history of a subscriber,
+// Cursor is the NextCursor of the previous page, empty for the first one
+type TxHistoryQuery struct {
+	Cursor     string
+	Limit      int
+	FromHeight uint32
+	ToHeight   uint32
+}
+
+// TxHistoryPage holds the entries of the history from the most recent one,
+// NextCursor is empty if there are no more entries
+type TxHistoryPage struct {
+	Txs        []*domain.TxHistoryEntry
+	NextCursor string
+}
+
+func (n *notificationService) TxHistory(id SubscriberID, query TxHistoryQuery) (*TxHistoryPage, error) {
+	if _, ok := n.getSubscriberSafe(id); !ok {
+		return nil, ErrSubscriberNotFound
+	}
+
+	if query.ToHeight > 0 && query.ToHeight < query.FromHeight {
+		return nil, ErrInvalidHeightRange
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = DefaultTxHistoryLimit
+	}
+	if limit > MaxTxHistoryLimit {
+		limit = MaxTxHistoryLimit
+	}
+
+	filter := domain.TxHistoryFilter{
+		FromHeight: query.FromHeight,
+		ToHeight:   query.ToHeight,
+		// one more entry says if there is a next page
+		Limit: limit + 1,
+	}
+	if query.Cursor != "" {
+		cursor, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = cursor
+	}
+
+	txs, err := n.txHistoryRepo.GetTxHistory(context.Background(), uuid.UUID(id), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TxHistoryPage{Txs: txs}
+	if len(txs) > limit {
+		page.Txs = txs[:limit]
+		last := page.Txs[limit-1]
+		page.NextCursor = encodeCursor(domain.TxHistoryCursor{
+			BlockHeight: last.BlockHeight,
+			TxIndex:     last.TxIndex,
+		})
+	}
+
+	return page, nil
+}
+
+// updateTxHistory stores the history entry of the confirmed transaction of
+// the report, with the amounts of the UTXO set it has been applied to (see
+// updateUtxos). The entry is updated by every report of the transaction, it
+// is outgoing as soon as one of them spends a watched outpoint, whatever the
+// subscribed events (see Subscriber.scanEvents)
+func (n *notificationService) updateTxHistory(report scanner.Report) {
+	if report.Unconfirmed || report.ConflictTxHash != nil || report.Confirmations > 1 {
+		return
+	}
+
+	ctx := context.Background()
+	subscriberID := report.Request.ClientID
+	txID := report.Transaction.TxHash().String()
+
+	if report.Reverted {
+		if err := n.txHistoryRepo.DeleteTx(ctx, subscriberID, txID); err != nil {
+			log.Errorf("failed to revert tx history of subscriber %v: %v", subscriberID, err)
+		}
+		return
+	}
+
+	// the transaction doesn't touch the subscription scripts, eg. a
+	// TxConfirmation
+	if len(report.Inputs) == 0 && len(report.Outputs) == 0 {
+		return
+	}
+
+	direction := domain.Incoming
+	if len(report.Inputs) > 0 {
+		direction = domain.Outgoing
+	} else {
+		// the outputs may be reported after the spending of the transaction
+		prev, err := n.getTxHistoryEntry(ctx, subscriberID, txID, report.BlockHeight, report.TxIndex)
+		if err != nil {
+			log.Errorf("failed to get tx history of subscriber %v: %v", subscriberID, err)
+			return
+		}
+		if prev != nil {
+			direction = prev.Direction
+		}
+	}
+
+	utxos, err := n.utxoRepo.GetTxUtxos(ctx, subscriberID, txID)
+	if err != nil {
+		log.Errorf("failed to get tx utxos of subscriber %v: %v", subscriberID, err)
+		return
+	}
+
+	entry := domain.NewTxHistoryEntry(subscriberID, txID, report.BlockHeight, report.TxIndex, direction, utxos)
+	if err := n.txHistoryRepo.PutTx(ctx, entry); err != nil {
+		log.Errorf("failed to store tx history of subscriber %v: %v", subscriberID, err)
+	}
+}
+
+// getTxHistoryEntry returns the stored entry of the transaction at the given
+// position, nil if there is none
+func (n *notificationService) getTxHistoryEntry(
+	ctx context.Context,
+	subscriberID uuid.UUID,
+	txID string,
+	blockHeight, txIndex uint32,
+) (*domain.TxHistoryEntry, error) {
+	txs, err := n.txHistoryRepo.GetTxHistory(ctx, subscriberID, domain.TxHistoryFilter{
+		FromHeight: blockHeight,
+		ToHeight:   blockHeight,
+		After:      &domain.TxHistoryCursor{BlockHeight: blockHeight, TxIndex: txIndex + 1},
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(txs) == 0 || txs[0].TxID != txID {
+		return nil, nil
+	}
+	return txs[0], nil
+}
+
+func encodeCursor(cursor domain.TxHistoryCursor) string {
+	return base64.RawURLEncoding.EncodeToString(
+		[]byte(fmt.Sprintf("%d:%d", cursor.BlockHeight, cursor.TxIndex)),
+	)
+}
+
+func decodeCursor(cursor string) (*domain.TxHistoryCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &domain.TxHistoryCursor{}
+	if _, err := fmt.Sscanf(string(b), "%d:%d", &c.BlockHeight, &c.TxIndex); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,114 @@
+package application
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+func TestUpdateTxHistory(t *testing.T) {
+	clientID := uuid.New()
+	funding := newTestTx(nil, []uint64{1000}, [][]byte{testScript})
+	fundingHash := []chainhash.Hash{funding.TxHash()}
+
+	tests := []struct {
+		name      string
+		tx        func() ([]scanner.Report, string)
+		direction domain.TxDirection
+		net       int64
+	}{
+		{
+			name: "incoming",
+			tx: func() ([]scanner.Report, string) {
+				return []scanner.Report{fundingReport(clientID, funding, 10)}, funding.TxHash().String()
+			},
+			direction: domain.Incoming,
+			net:       1000,
+		},
+		{
+			name: "outgoing with change",
+			tx: func() ([]scanner.Report, string) {
+				tx := newTestTx(fundingHash, []uint64{600, 390}, [][]byte{nil, testScript})
+				// the change may be reported before the spending
+				return []scanner.Report{
+					fundingReport(clientID, tx, 11),
+					spendingReport(clientID, tx, 11),
+				}, tx.TxHash().String()
+			},
+			direction: domain.Outgoing,
+			net:       -610,
+		},
+		{
+			name: "self-transfer",
+			tx: func() ([]scanner.Report, string) {
+				tx := newTestTx(fundingHash, []uint64{990}, [][]byte{testScript})
+				return []scanner.Report{
+					spendingReport(clientID, tx, 11),
+					fundingReport(clientID, tx, 11),
+				}, tx.TxHash().String()
+			},
+			direction: domain.Outgoing,
+			net:       -10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := newTestService()
+			n.updateUtxos(fundingReport(clientID, funding, 10))
+
+			reports, txID := tt.tx()
+			for _, report := range reports {
+				n.updateUtxos(report)
+				n.updateTxHistory(report)
+			}
+
+			txs, err := n.txHistoryRepo.GetTxHistory(context.Background(), clientID, domain.TxHistoryFilter{Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, txs, 1)
+			require.Equal(t, txID, txs[0].TxID)
+			require.Equal(t, tt.direction, txs[0].Direction)
+			require.Equal(t, tt.net, txs[0].NetAmounts()[testAsset])
+		})
+	}
+}
+
+func TestUpdateTxHistorySpentUtxoSubscriber(t *testing.T) {
+	n := newTestService()
+	sub := Subscriber{ID: SubscriberID(uuid.New()), Events: []scanner.EventType{scanner.SpentUtxo}}
+	n.addSubscriberSafe(sub)
+	clientID := uuid.UUID(sub.ID)
+
+	reports := make(chan scanner.Report)
+	go n.handleOnChainEvents(reports)
+	defer func() { n.quitHandleOnChainEvents <- struct{}{} }()
+
+	// the spent utxo is not in the UTXO set (eg. funded before the start
+	// height), the change is reported after the spending
+	tx := newTestTx([]chainhash.Hash{{0x01}}, []uint64{600, 390}, [][]byte{nil, testScript})
+	go func() {
+		reports <- spendingReport(clientID, tx, 11)
+		reports <- fundingReport(clientID, tx, 11)
+	}()
+
+	select {
+	case event := <-n.subsEventReport:
+		require.Equal(t, scanner.SpentUtxo, event.EventType)
+	case <-time.After(3 * time.Second):
+		t.Fatal("event not notified")
+	}
+
+	require.Eventually(t, func() bool {
+		txs, err := n.txHistoryRepo.GetTxHistory(context.Background(), clientID, domain.TxHistoryFilter{Limit: 10})
+		if err != nil || len(txs) != 1 {
+			return false
+		}
+		return txs[0].Direction == domain.Outgoing && txs[0].Received[testAsset] == 390
+	}, 3*time.Second, 10*time.Millisecond)
+}
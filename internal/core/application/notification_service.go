@@ -1,11 +1,26 @@
 package application
 
 import (
+	"context"
 	"errors"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/google/uuid"
 	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
 	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
 	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSubscriberNotFound = errors.New("subscriber not found")
+)
+
+const (
+	// checkpointInterval is the frequency at which the scan progress of the
+	// persisted subscribers is stored
+	checkpointInterval = 30 * time.Second
 )
 
 type NotificationService interface {
@@ -13,15 +28,35 @@ type NotificationService interface {
 	Stop()
 	Subscribe(subscriber Subscriber) error
 	UnSubscribe(subscriber Subscriber) error
+	// Subscribers returns the currently registered subscribers, including
+	// the ones restored from the repository at startup
+	Subscribers() []Subscriber
 	EventReport() chan SubscriberEventReport
 	ErrorReport() chan SubscriberErrorReport
+	// Unspents returns the UTXO set of the subscriber, built from the
+	// confirmed events reported to it
+	Unspents(id SubscriberID) ([]*domain.Utxo, error)
+	// Balance returns the balance per asset of the subscriber unspents, the
+	// confidential ones that can't be unblinded are not counted
+	Balance(id SubscriberID) (map[string]uint64, error)
+	// TxHistory returns a page of the confirmed transactions touching the
+	// subscriber scripts, from the most recent one
+	TxHistory(id SubscriberID, query TxHistoryQuery) (*TxHistoryPage, error)
 }
 
 type notificationService struct {
 	// subscribers is a map of subscriber IDs and Subscribers with wallet descriptors
 	subscribers map[SubscriberID]Subscriber
+	// subscribersLock is a mutex for subscribers map
+	subscribersLock *sync.RWMutex
 	// scannerSvc is the scanner service used to watch on-chain events
 	scannerSvc scanner.Service
+	// subscriptionRepo persists webhook subscribers and their scan progress
+	subscriptionRepo domain.SubscriptionRepository
+	// utxoRepo stores the UTXO set of the subscribers
+	utxoRepo domain.UtxoRepository
+	// txHistoryRepo stores the transaction history of the subscribers
+	txHistoryRepo domain.TxHistoryRepository
 
 	// registerSubs is a channel used to register subscribers
 	registerSubs chan Subscriber
@@ -37,20 +72,31 @@ type notificationService struct {
 	quitHandleOnChainEvents chan struct{}
 	// quitHandleOnChainEvents is a channel used to stop handleOnChainEvents
 	quitHandleSubscribers chan struct{}
+	// quitCheckpointScanProgress is a channel used to stop checkpointScanProgress
+	quitCheckpointScanProgress chan struct{}
 }
 
 func NewNotificationService(
 	scannerSvc scanner.Service,
+	subscriptionRepo domain.SubscriptionRepository,
+	utxoRepo domain.UtxoRepository,
+	txHistoryRepo domain.TxHistoryRepository,
 ) NotificationService {
 	return &notificationService{
 		subscribers:             make(map[SubscriberID]Subscriber),
+		subscribersLock:         new(sync.RWMutex),
 		scannerSvc:              scannerSvc,
+		subscriptionRepo:        subscriptionRepo,
+		utxoRepo:                utxoRepo,
+		txHistoryRepo:           txHistoryRepo,
 		registerSubs:            make(chan Subscriber),
 		unregisterSubs:          make(chan Subscriber),
 		subsEventReport:         make(chan SubscriberEventReport),
 		subsErrorReport:         make(chan SubscriberErrorReport),
 		quitHandleOnChainEvents: make(chan struct{}),
 		quitHandleSubscribers:   make(chan struct{}),
+
+		quitCheckpointScanProgress: make(chan struct{}),
 	}
 }
 
@@ -62,7 +108,12 @@ func (n *notificationService) Start() error {
 		return err
 	}
 
+	if err := n.restoreSubscribers(); err != nil {
+		return err
+	}
+
 	go n.handleOnChainEvents(scannerReport)
+	go n.checkpointScanProgress()
 
 	log.Debug("notification-service started")
 	return nil
@@ -80,9 +131,178 @@ func (n *notificationService) Stop() {
 	log.Debug("sss")
 	n.quitHandleOnChainEvents <- struct{}{}
 	n.quitHandleSubscribers <- struct{}{}
+	n.quitCheckpointScanProgress <- struct{}{}
 	log.Debug("sssdsds")
 }
 
+func (n *notificationService) Subscribers() []Subscriber {
+	n.subscribersLock.RLock()
+	defer n.subscribersLock.RUnlock()
+
+	subscribers := make([]Subscriber, 0, len(n.subscribers))
+	for _, v := range n.subscribers {
+		subscribers = append(subscribers, v)
+	}
+
+	return subscribers
+}
+
+// restoreSubscribers resumes watching, from their last scanned height, the
+// wallet descriptors of the subscribers persisted before a restart
+func (n *notificationService) restoreSubscribers() error {
+	subscriptions, err := n.subscriptionRepo.GetAllSubscriptions(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, v := range subscriptions {
+		sub := subscriberFromDomain(v)
+
+		// the unspents funded before the resume height are not scanned again,
+		// their spending is tracked from the stored UTXO set
+		state, err := n.walletState(v.ID)
+		if err != nil {
+			log.Errorf("failed to restore subscriber %v: %v", v.ID, err)
+			continue
+		}
+		state.LastUsedIndexes = v.LastUsedIndexes
+
+		if err := n.scannerSvc.WatchDescriptorWallets(
+			uuid.UUID(sub.ID),
+			sub.WalletDescriptors,
+			sub.scanEvents(),
+			sub.BlockHeight,
+			append(sub.scanOptions(), scanner.WithWalletState(*state))...,
+		); err != nil {
+			log.Errorf("failed to restore subscriber %v: %v", v.ID, err)
+			continue
+		}
+
+		n.addSubscriberSafe(sub)
+		log.Debugf("subscriber %v restored from height %v", v.ID, sub.BlockHeight)
+	}
+
+	return nil
+}
+
+// walletState returns the state of the descriptors of the subscriber saved
+// before a restart
+func (n *notificationService) walletState(id uuid.UUID) (*scanner.WalletState, error) {
+	unspents, err := n.utxoRepo.GetUnspents(context.Background(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &scanner.WalletState{
+		Unspents: make([]scanner.WalletOutpoint, 0, len(unspents)),
+	}
+	for _, v := range unspents {
+		hash, err := chainhash.NewHashFromStr(v.TxID)
+		if err != nil {
+			return nil, err
+		}
+
+		state.Unspents = append(state.Unspents, scanner.WalletOutpoint{
+			Hash:        *hash,
+			Index:       v.VOut,
+			Script:      v.Script,
+			BlockHeight: v.BlockHeight,
+		})
+	}
+
+	return state, nil
+}
+
+// checkpointScanProgress periodically stores the scan progress of the
+// persisted subscribers so that they can be resumed after a restart
+func (n *notificationService) checkpointScanProgress() {
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			n.storeScanProgress()
+		case <-n.quitCheckpointScanProgress:
+			n.storeScanProgress()
+			log.Debug("notificationService -> checkpointScanProgress stopped")
+			return
+		}
+	}
+}
+
+func (n *notificationService) storeScanProgress() {
+	for _, sub := range n.Subscribers() {
+		if !sub.isPersistent() {
+			continue
+		}
+
+		height, ok := n.scannerSvc.ScannedHeight(uuid.UUID(sub.ID))
+		if !ok {
+			continue
+		}
+
+		if err := n.subscriptionRepo.UpdateLastScannedHeight(
+			context.Background(),
+			uuid.UUID(sub.ID),
+			height,
+		); err != nil {
+			log.Errorf("failed to store scan progress of subscriber %v: %v", uuid.UUID(sub.ID), err)
+		}
+	}
+}
+
+// updateLastUsedIndex stores the index of the range descriptor script funded
+// by the confirmed transaction of the report, the range of a persisted
+// subscriber is derived from it after a restart
+func (n *notificationService) updateLastUsedIndex(report scanner.Report) {
+	if report.Derivation == nil || report.Unconfirmed || report.Reverted ||
+		report.ConflictTxHash != nil || report.Confirmations > 1 {
+		return
+	}
+
+	switch report.EventType() {
+	case scanner.UnspentUtxo, scanner.AssetUtxo, scanner.Pegin:
+	default:
+		return
+	}
+
+	sub, ok := n.getSubscriberSafe(SubscriberID(report.Request.ClientID))
+	if !ok || !sub.isPersistent() {
+		return
+	}
+
+	if err := n.subscriptionRepo.UpdateLastUsedIndex(
+		context.Background(),
+		report.Request.ClientID,
+		*report.Derivation,
+	); err != nil {
+		log.Errorf("failed to store last used index of subscriber %v: %v", report.Request.ClientID, err)
+	}
+}
+
+func (n *notificationService) getSubscriberSafe(id SubscriberID) (Subscriber, bool) {
+	n.subscribersLock.RLock()
+	defer n.subscribersLock.RUnlock()
+
+	sub, ok := n.subscribers[id]
+	return sub, ok
+}
+
+func (n *notificationService) addSubscriberSafe(sub Subscriber) {
+	n.subscribersLock.Lock()
+	defer n.subscribersLock.Unlock()
+
+	n.subscribers[sub.ID] = sub
+}
+
+func (n *notificationService) deleteSubscriberSafe(id SubscriberID) {
+	n.subscribersLock.Lock()
+	defer n.subscribersLock.Unlock()
+
+	delete(n.subscribers, id)
+}
+
 func (n *notificationService) handleOnChainEvents(scannerReport <-chan scanner.Report) {
 	defer func() {
 		if err := recover(); err != nil {
@@ -93,12 +313,47 @@ func (n *notificationService) handleOnChainEvents(scannerReport <-chan scanner.R
 	for {
 		select {
 		case report := <-scannerReport:
+			// subscriptions are not bounded, nothing to notify
+			if report.Completed {
+				continue
+			}
+
+			if report.Err != nil {
+				n.subsErrorReport <- SubscriberErrorReport{
+					SubscriberID: SubscriberID(report.Request.ClientID),
+					ErrorMsg:     report.Err,
+				}
+				continue
+			}
+
+			n.updateUtxos(report)
+			n.updateTxHistory(report)
+			n.updateLastUsedIndex(report)
+
+			// the reports tracking the UTXO set only are not notified
+			sub, ok := n.getSubscriberSafe(SubscriberID(report.Request.ClientID))
+			if ok && !sub.notifies(report.EventType()) {
+				continue
+			}
+
 			n.subsEventReport <- SubscriberEventReport{
-				SubscriberID: SubscriberID(report.Request.ClientID),
-				EventType:    report.Request.Item.EventType(),
-				BlockHeight:  int(report.BlockHeight),
-				BlockHash:    report.BlockHash,
-				Transaction:  report.Transaction,
+				SubscriberID:    SubscriberID(report.Request.ClientID),
+				EventType:       report.EventType(),
+				BlockHeight:     int(report.BlockHeight),
+				BlockHash:       report.BlockHash,
+				Transaction:     report.Transaction,
+				TxIndex:         report.TxIndex,
+				Operation:       report.Operation,
+				Outputs:         report.Outputs,
+				Inputs:          report.Inputs,
+				Pegins:          report.Pegins,
+				Pegouts:         report.Pegouts,
+				Confirmations:   report.Confirmations,
+				Reverted:        report.Reverted,
+				Unconfirmed:     report.Unconfirmed,
+				SeenUnconfirmed: report.SeenUnconfirmed,
+				ConflictTxHash:  report.ConflictTxHash,
+				Derivation:      report.Derivation,
 			}
 		case <-n.quitHandleOnChainEvents:
 			log.Debug("notificationService -> handleOnChainEvents stopped")
@@ -118,23 +373,61 @@ func (n *notificationService) handleSubscribers() {
 	for {
 		select {
 		case sub := <-n.registerSubs:
-			n.subscribers[sub.ID] = sub
+			if opts := sub.startOptions(); len(opts) > 0 {
+				height, err := n.scannerSvc.ResolveStartHeight(opts...)
+				if err != nil {
+					n.subsErrorReport <- SubscriberErrorReport{
+						SubscriberID: sub.ID,
+						ErrorMsg:     err,
+					}
+
+					continue
+				}
+				sub.BlockHeight = int(height)
+			}
 
-			if err := n.scannerSvc.WatchDescriptorWallet(
+			if err := n.scannerSvc.WatchDescriptorWallets(
 				uuid.UUID(sub.ID),
-				sub.WalletDescriptor,
-				sub.Events,
+				sub.WalletDescriptors,
+				sub.scanEvents(),
 				sub.BlockHeight,
+				sub.scanOptions()...,
 			); err != nil {
 				n.subsErrorReport <- SubscriberErrorReport{
 					SubscriberID: sub.ID,
 					ErrorMsg:     err,
 				}
 
-				return
+				continue
+			}
+			n.addSubscriberSafe(sub)
+
+			if sub.isPersistent() {
+				if err := n.subscriptionRepo.PutSubscription(
+					context.Background(),
+					sub.toDomain(),
+				); err != nil {
+					log.Errorf("failed to persist subscriber %v: %v", uuid.UUID(sub.ID), err)
+				}
 			}
 		case sub := <-n.unregisterSubs:
-			delete(n.subscribers, sub.ID)
+			// stop scanning for the subscriber, persistent requests included
+			n.scannerSvc.Unwatch(uuid.UUID(sub.ID))
+			n.deleteSubscriberSafe(sub.ID)
+
+			if err := n.subscriptionRepo.DeleteSubscription(
+				context.Background(),
+				uuid.UUID(sub.ID),
+			); err != nil && err != domain.ErrSubscriptionNotFound {
+				log.Errorf("failed to delete subscriber %v: %v", uuid.UUID(sub.ID), err)
+			}
+
+			if err := n.utxoRepo.DeleteUtxos(context.Background(), uuid.UUID(sub.ID)); err != nil {
+				log.Errorf("failed to delete utxos of subscriber %v: %v", uuid.UUID(sub.ID), err)
+			}
+			if err := n.txHistoryRepo.DeleteTxHistory(context.Background(), uuid.UUID(sub.ID)); err != nil {
+				log.Errorf("failed to delete tx history of subscriber %v: %v", uuid.UUID(sub.ID), err)
+			}
 		case <-n.quitHandleSubscribers:
 			log.Debug("notificationService -> handleSubscribers stopped")
 			return
@@ -142,6 +435,8 @@ func (n *notificationService) handleSubscribers() {
 	}
 }
 
+// Subscribe hands the subscriber to handleSubscribers before returning, so
+// that a following UnSubscribe is always handled after its registration
 func (n *notificationService) Subscribe(
 	subscriber Subscriber,
 ) error {
@@ -149,22 +444,15 @@ func (n *notificationService) Subscribe(
 		return err
 	}
 
-	go func() {
-		n.registerSubs <- subscriber
-	}()
+	n.registerSubs <- subscriber
 
 	return nil
 }
 
+// UnSubscribe stops watching the chain for the subscriber, it is a no-op if
+// the subscriber is unknown or already unregistered
 func (n *notificationService) UnSubscribe(subscriber Subscriber) error {
-	_, ok := n.subscribers[subscriber.ID]
-	if !ok {
-		return errors.New("subscriber not found")
-	}
-
-	go func() {
-		n.unregisterSubs <- subscriber
-	}()
+	n.unregisterSubs <- subscriber
 
 	return nil
 }
@@ -0,0 +1,80 @@
+package application
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+// fakeScanner records the clients watched and unwatched
+type fakeScanner struct {
+	scanner.Service
+	lock      sync.Mutex
+	watched   []uuid.UUID
+	unwatched []uuid.UUID
+}
+
+func (f *fakeScanner) WatchDescriptorWallets(
+	requestID uuid.UUID, _ []string, _ []scanner.EventType, _ int, _ ...scanner.ScanRequestOption,
+) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.watched = append(f.watched, requestID)
+	return nil
+}
+
+func (f *fakeScanner) Unwatch(requestID uuid.UUID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.unwatched = append(f.unwatched, requestID)
+}
+
+func (f *fakeScanner) calls() ([]uuid.UUID, []uuid.UUID) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return append([]uuid.UUID{}, f.watched...), append([]uuid.UUID{}, f.unwatched...)
+}
+
+func TestSubscribeThenDisconnect(t *testing.T) {
+	fake := &fakeScanner{}
+	n := newTestService()
+	n.scannerSvc = fake
+	n.registerSubs = make(chan Subscriber)
+	n.unregisterSubs = make(chan Subscriber)
+	n.quitHandleSubscribers = make(chan struct{})
+
+	go n.handleSubscribers()
+	defer func() { n.quitHandleSubscribers <- struct{}{} }()
+
+	sub := Subscriber{
+		ID:                SubscriberID(uuid.New()),
+		BlockHeight:       1,
+		Events:            []scanner.EventType{scanner.UnspentUtxo},
+		WalletDescriptors: []string{"wpkh(037470e26cc774eca62ca19e1a182461a5f3d3680acbc593ce3f38cd142c26c03d)"},
+	}
+	id := uuid.UUID(sub.ID)
+
+	// the connection is closed right after the registration, the explicit
+	// unregistration is followed by the one of the disconnection
+	require.NoError(t, n.Subscribe(sub))
+	require.NoError(t, n.UnSubscribe(Subscriber{ID: sub.ID}))
+	require.NoError(t, n.UnSubscribe(Subscriber{ID: sub.ID}))
+
+	require.Eventually(t, func() bool {
+		_, unwatched := fake.calls()
+		return len(unwatched) == 2
+	}, 3*time.Second, 10*time.Millisecond)
+
+	watched, unwatched := fake.calls()
+	require.Equal(t, []uuid.UUID{id}, watched)
+	require.Equal(t, []uuid.UUID{id, id}, unwatched)
+	_, ok := n.getSubscriberSafe(sub.ID)
+	require.False(t, ok)
+}
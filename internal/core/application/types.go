@@ -1,21 +1,46 @@
 package application
 
 import (
+	"encoding/hex"
+	"errors"
+	"time"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/google/uuid"
 	"github.com/vulpemventures/go-elements/transaction"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
 	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
+var ErrInvalidAssetID = errors.New("invalid asset id")
+
 type SubscriberID uuid.UUID
 
 type Subscriber struct {
-	ID               SubscriberID
-	BlockHeight      int
-	Events           []scanner.EventType
-	WalletDescriptor string
+	ID                SubscriberID
+	BlockHeight       int
+	Events            []scanner.EventType
+	WalletDescriptors []string
+	// BirthdayTime or StartBlockHash, if set, are resolved to the block height
+	// to watch from at registration
+	BirthdayTime   time.Time
+	StartBlockHash string
+	// BlindingKeys and MasterBlindingKey (SLIP-77), hex encoded, are used to
+	// unblind the outputs of the subscription, ct() descriptors carry their own
+	BlindingKeys      []string
+	MasterBlindingKey string
+	// ConfirmationDepth if greater than 1, the events are notified again for
+	// every new confirmation of their block up to the depth, or as reverted
+	// if the block is disconnected
+	ConfirmationDepth uint32
+	// AssetID (hex) is the asset whose outputs are notified as AssetUtxo
+	// events, required by those
+	AssetID string
+	// EndpointUrl is set for webhook subscribers only, those are persisted
+	// and resumed after a restart
+	EndpointUrl string
 }
 
 func (s *Subscriber) validate() error {
@@ -24,19 +49,191 @@ func (s *Subscriber) validate() error {
 		validation.Field(&s.ID, validation.Required),
 		validation.Field(&s.BlockHeight, validation.Min(1)),
 		validation.Field(&s.Events, validation.Required),
-		validation.Field(&s.WalletDescriptor, validation.Required),
+		validation.Field(&s.WalletDescriptors, validation.Required, validation.Each(validation.Required)),
+		validation.Field(&s.StartBlockHash, validation.By(validateBlockHash)),
+		validation.Field(&s.BlindingKeys, validation.Each(validation.By(validateBlindingKey))),
+		validation.Field(&s.MasterBlindingKey, validation.By(validateBlindingKey)),
+		validation.Field(
+			&s.AssetID,
+			validation.When(s.watches(scanner.AssetUtxo), validation.Required),
+			validation.By(validateAssetID),
+		),
 	)
 }
 
+func validateAssetID(value interface{}) error {
+	asset, _ := value.(string)
+	if asset == "" {
+		return nil
+	}
+
+	if buf, err := hex.DecodeString(asset); err != nil || len(buf) != 32 {
+		return ErrInvalidAssetID
+	}
+	return nil
+}
+
+func validateBlindingKey(value interface{}) error {
+	key, _ := value.(string)
+	if key == "" {
+		return nil
+	}
+
+	_, err := scanner.ParseBlindingKey(key)
+	return err
+}
+
+// scanOptions returns the options applied to all the scan requests of the
+// subscriber
+func (s *Subscriber) scanOptions() []scanner.ScanRequestOption {
+	opts := make([]scanner.ScanRequestOption, 0)
+	if s.ConfirmationDepth > 0 {
+		opts = append(opts, scanner.WithConfirmationDepth(s.ConfirmationDepth))
+	}
+	if s.AssetID != "" {
+		opts = append(opts, scanner.WithAssetTracking(s.AssetID))
+	}
+
+	if len(s.BlindingKeys) == 0 && s.MasterBlindingKey == "" {
+		return opts
+	}
+
+	keys := scanner.BlindingKeys{}
+	for _, v := range s.BlindingKeys {
+		if key, err := scanner.ParseBlindingKey(v); err == nil {
+			keys.PrivateKeys = append(keys.PrivateKeys, key)
+		}
+	}
+	if key, err := scanner.ParseBlindingKey(s.MasterBlindingKey); err == nil {
+		keys.MasterKey = key
+	}
+
+	return append(opts, scanner.WithBlindingKeys(keys))
+}
+
+// scanEvents returns the events watched by the scanner for the subscriber:
+// its UTXO set (see updateUtxos) is always maintained, so the funding and
+// the spending of its utxos are watched even if they are not notified
+func (s *Subscriber) scanEvents() []scanner.EventType {
+	events := make([]scanner.EventType, 0, len(s.Events)+2)
+	events = append(events, s.Events...)
+	for _, v := range []scanner.EventType{scanner.UnspentUtxo, scanner.SpentUtxo} {
+		if !s.watches(v) {
+			events = append(events, v)
+		}
+	}
+	return events
+}
+
+// notifies returns true if the subscriber is notified of the event, the
+// conflicts are notified to the subscribers of utxo events
+func (s *Subscriber) notifies(event scanner.EventType) bool {
+	if event == scanner.Conflict {
+		return s.watches(scanner.UnspentUtxo) || s.watches(scanner.SpentUtxo)
+	}
+	return s.watches(event)
+}
+
+// watches returns true if the subscriber asked for the event
+func (s *Subscriber) watches(event scanner.EventType) bool {
+	for _, v := range s.Events {
+		if v == event {
+			return true
+		}
+	}
+	return false
+}
+
+func validateBlockHash(value interface{}) error {
+	hash, _ := value.(string)
+	if hash == "" {
+		return nil
+	}
+
+	_, err := chainhash.NewHashFromStr(hash)
+	return err
+}
+
+// startOptions returns the scan options resolving the subscriber start height,
+// if any
+func (s *Subscriber) startOptions() []scanner.ScanRequestOption {
+	opts := make([]scanner.ScanRequestOption, 0)
+	if !s.BirthdayTime.IsZero() {
+		opts = append(opts, scanner.WithStartTime(s.BirthdayTime))
+	}
+	if s.StartBlockHash != "" {
+		hash, err := chainhash.NewHashFromStr(s.StartBlockHash)
+		if err == nil {
+			opts = append(opts, scanner.WithStartBlockHash(*hash))
+		}
+	}
+
+	return opts
+}
+
 type SubscriberEventReport struct {
 	SubscriberID SubscriberID
 	EventType    scanner.EventType
 	BlockHeight  int
 	Transaction  *transaction.Transaction
 	BlockHash    *chainhash.Hash
+	// TxIndex is the position of the transaction in the block, Operation
+	// classifies it, Outputs and Inputs are the ones matching the subscription
+	TxIndex   uint32
+	Operation scanner.AssetOperation
+	Outputs   []scanner.MatchedOutput
+	Inputs    []scanner.MatchedInput
+	// Pegins and Pegouts are the peg-ins and peg-outs of the transaction
+	Pegins  []scanner.PeginInput
+	Pegouts []scanner.PegoutOutput
+	// Confirmations is set if the subscriber tracks the confirmations of the
+	// events, Reverted if the block of the event has been disconnected
+	Confirmations uint32
+	Reverted      bool
+	// Unconfirmed is set if the transaction is in the mempool,
+	// SeenUnconfirmed if it is confirmed after being notified unconfirmed
+	Unconfirmed     bool
+	SeenUnconfirmed bool
+	// ConflictTxHash is set if the event is a Conflict, the transaction
+	// double-spends the watched outpoints spent by this other one
+	ConflictTxHash *chainhash.Hash
+	// Derivation says which descriptor script has been matched
+	Derivation *scanner.ScriptDerivation
 }
 
 type SubscriberErrorReport struct {
 	SubscriberID SubscriberID
 	ErrorMsg     error
 }
+
+func (s *Subscriber) isPersistent() bool {
+	return s.EndpointUrl != ""
+}
+
+func (s *Subscriber) toDomain() *domain.Subscription {
+	return &domain.Subscription{
+		ID:                uuid.UUID(s.ID),
+		WalletDescriptors: s.WalletDescriptors,
+		EventTypes:        s.Events,
+		StartBlockHeight:  uint32(s.BlockHeight),
+		EndpointUrl:       s.EndpointUrl,
+		BlindingKeys:      s.BlindingKeys,
+		MasterBlindingKey: s.MasterBlindingKey,
+		ConfirmationDepth: s.ConfirmationDepth,
+		AssetID:           s.AssetID,
+	}
+}
+
+func subscriberFromDomain(subscription *domain.Subscription) Subscriber {
+	return Subscriber{
+		ID:                SubscriberID(subscription.ID),
+		BlockHeight:       int(subscription.ResumeHeight()),
+		Events:            subscription.EventTypes,
+		WalletDescriptors: subscription.WalletDescriptors,
+		EndpointUrl:       subscription.EndpointUrl,
+		BlindingKeys:      subscription.BlindingKeys,
+		MasterBlindingKey: subscription.MasterBlindingKey,
+		ConfirmationDepth: subscription.ConfirmationDepth,
+		AssetID:           subscription.AssetID,
+	}
+}
@@ -0,0 +1,91 @@
+package application
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+// updateUtxos applies the confirmed transaction of the report to the UTXO set
+// of the subscriber: the outputs paying to its scripts are added, the inputs
+// spending its outpoints mark them spent
+func (n *notificationService) updateUtxos(report scanner.Report) {
+	// unconfirmed transactions and conflicts don't change the UTXO set, the
+	// next confirmations of a transaction are already applied
+	if report.Unconfirmed || report.ConflictTxHash != nil || report.Confirmations > 1 {
+		return
+	}
+
+	ctx := context.Background()
+	subscriberID := report.Request.ClientID
+	txID := report.Transaction.TxHash().String()
+
+	if report.Reverted {
+		if err := n.utxoRepo.RevertTx(ctx, subscriberID, txID); err != nil {
+			log.Errorf("failed to revert utxos of subscriber %v: %v", subscriberID, err)
+		}
+		return
+	}
+
+	switch report.EventType() {
+	case scanner.UnspentUtxo, scanner.AssetUtxo, scanner.Pegin:
+		if err := n.utxoRepo.AddUtxos(ctx, utxosFromReport(report)); err != nil {
+			log.Errorf("failed to add utxos of subscriber %v: %v", subscriberID, err)
+		}
+	case scanner.SpentUtxo, scanner.Issuance, scanner.Reissuance, scanner.Pegout:
+		outpoints := make([]domain.Outpoint, 0, len(report.Inputs))
+		for _, in := range report.Inputs {
+			outpoints = append(outpoints, domain.Outpoint{
+				TxID: in.PrevoutHash.String(),
+				VOut: in.PrevoutIndex,
+			})
+		}
+
+		if err := n.utxoRepo.SpendUtxos(ctx, subscriberID, outpoints, txID); err != nil {
+			log.Errorf("failed to spend utxos of subscriber %v: %v", subscriberID, err)
+		}
+	}
+}
+
+func utxosFromReport(report scanner.Report) []*domain.Utxo {
+	utxos := make([]*domain.Utxo, 0, len(report.Outputs))
+	for _, out := range report.Outputs {
+		confidential := out.IsConfidential() && !out.Unblinded
+
+		utxo := &domain.Utxo{
+			SubscriptionID: report.Request.ClientID,
+			TxID:           report.Transaction.TxHash().String(),
+			VOut:           out.Index,
+			Script:         out.Script,
+			BlockHeight:    report.BlockHeight,
+			Confidential:   confidential,
+		}
+		if !confidential {
+			utxo.Value = out.Value
+			utxo.Asset = out.Asset
+		}
+
+		utxos = append(utxos, utxo)
+	}
+
+	return utxos
+}
+
+func (n *notificationService) Unspents(id SubscriberID) ([]*domain.Utxo, error) {
+	if _, ok := n.getSubscriberSafe(id); !ok {
+		return nil, ErrSubscriberNotFound
+	}
+
+	return n.utxoRepo.GetUnspents(context.Background(), uuid.UUID(id))
+}
+
+func (n *notificationService) Balance(id SubscriberID) (map[string]uint64, error) {
+	if _, ok := n.getSubscriberSafe(id); !ok {
+		return nil, ErrSubscriberNotFound
+	}
+
+	return n.utxoRepo.GetBalance(context.Background(), uuid.UUID(id))
+}
@@ -0,0 +1,247 @@
+package application
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+	"github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/inmemory"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+const testAsset = "5ac9f65c0efcc4775e0baec4ec03abdde22473cd3cf33c0419ca290e0751b225"
+
+var testScript = []byte{0x00, 0x14, 0x01}
+
+// eventItem is a watch item reporting the given event
+type eventItem scanner.EventType
+
+func (e eventItem) Bytes() []byte                                        { return testScript }
+func (e eventItem) Match(*transaction.Transaction) *scanner.MatchDetails { return nil }
+func (e eventItem) EventType() scanner.EventType                         { return scanner.EventType(e) }
+
+func newTestService() *notificationService {
+	return &notificationService{
+		subscribers:             make(map[SubscriberID]Subscriber),
+		subscribersLock:         new(sync.RWMutex),
+		utxoRepo:                inmemory.NewUtxoInmemory(),
+		txHistoryRepo:           inmemory.NewTxHistoryInmemory(),
+		subscriptionRepo:        inmemory.NewSubscriptionInmemory(),
+		subsEventReport:         make(chan SubscriberEventReport),
+		subsErrorReport:         make(chan SubscriberErrorReport),
+		quitHandleOnChainEvents: make(chan struct{}),
+	}
+}
+
+// newTestTx returns a transaction spending the given outpoints and paying
+// the given values, the outputs with a nil script don't pay to the wallet
+func newTestTx(spent []chainhash.Hash, values []uint64, scripts [][]byte) *transaction.Transaction {
+	tx := transaction.NewTx(2)
+	for _, hash := range spent {
+		tx.AddInput(transaction.NewTxInput(hash[:], 0))
+	}
+	for i, value := range values {
+		script := scripts[i]
+		if script == nil {
+			script = []byte{0x00, 0x14, 0xff}
+		}
+		out := transaction.NewTxOutput(nil, make([]byte, 9), script)
+		out.Value, _ = elementsutil.ValueToBytes(value)
+		tx.AddOutput(out)
+	}
+	return tx
+}
+
+// fundingReport reports the outputs of tx paying to the wallet
+func fundingReport(clientID uuid.UUID, tx *transaction.Transaction, height uint32) scanner.Report {
+	report := scanner.Report{
+		Transaction: tx,
+		BlockHeight: height,
+		Request:     &scanner.ScanRequest{ClientID: clientID, Item: eventItem(scanner.UnspentUtxo)},
+	}
+	for i, out := range tx.Outputs {
+		if string(out.Script) != string(testScript) {
+			continue
+		}
+		value, _ := elementsutil.ValueFromBytes(out.Value)
+		report.Outputs = append(report.Outputs, scanner.MatchedOutput{
+			Index:  uint32(i),
+			Script: out.Script,
+			Value:  value,
+			Asset:  testAsset,
+		})
+	}
+	return report
+}
+
+// spendingReport reports the inputs of tx spending the given outpoints
+func spendingReport(clientID uuid.UUID, tx *transaction.Transaction, height uint32) scanner.Report {
+	report := scanner.Report{
+		Transaction: tx,
+		BlockHeight: height,
+		Request:     &scanner.ScanRequest{ClientID: clientID, Item: eventItem(scanner.SpentUtxo)},
+	}
+	for i, in := range tx.Inputs {
+		hash, _ := chainhash.NewHash(in.Hash)
+		report.Inputs = append(report.Inputs, scanner.MatchedInput{
+			Index:        uint32(i),
+			PrevoutHash:  *hash,
+			PrevoutIndex: in.Index,
+		})
+	}
+	return report
+}
+
+func TestUpdateUtxos(t *testing.T) {
+	n := newTestService()
+	clientID := uuid.New()
+	ctx := context.Background()
+
+	funding := newTestTx(nil, []uint64{1000}, [][]byte{testScript})
+	n.updateUtxos(fundingReport(clientID, funding, 10))
+
+	balance, err := n.utxoRepo.GetBalance(ctx, clientID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), balance[testAsset])
+
+	// unconfirmed transactions, conflicts and next confirmations are ignored
+	spending := newTestTx([]chainhash.Hash{funding.TxHash()}, []uint64{900}, [][]byte{nil})
+	unconfirmed := spendingReport(clientID, spending, 0)
+	unconfirmed.Unconfirmed = true
+	n.updateUtxos(unconfirmed)
+	conflict := spendingReport(clientID, spending, 11)
+	conflictTxHash := chainhash.Hash{0x01}
+	conflict.ConflictTxHash = &conflictTxHash
+	n.updateUtxos(conflict)
+
+	unspents, err := n.utxoRepo.GetUnspents(ctx, clientID)
+	require.NoError(t, err)
+	require.Len(t, unspents, 1)
+
+	// the spending removes the utxo from the set
+	n.updateUtxos(spendingReport(clientID, spending, 11))
+	unspents, err = n.utxoRepo.GetUnspents(ctx, clientID)
+	require.NoError(t, err)
+	require.Empty(t, unspents)
+
+	// the utxo is unspent again if the block of the spending is disconnected
+	reverted := spendingReport(clientID, spending, 11)
+	reverted.Reverted = true
+	n.updateUtxos(reverted)
+	balance, err = n.utxoRepo.GetBalance(ctx, clientID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(1000), balance[testAsset])
+}
+
+func TestSubscriberScanEvents(t *testing.T) {
+	tests := []struct {
+		events   []scanner.EventType
+		expected []scanner.EventType
+	}{
+		{
+			events:   []scanner.EventType{scanner.UnspentUtxo},
+			expected: []scanner.EventType{scanner.UnspentUtxo, scanner.SpentUtxo},
+		},
+		{
+			events:   []scanner.EventType{scanner.Pegin, scanner.Pegout},
+			expected: []scanner.EventType{scanner.Pegin, scanner.Pegout, scanner.UnspentUtxo, scanner.SpentUtxo},
+		},
+		{
+			events:   []scanner.EventType{scanner.UnspentUtxo, scanner.SpentUtxo},
+			expected: []scanner.EventType{scanner.UnspentUtxo, scanner.SpentUtxo},
+		},
+		// the utxos are kept whatever the events
+		{
+			events:   []scanner.EventType{scanner.SpentUtxo},
+			expected: []scanner.EventType{scanner.SpentUtxo, scanner.UnspentUtxo},
+		},
+		{
+			events:   []scanner.EventType{scanner.Issuance},
+			expected: []scanner.EventType{scanner.Issuance, scanner.UnspentUtxo, scanner.SpentUtxo},
+		},
+	}
+
+	for _, tt := range tests {
+		sub := Subscriber{Events: tt.events}
+		require.Equal(t, tt.expected, sub.scanEvents())
+	}
+}
+
+func TestSpentUtxoSubscriberUtxos(t *testing.T) {
+	n := newTestService()
+	sub := Subscriber{ID: SubscriberID(uuid.New()), Events: []scanner.EventType{scanner.SpentUtxo}}
+	n.addSubscriberSafe(sub)
+	clientID := uuid.UUID(sub.ID)
+
+	reports := make(chan scanner.Report)
+	go n.handleOnChainEvents(reports)
+	defer func() { n.quitHandleOnChainEvents <- struct{}{} }()
+
+	// the funding is not notified, it builds the UTXO set only
+	funding := newTestTx(nil, []uint64{1000}, [][]byte{testScript})
+	reports <- fundingReport(clientID, funding, 10)
+	require.Eventually(t, func() bool {
+		balance, err := n.utxoRepo.GetBalance(context.Background(), clientID)
+		return err == nil && balance[testAsset] == 1000
+	}, 3*time.Second, 10*time.Millisecond)
+
+	spending := newTestTx([]chainhash.Hash{funding.TxHash()}, []uint64{900}, [][]byte{nil})
+	go func() { reports <- spendingReport(clientID, spending, 11) }()
+
+	select {
+	case event := <-n.subsEventReport:
+		require.Equal(t, scanner.SpentUtxo, event.EventType)
+		require.Equal(t, spending.TxHash(), event.Transaction.TxHash())
+	case <-time.After(3 * time.Second):
+		t.Fatal("event not notified")
+	}
+
+	unspents, err := n.utxoRepo.GetUnspents(context.Background(), clientID)
+	require.NoError(t, err)
+	require.Empty(t, unspents)
+}
+
+func TestHandleOnChainEventsNotifiedEvents(t *testing.T) {
+	n := newTestService()
+	sub := Subscriber{ID: SubscriberID(uuid.New()), Events: []scanner.EventType{scanner.UnspentUtxo}}
+	n.addSubscriberSafe(sub)
+	clientID := uuid.UUID(sub.ID)
+
+	reports := make(chan scanner.Report)
+	go n.handleOnChainEvents(reports)
+	defer func() { n.quitHandleOnChainEvents <- struct{}{} }()
+
+	funding := newTestTx(nil, []uint64{1000}, [][]byte{testScript})
+	spending := newTestTx([]chainhash.Hash{funding.TxHash()}, []uint64{900}, [][]byte{nil})
+	conflict := spendingReport(clientID, spending, 11)
+	conflictTxHash := chainhash.Hash{0x01}
+	conflict.ConflictTxHash = &conflictTxHash
+
+	go func() {
+		reports <- fundingReport(clientID, funding, 10)
+		// the spending tracks the UTXO set only
+		reports <- spendingReport(clientID, spending, 11)
+		reports <- conflict
+	}()
+
+	notified := make([]scanner.EventType, 0)
+	for len(notified) < 2 {
+		select {
+		case event := <-n.subsEventReport:
+			notified = append(notified, event.EventType)
+		case <-time.After(3 * time.Second):
+			t.Fatal("event not notified")
+		}
+	}
+	require.Equal(t, []scanner.EventType{scanner.UnspentUtxo, scanner.Conflict}, notified)
+
+	unspents, err := n.utxoRepo.GetUnspents(context.Background(), clientID)
+	require.NoError(t, err)
+	require.Empty(t, unspents)
+}
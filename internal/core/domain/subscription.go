@@ -0,0 +1,58 @@
+package domain
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+var ErrSubscriptionNotFound = errors.New("subscription not found")
+
+// Subscription is the persisted state of a neutrinod subscriber, it allows to
+// resume watching its wallet descriptors after a restart
+type Subscription struct {
+	ID                uuid.UUID
+	WalletDescriptors []string
+	EventTypes        []scanner.EventType
+	StartBlockHeight  uint32
+	// LastScannedHeight is the height up to which the scanner has processed
+	// the subscription, 0 means nothing has been scanned yet
+	LastScannedHeight uint32
+	// EndpointUrl is the webhook to notify, empty for web-socket subscribers
+	EndpointUrl string
+	// BlindingKeys and MasterBlindingKey (SLIP-77), hex encoded, are used to
+	// unblind the outputs of the subscription
+	BlindingKeys      []string
+	MasterBlindingKey string
+	// ConfirmationDepth is the depth up to which the confirmations of the
+	// events are notified
+	ConfirmationDepth uint32
+	// AssetID is the asset whose outputs are reported as AssetUtxo events
+	AssetID string
+	// LastUsedIndexes are the highest indexes of the range descriptor scripts
+	// that received funds, one per descriptor branch
+	LastUsedIndexes []scanner.ScriptDerivation
+}
+
+// ResumeHeight returns the height from which the scanner should restart
+func (s *Subscription) ResumeHeight() uint32 {
+	if s.LastScannedHeight >= s.StartBlockHeight && s.LastScannedHeight > 0 {
+		return s.LastScannedHeight + 1
+	}
+
+	return s.StartBlockHeight
+}
+
+type SubscriptionRepository interface {
+	// PutSubscription stores the subscription, overriding any existing one with the same ID
+	PutSubscription(context.Context, *Subscription) error
+	GetSubscription(context.Context, uuid.UUID) (*Subscription, error)
+	GetAllSubscriptions(context.Context) ([]*Subscription, error)
+	UpdateLastScannedHeight(context.Context, uuid.UUID, uint32) error
+	// UpdateLastUsedIndex stores the index of the descriptor branch if it is
+	// higher than the stored one
+	UpdateLastUsedIndex(context.Context, uuid.UUID, scanner.ScriptDerivation) error
+	DeleteSubscription(context.Context, uuid.UUID) error
+}
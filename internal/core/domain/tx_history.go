@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Incoming transactions pay to the subscription scripts only, Outgoing
+	// ones spend some of its utxos
+	Incoming TxDirection = "incoming"
+	Outgoing TxDirection = "outgoing"
+)
+
+type TxDirection string
+
+// TxHistoryEntry is a confirmed transaction touching the scripts of a
+// subscription, the amounts are those of its explicit or unblinded utxos
+type TxHistoryEntry struct {
+	SubscriptionID uuid.UUID
+	TxID           string
+	BlockHeight    uint32
+	// TxIndex is the position of the transaction in the block
+	TxIndex   uint32
+	Direction TxDirection
+	// Received is the amount per asset of the outputs paying to the
+	// subscription, Sent the one of the subscription utxos spent
+	Received map[string]uint64
+	Sent     map[string]uint64
+}
+
+// NewTxHistoryEntry returns the entry of the transaction given its direction
+// and the utxos of the subscription it creates or spends (see
+// UtxoRepository.GetTxUtxos)
+func NewTxHistoryEntry(
+	subscriptionID uuid.UUID,
+	txID string,
+	blockHeight uint32,
+	txIndex uint32,
+	direction TxDirection,
+	utxos []*Utxo,
+) *TxHistoryEntry {
+	entry := &TxHistoryEntry{
+		SubscriptionID: subscriptionID,
+		TxID:           txID,
+		BlockHeight:    blockHeight,
+		TxIndex:        txIndex,
+		Direction:      direction,
+		Received:       make(map[string]uint64),
+		Sent:           make(map[string]uint64),
+	}
+
+	for _, u := range utxos {
+		amounts := entry.Received
+		if u.SpentBy == txID {
+			amounts = entry.Sent
+		}
+
+		if !u.Confidential {
+			amounts[u.Asset] += u.Value
+		}
+	}
+
+	return entry
+}
+
+// NetAmounts returns the amount received minus the one sent, per asset
+func (e *TxHistoryEntry) NetAmounts() map[string]int64 {
+	amounts := make(map[string]int64)
+	for asset, value := range e.Received {
+		amounts[asset] += int64(value)
+	}
+	for asset, value := range e.Sent {
+		amounts[asset] -= int64(value)
+	}
+
+	return amounts
+}
+
+// TxHistoryCursor is the position of a transaction in the history, the
+// entries are sorted from the most recent one
+type TxHistoryCursor struct {
+	BlockHeight uint32
+	TxIndex     uint32
+}
+
+// TxHistoryFilter selects a page of the history of a subscription
+type TxHistoryFilter struct {
+	// FromHeight and ToHeight bound the heights of the entries, ToHeight 0
+	// means no upper bound
+	FromHeight uint32
+	ToHeight   uint32
+	// After, if set, selects the entries older than the cursor
+	After *TxHistoryCursor
+	Limit int
+}
+
+type TxHistoryRepository interface {
+	// PutTx stores the entry, overriding any existing one for the same
+	// subscription and transaction
+	PutTx(context.Context, *TxHistoryEntry) error
+	// DeleteTx drops the entry of the transaction, eg. if its block is reverted
+	DeleteTx(ctx context.Context, subscriptionID uuid.UUID, txID string) error
+	// GetTxHistory returns the entries of the subscription selected by the
+	// filter, from the most recent one
+	GetTxHistory(context.Context, uuid.UUID, TxHistoryFilter) ([]*TxHistoryEntry, error)
+	// DeleteTxHistory drops the history of the subscription
+	DeleteTxHistory(context.Context, uuid.UUID) error
+}
@@ -0,0 +1,78 @@
+package domain
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Utxo is an output of a subscription wallet, the UTXO set of a subscription
+// is built from the events reported by the scanner
+type Utxo struct {
+	SubscriptionID uuid.UUID
+	TxID           string
+	VOut           uint32
+	Script         []byte
+	// BlockHeight is the height of the block including the transaction
+	BlockHeight uint32
+	// Value and Asset are set if the output is explicit or has been unblinded
+	// with the subscription blinding keys, Confidential is set otherwise
+	Value        uint64
+	Asset        string
+	Confidential bool
+	// SpentBy is the id of the transaction spending the output, empty if unspent
+	SpentBy string
+}
+
+// Outpoint is a reference to a transaction output
+type Outpoint struct {
+	TxID string
+	VOut uint32
+}
+
+func (o Outpoint) String() string {
+	return fmt.Sprintf("%s:%d", o.TxID, o.VOut)
+}
+
+func (u *Utxo) Outpoint() Outpoint {
+	return Outpoint{TxID: u.TxID, VOut: u.VOut}
+}
+
+func (u *Utxo) IsSpent() bool {
+	return u.SpentBy != ""
+}
+
+// Balance returns the sum of the values of the unspent outputs per asset, the
+// confidential ones are not counted
+func Balance(utxos []*Utxo) map[string]uint64 {
+	balance := make(map[string]uint64)
+	for _, u := range utxos {
+		if u.IsSpent() || u.Confidential {
+			continue
+		}
+		balance[u.Asset] += u.Value
+	}
+
+	return balance
+}
+
+type UtxoRepository interface {
+	// AddUtxos stores the utxos, the ones already stored are left unchanged
+	AddUtxos(context.Context, []*Utxo) error
+	// SpendUtxos marks the stored utxos of the subscription as spent by the
+	// transaction, the outpoints not stored are ignored
+	SpendUtxos(ctx context.Context, subscriptionID uuid.UUID, outpoints []Outpoint, spentBy string) error
+	// RevertTx drops the utxos of the subscription created by the transaction
+	// and marks unspent the ones it was spending, eg. if its block is reverted
+	RevertTx(ctx context.Context, subscriptionID uuid.UUID, txID string) error
+	// GetUnspents returns the unspent utxos of the subscription
+	GetUnspents(context.Context, uuid.UUID) ([]*Utxo, error)
+	// GetTxUtxos returns the utxos of the subscription created or spent by
+	// the transaction
+	GetTxUtxos(ctx context.Context, subscriptionID uuid.UUID, txID string) ([]*Utxo, error)
+	// GetBalance returns the balance per asset of the subscription (see Balance)
+	GetBalance(context.Context, uuid.UUID) (map[string]uint64, error)
+	// DeleteUtxos drops the utxos of the subscription
+	DeleteUtxos(context.Context, uuid.UUID) error
+}
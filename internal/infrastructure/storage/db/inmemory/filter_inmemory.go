@@ -9,6 +9,7 @@ import (
 
 type FilterInmemory struct {
 	filtersByHash map[string][]byte
+	prunedHeight  uint32
 	locker        *sync.RWMutex
 }
 
@@ -41,3 +42,41 @@ func (f *FilterInmemory) GetFilter(_ context.Context, key repository.FilterKey)
 		NBytes: filter,
 	}, nil
 }
+
+func (f *FilterInmemory) GetFilterKeys(context.Context) ([]string, error) {
+	f.locker.RLock()
+	defer f.locker.RUnlock()
+
+	keys := make([]string, 0, len(f.filtersByHash))
+	for k := range f.filtersByHash {
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (f *FilterInmemory) DeleteFilters(_ context.Context, keys ...string) error {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	for _, k := range keys {
+		delete(f.filtersByHash, k)
+	}
+
+	return nil
+}
+
+func (f *FilterInmemory) SetPrunedHeight(_ context.Context, height uint32) error {
+	f.locker.Lock()
+	defer f.locker.Unlock()
+
+	f.prunedHeight = height
+	return nil
+}
+
+func (f *FilterInmemory) GetPrunedHeight(context.Context) (uint32, error) {
+	f.locker.RLock()
+	defer f.locker.RUnlock()
+
+	return f.prunedHeight, nil
+}
@@ -3,6 +3,7 @@ package inmemory
 import (
 	"context"
 	"sync"
+	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -72,18 +73,52 @@ func (h *headerInmemory) WriteHeaders(_ context.Context, headers ...block.Header
 	h.locker.Lock()
 	defer h.locker.Unlock()
 
-	for _, header := range headers {
+	for i := range headers {
+		header := headers[i]
 		hash, err := header.Hash()
 		if err != nil {
 			logrus.Error(err)
 			continue
 		}
+
+		// a header at the height of another one replaces it together with the
+		// headers on top of it (reorg)
+		replaced := false
+		for k, v := range h.headers {
+			if v.Height == header.Height && k != hash {
+				replaced = true
+				break
+			}
+		}
+		if replaced {
+			for k, v := range h.headers {
+				if v.Height >= header.Height {
+					delete(h.headers, k)
+				}
+			}
+		}
+
 		h.headers[hash] = &header
 	}
 
 	return nil
 }
 
+func (h *headerInmemory) GetHeightByTime(ctx context.Context, t time.Time) (uint32, error) {
+	tip, err := h.ChainTip(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return repository.SearchHeightByTime(tip.Height, t, func(height uint32) (uint32, error) {
+		header, err := h.getBlockHeaderByHeight(height)
+		if err != nil {
+			return 0, err
+		}
+		return header.Timestamp, nil
+	})
+}
+
 func (h *headerInmemory) LatestBlockLocator(ctx context.Context) (blockchain.BlockLocator, error) {
 	tip, err := h.ChainTip(ctx)
 	if err != nil {
@@ -180,3 +215,16 @@ func (h *headerInmemory) HasAllAncestors(_ context.Context, hash chainhash.Hash)
 
 	return true, nil
 }
+
+func (h *headerInmemory) DeleteHeadersFromHeight(_ context.Context, height uint32) error {
+	h.locker.Lock()
+	defer h.locker.Unlock()
+
+	for hash, header := range h.headers {
+		if header.Height >= height {
+			delete(h.headers, hash)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+type subscriptionInmemory struct {
+	subscriptions map[uuid.UUID]domain.Subscription
+	locker        *sync.RWMutex
+}
+
+func NewSubscriptionInmemory() domain.SubscriptionRepository {
+	return &subscriptionInmemory{
+		subscriptions: make(map[uuid.UUID]domain.Subscription),
+		locker:        new(sync.RWMutex),
+	}
+}
+
+func (s *subscriptionInmemory) PutSubscription(_ context.Context, subscription *domain.Subscription) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.subscriptions[subscription.ID] = *subscription
+	return nil
+}
+
+func (s *subscriptionInmemory) GetSubscription(_ context.Context, id uuid.UUID) (*domain.Subscription, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return nil, domain.ErrSubscriptionNotFound
+	}
+
+	return &subscription, nil
+}
+
+func (s *subscriptionInmemory) GetAllSubscriptions(context.Context) ([]*domain.Subscription, error) {
+	s.locker.RLock()
+	defer s.locker.RUnlock()
+
+	subscriptions := make([]*domain.Subscription, 0, len(s.subscriptions))
+	for _, v := range s.subscriptions {
+		subscription := v
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	return subscriptions, nil
+}
+
+func (s *subscriptionInmemory) UpdateLastScannedHeight(_ context.Context, id uuid.UUID, height uint32) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return domain.ErrSubscriptionNotFound
+	}
+
+	subscription.LastScannedHeight = height
+	s.subscriptions[id] = subscription
+	return nil
+}
+
+func (s *subscriptionInmemory) UpdateLastUsedIndex(
+	_ context.Context,
+	id uuid.UUID,
+	used scanner.ScriptDerivation,
+) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	subscription, ok := s.subscriptions[id]
+	if !ok {
+		return domain.ErrSubscriptionNotFound
+	}
+
+	indexes := make([]scanner.ScriptDerivation, 0, len(subscription.LastUsedIndexes)+1)
+	found := false
+	for _, v := range subscription.LastUsedIndexes {
+		if v.Descriptor == used.Descriptor && v.Branch == used.Branch {
+			found = true
+			if used.Index > v.Index {
+				v.Index = used.Index
+			}
+		}
+		indexes = append(indexes, v)
+	}
+	if !found {
+		indexes = append(indexes, used)
+	}
+
+	subscription.LastUsedIndexes = indexes
+	s.subscriptions[id] = subscription
+	return nil
+}
+
+func (s *subscriptionInmemory) DeleteSubscription(_ context.Context, id uuid.UUID) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if _, ok := s.subscriptions[id]; !ok {
+		return domain.ErrSubscriptionNotFound
+	}
+
+	delete(s.subscriptions, id)
+	return nil
+}
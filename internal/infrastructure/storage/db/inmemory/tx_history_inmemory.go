@@ -0,0 +1,99 @@
+package inmemory
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+)
+
+type txHistoryInmemory struct {
+	// txs is a map of subscription IDs and their history entries by tx id
+	txs    map[uuid.UUID]map[string]domain.TxHistoryEntry
+	locker *sync.RWMutex
+}
+
+func NewTxHistoryInmemory() domain.TxHistoryRepository {
+	return &txHistoryInmemory{
+		txs:    make(map[uuid.UUID]map[string]domain.TxHistoryEntry),
+		locker: new(sync.RWMutex),
+	}
+}
+
+func (t *txHistoryInmemory) PutTx(_ context.Context, entry *domain.TxHistoryEntry) error {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	subTxs, ok := t.txs[entry.SubscriptionID]
+	if !ok {
+		subTxs = make(map[string]domain.TxHistoryEntry)
+		t.txs[entry.SubscriptionID] = subTxs
+	}
+
+	subTxs[entry.TxID] = *entry
+	return nil
+}
+
+func (t *txHistoryInmemory) DeleteTx(_ context.Context, subscriptionID uuid.UUID, txID string) error {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	delete(t.txs[subscriptionID], txID)
+	return nil
+}
+
+func (t *txHistoryInmemory) GetTxHistory(
+	_ context.Context,
+	subscriptionID uuid.UUID,
+	filter domain.TxHistoryFilter,
+) ([]*domain.TxHistoryEntry, error) {
+	t.locker.RLock()
+	defer t.locker.RUnlock()
+
+	entries := make([]*domain.TxHistoryEntry, 0)
+	for _, v := range t.txs[subscriptionID] {
+		if v.BlockHeight < filter.FromHeight {
+			continue
+		}
+		if filter.ToHeight > 0 && v.BlockHeight > filter.ToHeight {
+			continue
+		}
+		if after := filter.After; after != nil && !isBefore(v, *after) {
+			continue
+		}
+
+		entry := v
+		entries = append(entries, &entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return !isBefore(*entries[i], domain.TxHistoryCursor{
+			BlockHeight: entries[j].BlockHeight,
+			TxIndex:     entries[j].TxIndex,
+		})
+	})
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+
+	return entries, nil
+}
+
+func (t *txHistoryInmemory) DeleteTxHistory(_ context.Context, subscriptionID uuid.UUID) error {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	delete(t.txs, subscriptionID)
+	return nil
+}
+
+// isBefore returns true if the entry precedes the cursor position in the chain
+func isBefore(entry domain.TxHistoryEntry, cursor domain.TxHistoryCursor) bool {
+	if entry.BlockHeight != cursor.BlockHeight {
+		return entry.BlockHeight < cursor.BlockHeight
+	}
+	return entry.TxIndex < cursor.TxIndex
+}
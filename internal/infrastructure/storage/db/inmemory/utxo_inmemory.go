@@ -0,0 +1,140 @@
+package inmemory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+)
+
+type utxoInmemory struct {
+	// utxos is a map of subscription IDs and their utxos by outpoint
+	utxos  map[uuid.UUID]map[domain.Outpoint]domain.Utxo
+	locker *sync.RWMutex
+}
+
+func NewUtxoInmemory() domain.UtxoRepository {
+	return &utxoInmemory{
+		utxos:  make(map[uuid.UUID]map[domain.Outpoint]domain.Utxo),
+		locker: new(sync.RWMutex),
+	}
+}
+
+func (u *utxoInmemory) AddUtxos(_ context.Context, utxos []*domain.Utxo) error {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	for _, utxo := range utxos {
+		subUtxos, ok := u.utxos[utxo.SubscriptionID]
+		if !ok {
+			subUtxos = make(map[domain.Outpoint]domain.Utxo)
+			u.utxos[utxo.SubscriptionID] = subUtxos
+		}
+
+		if _, ok := subUtxos[utxo.Outpoint()]; ok {
+			continue
+		}
+		subUtxos[utxo.Outpoint()] = *utxo
+	}
+
+	return nil
+}
+
+func (u *utxoInmemory) SpendUtxos(
+	_ context.Context,
+	subscriptionID uuid.UUID,
+	outpoints []domain.Outpoint,
+	spentBy string,
+) error {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	subUtxos := u.utxos[subscriptionID]
+	for _, outpoint := range outpoints {
+		utxo, ok := subUtxos[outpoint]
+		if !ok {
+			continue
+		}
+
+		utxo.SpentBy = spentBy
+		subUtxos[outpoint] = utxo
+	}
+
+	return nil
+}
+
+func (u *utxoInmemory) RevertTx(_ context.Context, subscriptionID uuid.UUID, txID string) error {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	subUtxos := u.utxos[subscriptionID]
+	for outpoint, utxo := range subUtxos {
+		if utxo.TxID == txID {
+			delete(subUtxos, outpoint)
+			continue
+		}
+
+		if utxo.SpentBy == txID {
+			utxo.SpentBy = ""
+			subUtxos[outpoint] = utxo
+		}
+	}
+
+	return nil
+}
+
+func (u *utxoInmemory) GetUnspents(_ context.Context, subscriptionID uuid.UUID) ([]*domain.Utxo, error) {
+	u.locker.RLock()
+	defer u.locker.RUnlock()
+
+	unspents := make([]*domain.Utxo, 0)
+	for _, v := range u.utxos[subscriptionID] {
+		if v.IsSpent() {
+			continue
+		}
+
+		utxo := v
+		unspents = append(unspents, &utxo)
+	}
+
+	return unspents, nil
+}
+
+func (u *utxoInmemory) GetTxUtxos(
+	_ context.Context,
+	subscriptionID uuid.UUID,
+	txID string,
+) ([]*domain.Utxo, error) {
+	u.locker.RLock()
+	defer u.locker.RUnlock()
+
+	utxos := make([]*domain.Utxo, 0)
+	for _, v := range u.utxos[subscriptionID] {
+		if v.TxID != txID && v.SpentBy != txID {
+			continue
+		}
+
+		utxo := v
+		utxos = append(utxos, &utxo)
+	}
+
+	return utxos, nil
+}
+
+func (u *utxoInmemory) GetBalance(ctx context.Context, subscriptionID uuid.UUID) (map[string]uint64, error) {
+	unspents, err := u.GetUnspents(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return domain.Balance(unspents), nil
+}
+
+func (u *utxoInmemory) DeleteUtxos(_ context.Context, subscriptionID uuid.UUID) error {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	delete(u.utxos, subscriptionID)
+	return nil
+}
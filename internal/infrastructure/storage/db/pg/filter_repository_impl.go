@@ -90,3 +90,58 @@ func (f filterRepositoryImpl) GetFilter(
 		NBytes: filter.Value,
 	}, nil
 }
+
+func (f filterRepositoryImpl) GetFilterKeys(
+	ctx context.Context,
+) ([]string, error) {
+	query := `select filter_key from filter;`
+
+	keys := []string{}
+	if err := f.db.Db.SelectContext(ctx, &keys, query); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (f filterRepositoryImpl) DeleteFilters(
+	ctx context.Context,
+	keys ...string,
+) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	query := `DELETE FROM filter WHERE filter_key = ANY($1);`
+
+	_, err := f.db.Db.ExecContext(ctx, query, pq.Array(keys))
+	return err
+}
+
+func (f filterRepositoryImpl) SetPrunedHeight(
+	ctx context.Context,
+	height uint32,
+) error {
+	query := `INSERT INTO filter_pruning (id, pruned_height) VALUES (1, $1)
+		ON CONFLICT (id) DO UPDATE SET pruned_height = EXCLUDED.pruned_height;`
+
+	_, err := f.db.Db.ExecContext(ctx, query, height)
+	return err
+}
+
+func (f filterRepositoryImpl) GetPrunedHeight(
+	ctx context.Context,
+) (uint32, error) {
+	query := `select pruned_height from filter_pruning where id=1;`
+
+	var height uint32
+	if err := f.db.Db.GetContext(ctx, &height, query); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+
+		return 0, err
+	}
+
+	return height, nil
+}
@@ -7,10 +7,9 @@ import (
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/wire"
-	"github.com/lib/pq"
-	log "github.com/sirupsen/logrus"
 	"github.com/vulpemventures/go-elements/block"
 	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+	"time"
 )
 
 type headerRepositoryImpl struct {
@@ -120,15 +119,17 @@ func (h *headerRepositoryImpl) WriteHeaders(
 			HeaderBytes: headerBytes,
 		}
 
-		query := `INSERT INTO block_header (hash, height, header_bytes) VALUES (:hash, :height, :header_bytes);`
+		// a header at the height of another one replaces it together with the
+		// headers on top of it (reorg)
+		query := `DELETE FROM block_header WHERE height >= $1 AND EXISTS ` +
+			`(SELECT 1 FROM block_header WHERE height = $1 AND hash <> $2);`
+		if _, err = tx.Exec(query, bh.Height, bh.Hash); err != nil {
+			return err
+		}
 
+		query = `INSERT INTO block_header (hash, height, header_bytes) VALUES (:hash, :height, :header_bytes) ` +
+			`ON CONFLICT (hash) DO UPDATE SET height = EXCLUDED.height, header_bytes = EXCLUDED.header_bytes;`
 		if _, err = tx.NamedExec(query, bh); err != nil {
-			if pqErr := err.(*pq.Error); pqErr != nil {
-				if pqErr.Code == uniqueViolation {
-					log.Warnf("header already exists: %s", hash.String())
-					return nil
-				}
-			}
 			return err
 		}
 	}
@@ -189,6 +190,34 @@ func (h *headerRepositoryImpl) HasAllAncestors(
 	return true, nil
 }
 
+func (h *headerRepositoryImpl) DeleteHeadersFromHeight(
+	ctx context.Context,
+	height uint32,
+) error {
+	query := `DELETE FROM block_header WHERE height >= $1;`
+
+	_, err := h.db.Db.ExecContext(ctx, query, height)
+	return err
+}
+
+func (h *headerRepositoryImpl) GetHeightByTime(
+	ctx context.Context,
+	t time.Time,
+) (uint32, error) {
+	tip, err := h.ChainTip(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return repository.SearchHeightByTime(tip.Height, t, func(height uint32) (uint32, error) {
+		header, err := h.getBlockHeaderByHeight(height)
+		if err != nil {
+			return 0, err
+		}
+		return header.Timestamp, nil
+	})
+}
+
 func (h *headerRepositoryImpl) blockLocatorFromHash(blck *block.Header) (blockchain.BlockLocator, error) {
 	headers, err := h.getAllBlockHeaders()
 	if err != nil {
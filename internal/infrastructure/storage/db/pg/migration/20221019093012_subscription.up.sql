@@ -0,0 +1,8 @@
+CREATE TABLE subscription (
+    id uuid PRIMARY KEY,
+    wallet_descriptor text NOT NULL,
+    event_types int[] NOT NULL,
+    start_block_height int NOT NULL,
+    last_scanned_height int NOT NULL DEFAULT 0,
+    endpoint_url varchar(2048) NOT NULL DEFAULT ''
+);
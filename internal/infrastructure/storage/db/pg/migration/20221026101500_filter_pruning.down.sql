@@ -0,0 +1 @@
+DROP TABLE IF EXISTS filter_pruning;
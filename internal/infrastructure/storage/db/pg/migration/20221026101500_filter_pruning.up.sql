@@ -0,0 +1,4 @@
+CREATE TABLE filter_pruning (
+    id int PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    pruned_height int NOT NULL
+);
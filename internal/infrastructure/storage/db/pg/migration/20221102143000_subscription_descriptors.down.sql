@@ -0,0 +1,3 @@
+ALTER TABLE subscription ADD COLUMN wallet_descriptor text NOT NULL DEFAULT '';
+UPDATE subscription SET wallet_descriptor = COALESCE(wallet_descriptors[1], '');
+ALTER TABLE subscription DROP COLUMN wallet_descriptors;
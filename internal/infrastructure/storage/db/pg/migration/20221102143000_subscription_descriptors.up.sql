@@ -0,0 +1,3 @@
+ALTER TABLE subscription ADD COLUMN wallet_descriptors text[] NOT NULL DEFAULT '{}';
+UPDATE subscription SET wallet_descriptors = ARRAY[wallet_descriptor];
+ALTER TABLE subscription DROP COLUMN wallet_descriptor;
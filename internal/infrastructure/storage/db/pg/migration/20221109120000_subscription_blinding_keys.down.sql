@@ -0,0 +1,2 @@
+ALTER TABLE subscription DROP COLUMN master_blinding_key;
+ALTER TABLE subscription DROP COLUMN blinding_keys;
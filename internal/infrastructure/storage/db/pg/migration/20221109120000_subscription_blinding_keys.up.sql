@@ -0,0 +1,2 @@
+ALTER TABLE subscription ADD COLUMN blinding_keys text[] NOT NULL DEFAULT '{}';
+ALTER TABLE subscription ADD COLUMN master_blinding_key text NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE subscription ADD COLUMN confirmation_depth integer NOT NULL DEFAULT 0;
@@ -0,0 +1,12 @@
+CREATE TABLE utxo (
+    subscription_id uuid NOT NULL,
+    tx_id varchar(64) NOT NULL,
+    vout int NOT NULL,
+    script bytea NOT NULL,
+    block_height int NOT NULL,
+    value bigint NOT NULL DEFAULT 0,
+    asset varchar(64) NOT NULL DEFAULT '',
+    confidential boolean NOT NULL DEFAULT false,
+    spent_by varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (subscription_id, tx_id, vout)
+);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS tx_history;
@@ -0,0 +1,12 @@
+CREATE TABLE tx_history (
+    subscription_id uuid NOT NULL,
+    tx_id varchar(64) NOT NULL,
+    block_height int NOT NULL,
+    tx_index int NOT NULL,
+    direction varchar(16) NOT NULL,
+    received jsonb NOT NULL DEFAULT '{}',
+    sent jsonb NOT NULL DEFAULT '{}',
+    PRIMARY KEY (subscription_id, tx_id)
+);
+
+CREATE INDEX tx_history_position ON tx_history (subscription_id, block_height DESC, tx_index DESC);
@@ -0,0 +1,7 @@
+CREATE TABLE subscription_used_index (
+    subscription_id uuid NOT NULL REFERENCES subscription (id) ON DELETE CASCADE,
+    descriptor text NOT NULL,
+    branch int NOT NULL,
+    last_index int NOT NULL,
+    PRIMARY KEY (subscription_id, descriptor, branch)
+);
@@ -0,0 +1 @@
+ALTER TABLE subscription DROP COLUMN asset_id;
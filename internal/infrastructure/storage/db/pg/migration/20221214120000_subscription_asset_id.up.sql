@@ -0,0 +1 @@
+ALTER TABLE subscription ADD COLUMN asset_id text NOT NULL DEFAULT '';
@@ -0,0 +1,233 @@
+package dbpg
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+type subscriptionRepositoryImpl struct {
+	db *DbService
+}
+
+func NewSubscriptionRepositoryImpl(db *DbService) (domain.SubscriptionRepository, error) {
+	return &subscriptionRepositoryImpl{
+		db: db,
+	}, nil
+}
+
+type Subscription struct {
+	ID                uuid.UUID      `db:"id"`
+	WalletDescriptors pq.StringArray `db:"wallet_descriptors"`
+	EventTypes        pq.Int64Array  `db:"event_types"`
+	StartBlockHeight  uint32         `db:"start_block_height"`
+	LastScannedHeight uint32         `db:"last_scanned_height"`
+	EndpointUrl       string         `db:"endpoint_url"`
+	BlindingKeys      pq.StringArray `db:"blinding_keys"`
+	MasterBlindingKey string         `db:"master_blinding_key"`
+	ConfirmationDepth uint32         `db:"confirmation_depth"`
+	AssetID           string         `db:"asset_id"`
+}
+
+type SubscriptionUsedIndex struct {
+	SubscriptionID uuid.UUID `db:"subscription_id"`
+	Descriptor     string    `db:"descriptor"`
+	Branch         uint32    `db:"branch"`
+	LastIndex      uint32    `db:"last_index"`
+}
+
+func (s *subscriptionRepositoryImpl) PutSubscription(
+	ctx context.Context,
+	subscription *domain.Subscription,
+) error {
+	eventTypes := make(pq.Int64Array, 0, len(subscription.EventTypes))
+	for _, v := range subscription.EventTypes {
+		eventTypes = append(eventTypes, int64(v))
+	}
+
+	sub := Subscription{
+		ID:                subscription.ID,
+		WalletDescriptors: subscription.WalletDescriptors,
+		EventTypes:        eventTypes,
+		StartBlockHeight:  subscription.StartBlockHeight,
+		LastScannedHeight: subscription.LastScannedHeight,
+		EndpointUrl:       subscription.EndpointUrl,
+		BlindingKeys:      subscription.BlindingKeys,
+		MasterBlindingKey: subscription.MasterBlindingKey,
+		ConfirmationDepth: subscription.ConfirmationDepth,
+		AssetID:           subscription.AssetID,
+	}
+	if sub.BlindingKeys == nil {
+		sub.BlindingKeys = pq.StringArray{}
+	}
+
+	query := `INSERT INTO subscription (id, wallet_descriptors, event_types, start_block_height, last_scanned_height, endpoint_url, blinding_keys, master_blinding_key, confirmation_depth, asset_id) ` +
+		`VALUES (:id, :wallet_descriptors, :event_types, :start_block_height, :last_scanned_height, :endpoint_url, :blinding_keys, :master_blinding_key, :confirmation_depth, :asset_id) ` +
+		`ON CONFLICT (id) DO UPDATE SET wallet_descriptors = EXCLUDED.wallet_descriptors, ` +
+		`event_types = EXCLUDED.event_types, start_block_height = EXCLUDED.start_block_height, ` +
+		`last_scanned_height = EXCLUDED.last_scanned_height, endpoint_url = EXCLUDED.endpoint_url, ` +
+		`blinding_keys = EXCLUDED.blinding_keys, master_blinding_key = EXCLUDED.master_blinding_key, ` +
+		`confirmation_depth = EXCLUDED.confirmation_depth, asset_id = EXCLUDED.asset_id;`
+
+	if _, err := s.db.Db.NamedExecContext(ctx, query, &sub); err != nil {
+		return err
+	}
+
+	for _, v := range subscription.LastUsedIndexes {
+		if err := s.UpdateLastUsedIndex(ctx, subscription.ID, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *subscriptionRepositoryImpl) GetSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+) (*domain.Subscription, error) {
+	query := `select * from subscription where id=$1;`
+
+	sub := &Subscription{}
+	if err := s.db.Db.GetContext(ctx, sub, query, id); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, domain.ErrSubscriptionNotFound
+		}
+
+		return nil, err
+	}
+
+	indexes := []SubscriptionUsedIndex{}
+	if err := s.db.Db.SelectContext(
+		ctx, &indexes, `select * from subscription_used_index where subscription_id=$1;`, id,
+	); err != nil {
+		return nil, err
+	}
+
+	return sub.toDomain(indexes), nil
+}
+
+func (s *subscriptionRepositoryImpl) GetAllSubscriptions(
+	ctx context.Context,
+) ([]*domain.Subscription, error) {
+	query := `select * from subscription;`
+
+	subs := []*Subscription{}
+	if err := s.db.Db.SelectContext(ctx, &subs, query); err != nil {
+		return nil, err
+	}
+
+	indexes := []SubscriptionUsedIndex{}
+	if err := s.db.Db.SelectContext(
+		ctx, &indexes, `select * from subscription_used_index;`,
+	); err != nil {
+		return nil, err
+	}
+
+	indexesByID := make(map[uuid.UUID][]SubscriptionUsedIndex)
+	for _, v := range indexes {
+		indexesByID[v.SubscriptionID] = append(indexesByID[v.SubscriptionID], v)
+	}
+
+	subscriptions := make([]*domain.Subscription, 0, len(subs))
+	for _, v := range subs {
+		subscriptions = append(subscriptions, v.toDomain(indexesByID[v.ID]))
+	}
+
+	return subscriptions, nil
+}
+
+func (s *subscriptionRepositoryImpl) UpdateLastScannedHeight(
+	ctx context.Context,
+	id uuid.UUID,
+	height uint32,
+) error {
+	query := `UPDATE subscription SET last_scanned_height=$1 WHERE id=$2;`
+
+	res, err := s.db.Db.ExecContext(ctx, query, height, id)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, domain.ErrSubscriptionNotFound)
+}
+
+func (s *subscriptionRepositoryImpl) UpdateLastUsedIndex(
+	ctx context.Context,
+	id uuid.UUID,
+	used scanner.ScriptDerivation,
+) error {
+	query := `INSERT INTO subscription_used_index (subscription_id, descriptor, branch, last_index) ` +
+		`SELECT id, $2, $3, $4 FROM subscription WHERE id=$1 ` +
+		`ON CONFLICT (subscription_id, descriptor, branch) DO UPDATE SET ` +
+		`last_index = GREATEST(subscription_used_index.last_index, EXCLUDED.last_index);`
+
+	res, err := s.db.Db.ExecContext(ctx, query, id, used.Descriptor, used.Branch, used.Index)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, domain.ErrSubscriptionNotFound)
+}
+
+func (s *subscriptionRepositoryImpl) DeleteSubscription(
+	ctx context.Context,
+	id uuid.UUID,
+) error {
+	query := `DELETE FROM subscription WHERE id=$1;`
+
+	res, err := s.db.Db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return checkRowsAffected(res, domain.ErrSubscriptionNotFound)
+}
+
+func (s *Subscription) toDomain(usedIndexes []SubscriptionUsedIndex) *domain.Subscription {
+	eventTypes := make([]scanner.EventType, 0, len(s.EventTypes))
+	for _, v := range s.EventTypes {
+		eventTypes = append(eventTypes, scanner.EventType(v))
+	}
+
+	lastUsedIndexes := make([]scanner.ScriptDerivation, 0, len(usedIndexes))
+	for _, v := range usedIndexes {
+		lastUsedIndexes = append(lastUsedIndexes, scanner.ScriptDerivation{
+			Descriptor: v.Descriptor,
+			Branch:     v.Branch,
+			Index:      v.LastIndex,
+		})
+	}
+
+	return &domain.Subscription{
+		ID:                s.ID,
+		WalletDescriptors: s.WalletDescriptors,
+		EventTypes:        eventTypes,
+		StartBlockHeight:  s.StartBlockHeight,
+		LastScannedHeight: s.LastScannedHeight,
+		EndpointUrl:       s.EndpointUrl,
+		BlindingKeys:      s.BlindingKeys,
+		MasterBlindingKey: s.MasterBlindingKey,
+		ConfirmationDepth: s.ConfirmationDepth,
+		AssetID:           s.AssetID,
+		LastUsedIndexes:   lastUsedIndexes,
+	}
+}
+
+// checkRowsAffected returns notFoundErr if the statement didn't affect any row
+func checkRowsAffected(res sql.Result, notFoundErr error) error {
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return notFoundErr
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package dbpg
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+)
+
+type txHistoryRepositoryImpl struct {
+	db *DbService
+}
+
+func NewTxHistoryRepositoryImpl(db *DbService) (domain.TxHistoryRepository, error) {
+	return &txHistoryRepositoryImpl{
+		db: db,
+	}, nil
+}
+
+type TxHistoryEntry struct {
+	SubscriptionID uuid.UUID    `db:"subscription_id"`
+	TxID           string       `db:"tx_id"`
+	BlockHeight    uint32       `db:"block_height"`
+	TxIndex        uint32       `db:"tx_index"`
+	Direction      string       `db:"direction"`
+	Received       assetAmounts `db:"received"`
+	Sent           assetAmounts `db:"sent"`
+}
+
+// assetAmounts is stored as a jsonb object of amounts by asset
+type assetAmounts map[string]uint64
+
+func (a assetAmounts) Value() (driver.Value, error) {
+	if a == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(a)
+}
+
+func (a *assetAmounts) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		return fmt.Errorf("assetAmounts -> unexpected type %T", src)
+	}
+	return json.Unmarshal(b, a)
+}
+
+func (t *txHistoryRepositoryImpl) PutTx(
+	ctx context.Context,
+	entry *domain.TxHistoryEntry,
+) error {
+	row := TxHistoryEntry{
+		SubscriptionID: entry.SubscriptionID,
+		TxID:           entry.TxID,
+		BlockHeight:    entry.BlockHeight,
+		TxIndex:        entry.TxIndex,
+		Direction:      string(entry.Direction),
+		Received:       entry.Received,
+		Sent:           entry.Sent,
+	}
+
+	query := `INSERT INTO tx_history (subscription_id, tx_id, block_height, tx_index, direction, received, sent) ` +
+		`VALUES (:subscription_id, :tx_id, :block_height, :tx_index, :direction, :received, :sent) ` +
+		`ON CONFLICT (subscription_id, tx_id) DO UPDATE SET block_height = EXCLUDED.block_height, ` +
+		`tx_index = EXCLUDED.tx_index, direction = EXCLUDED.direction, ` +
+		`received = EXCLUDED.received, sent = EXCLUDED.sent;`
+
+	_, err := t.db.Db.NamedExecContext(ctx, query, &row)
+	return err
+}
+
+func (t *txHistoryRepositoryImpl) DeleteTx(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+	txID string,
+) error {
+	query := `DELETE FROM tx_history WHERE subscription_id=$1 AND tx_id=$2;`
+
+	_, err := t.db.Db.ExecContext(ctx, query, subscriptionID, txID)
+	return err
+}
+
+func (t *txHistoryRepositoryImpl) GetTxHistory(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+	filter domain.TxHistoryFilter,
+) ([]*domain.TxHistoryEntry, error) {
+	query := `select * from tx_history where subscription_id=$1 AND block_height >= $2`
+	args := []interface{}{subscriptionID, filter.FromHeight}
+
+	if filter.ToHeight > 0 {
+		args = append(args, filter.ToHeight)
+		query += fmt.Sprintf(` AND block_height <= $%d`, len(args))
+	}
+	if after := filter.After; after != nil {
+		args = append(args, after.BlockHeight, after.TxIndex)
+		query += fmt.Sprintf(` AND (block_height, tx_index) < ($%d, $%d)`, len(args)-1, len(args))
+	}
+
+	query += ` order by block_height desc, tx_index desc`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` limit $%d`, len(args))
+	}
+
+	rows := []*TxHistoryEntry{}
+	if err := t.db.Db.SelectContext(ctx, &rows, query+";", args...); err != nil {
+		return nil, err
+	}
+
+	entries := make([]*domain.TxHistoryEntry, 0, len(rows))
+	for _, v := range rows {
+		entries = append(entries, v.toDomain())
+	}
+
+	return entries, nil
+}
+
+func (t *txHistoryRepositoryImpl) DeleteTxHistory(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+) error {
+	query := `DELETE FROM tx_history WHERE subscription_id=$1;`
+
+	_, err := t.db.Db.ExecContext(ctx, query, subscriptionID)
+	return err
+}
+
+func (e *TxHistoryEntry) toDomain() *domain.TxHistoryEntry {
+	return &domain.TxHistoryEntry{
+		SubscriptionID: e.SubscriptionID,
+		TxID:           e.TxID,
+		BlockHeight:    e.BlockHeight,
+		TxIndex:        e.TxIndex,
+		Direction:      domain.TxDirection(e.Direction),
+		Received:       e.Received,
+		Sent:           e.Sent,
+	}
+}
@@ -0,0 +1,199 @@
+package dbpg
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+)
+
+type utxoRepositoryImpl struct {
+	db *DbService
+}
+
+func NewUtxoRepositoryImpl(db *DbService) (domain.UtxoRepository, error) {
+	return &utxoRepositoryImpl{
+		db: db,
+	}, nil
+}
+
+type Utxo struct {
+	SubscriptionID uuid.UUID `db:"subscription_id"`
+	TxID           string    `db:"tx_id"`
+	VOut           uint32    `db:"vout"`
+	Script         []byte    `db:"script"`
+	BlockHeight    uint32    `db:"block_height"`
+	Value          uint64    `db:"value"`
+	Asset          string    `db:"asset"`
+	Confidential   bool      `db:"confidential"`
+	SpentBy        string    `db:"spent_by"`
+}
+
+func (u *utxoRepositoryImpl) AddUtxos(
+	ctx context.Context,
+	utxos []*domain.Utxo,
+) error {
+	if len(utxos) == 0 {
+		return nil
+	}
+
+	rows := make([]Utxo, 0, len(utxos))
+	for _, v := range utxos {
+		rows = append(rows, Utxo{
+			SubscriptionID: v.SubscriptionID,
+			TxID:           v.TxID,
+			VOut:           v.VOut,
+			Script:         v.Script,
+			BlockHeight:    v.BlockHeight,
+			Value:          v.Value,
+			Asset:          v.Asset,
+			Confidential:   v.Confidential,
+			SpentBy:        v.SpentBy,
+		})
+	}
+
+	query := `INSERT INTO utxo (subscription_id, tx_id, vout, script, block_height, value, asset, confidential, spent_by) ` +
+		`VALUES (:subscription_id, :tx_id, :vout, :script, :block_height, :value, :asset, :confidential, :spent_by) ` +
+		`ON CONFLICT (subscription_id, tx_id, vout) DO NOTHING;`
+
+	_, err := u.db.Db.NamedExecContext(ctx, query, rows)
+	return err
+}
+
+func (u *utxoRepositoryImpl) SpendUtxos(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+	outpoints []domain.Outpoint,
+	spentBy string,
+) error {
+	tx, err := u.db.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	query := `UPDATE utxo SET spent_by=$1 WHERE subscription_id=$2 AND tx_id=$3 AND vout=$4;`
+	for _, v := range outpoints {
+		if _, err := tx.ExecContext(ctx, query, spentBy, subscriptionID, v.TxID, v.VOut); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (u *utxoRepositoryImpl) RevertTx(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+	txID string,
+) error {
+	tx, err := u.db.Db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM utxo WHERE subscription_id=$1 AND tx_id=$2;`,
+		subscriptionID, txID,
+	); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE utxo SET spent_by='' WHERE subscription_id=$1 AND spent_by=$2;`,
+		subscriptionID, txID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (u *utxoRepositoryImpl) GetUnspents(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+) ([]*domain.Utxo, error) {
+	query := `select * from utxo where subscription_id=$1 AND spent_by='' order by block_height, tx_id, vout;`
+
+	rows := []*Utxo{}
+	if err := u.db.Db.SelectContext(ctx, &rows, query, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	utxos := make([]*domain.Utxo, 0, len(rows))
+	for _, v := range rows {
+		utxos = append(utxos, v.toDomain())
+	}
+
+	return utxos, nil
+}
+
+func (u *utxoRepositoryImpl) GetTxUtxos(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+	txID string,
+) ([]*domain.Utxo, error) {
+	query := `select * from utxo where subscription_id=$1 AND (tx_id=$2 OR spent_by=$2) order by tx_id, vout;`
+
+	rows := []*Utxo{}
+	if err := u.db.Db.SelectContext(ctx, &rows, query, subscriptionID, txID); err != nil {
+		return nil, err
+	}
+
+	utxos := make([]*domain.Utxo, 0, len(rows))
+	for _, v := range rows {
+		utxos = append(utxos, v.toDomain())
+	}
+
+	return utxos, nil
+}
+
+func (u *utxoRepositoryImpl) GetBalance(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+) (map[string]uint64, error) {
+	query := `select asset, sum(value) as value from utxo ` +
+		`where subscription_id=$1 AND spent_by='' AND NOT confidential group by asset;`
+
+	rows := []struct {
+		Asset string `db:"asset"`
+		Value uint64 `db:"value"`
+	}{}
+	if err := u.db.Db.SelectContext(ctx, &rows, query, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	balance := make(map[string]uint64, len(rows))
+	for _, v := range rows {
+		balance[v.Asset] = v.Value
+	}
+
+	return balance, nil
+}
+
+func (u *utxoRepositoryImpl) DeleteUtxos(
+	ctx context.Context,
+	subscriptionID uuid.UUID,
+) error {
+	query := `DELETE FROM utxo WHERE subscription_id=$1;`
+
+	_, err := u.db.Db.ExecContext(ctx, query, subscriptionID)
+	return err
+}
+
+func (u *Utxo) toDomain() *domain.Utxo {
+	return &domain.Utxo{
+		SubscriptionID: u.SubscriptionID,
+		TxID:           u.TxID,
+		VOut:           u.VOut,
+		Script:         u.Script,
+		BlockHeight:    u.BlockHeight,
+		Value:          u.Value,
+		Asset:          u.Asset,
+		Confidential:   u.Confidential,
+		SpentBy:        u.SpentBy,
+	}
+}
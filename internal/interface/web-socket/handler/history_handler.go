@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/neutrino-elements/internal/core/application"
+	neutrinodtypes "github.com/vulpemventures/neutrino-elements/pkg/neutrinod-types"
+)
+
+// HandleTxHistoryRequest returns a page of the tx history of the subscription
+// in the path, the query parameters cursor, limit, fromHeight and toHeight
+// are optional
+func (d *descriptorWalletNotifierHandler) HandleTxHistoryRequest(
+	w http.ResponseWriter,
+	req *http.Request,
+) {
+	subsID, err := uuid.Parse(mux.Vars(req)["id"])
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	query, err := parseTxHistoryQuery(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := d.notificationSvc.TxHistory(application.SubscriberID(subsID), query)
+	if err != nil {
+		switch {
+		case errors.Is(err, application.ErrSubscriberNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, application.ErrInvalidCursor),
+			errors.Is(err, application.ErrInvalidHeightRange):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			log.Errorf("failed to get tx history of subscriber %v: %v", subsID, err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	resp := neutrinodtypes.TxHistoryResponse{
+		Txs:        make([]neutrinodtypes.TxHistoryEntry, 0, len(page.Txs)),
+		NextCursor: page.NextCursor,
+	}
+	for _, v := range page.Txs {
+		resp.Txs = append(resp.Txs, neutrinodtypes.TxHistoryEntry{
+			TxID:        v.TxID,
+			BlockHeight: v.BlockHeight,
+			TxIndex:     v.TxIndex,
+			Direction:   string(v.Direction),
+			Received:    v.Received,
+			Sent:        v.Sent,
+			NetAmounts:  v.NetAmounts(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	sendResponseToSubscriberHttp(w, resp)
+}
+
+func parseTxHistoryQuery(req *http.Request) (application.TxHistoryQuery, error) {
+	values := req.URL.Query()
+	query := application.TxHistoryQuery{
+		Cursor: values.Get("cursor"),
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil {
+			return query, errors.New("invalid limit")
+		}
+		query.Limit = limit
+	}
+
+	if v := values.Get("fromHeight"); v != "" {
+		height, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return query, errors.New("invalid fromHeight")
+		}
+		query.FromHeight = uint32(height)
+	}
+
+	if v := values.Get("toHeight"); v != "" {
+		height, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return query, errors.New("invalid toHeight")
+		}
+		query.ToHeight = uint32(height)
+	}
+
+	return query, nil
+}
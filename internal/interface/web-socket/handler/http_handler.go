@@ -21,19 +21,27 @@ func (d *descriptorWalletNotifierHandler) HandleSubscriptionRequestHttp(
 		return
 	}
 
-	subsID := uuid.New()
-	d.registerSubs <- &HttpSubscriber{
-		ID:          SubscriberID(subsID),
-		EndpointUrl: subscriptionReq.EndpointUrl,
-	}
-
 	switch subscriptionReq.ActionType {
 	case neutrinodtypes.Register:
+		descriptors, err := subscriptionReq.Descriptors()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		subsID := uuid.New()
 		if err := d.notificationSvc.Subscribe(application.Subscriber{
-			ID:               application.SubscriberID(subsID),
-			BlockHeight:      subscriptionReq.StartBlockHeight,
-			Events:           subscriptionReq.EventTypes,
-			WalletDescriptor: subscriptionReq.DescriptorWallet,
+			ID:                application.SubscriberID(subsID),
+			BlockHeight:       subscriptionReq.StartBlockHeight,
+			Events:            subscriptionReq.EventTypes,
+			WalletDescriptors: descriptors,
+			BirthdayTime:      birthdayTime(subscriptionReq.BirthdayTime),
+			StartBlockHash:    subscriptionReq.StartBlockHash,
+			BlindingKeys:      subscriptionReq.BlindingKeys,
+			MasterBlindingKey: subscriptionReq.MasterBlindingKey,
+			ConfirmationDepth: subscriptionReq.ConfirmationDepth,
+			AssetID:           subscriptionReq.AssetID,
+			EndpointUrl:       subscriptionReq.EndpointUrl,
 		}); err != nil {
 			log.Errorf("unsucesfull registration: %v, subscriber: %v", err, subsID)
 
@@ -41,14 +49,28 @@ func (d *descriptorWalletNotifierHandler) HandleSubscriptionRequestHttp(
 				ErrorMessage: "un-successful registration",
 			}
 			sendResponseToSubscriberHttp(w, resp)
+			return
+		}
+
+		d.registerSubs <- &HttpSubscriber{
+			ID:          SubscriberID(subsID),
+			EndpointUrl: subscriptionReq.EndpointUrl,
 		}
 		log.Infof("sucesfull registration, subscriber: %v", subsID)
 
 		resp := neutrinodtypes.GeneralMessageResponse{
-			Message: "successful registration",
+			Message:        "successful registration",
+			SubscriptionID: subsID.String(),
 		}
 		sendResponseToSubscriberHttp(w, resp)
 	case neutrinodtypes.Unregister:
+		// the subscription to remove is the one returned at registration
+		subsID, err := uuid.Parse(subscriptionReq.SubscriptionID)
+		if err != nil {
+			http.Error(w, "invalid subscription id", http.StatusBadRequest)
+			return
+		}
+
 		if err := d.notificationSvc.UnSubscribe(application.Subscriber{
 			ID: application.SubscriberID(subsID),
 		}); err != nil {
@@ -58,9 +80,11 @@ func (d *descriptorWalletNotifierHandler) HandleSubscriptionRequestHttp(
 				ErrorMessage: "un-successful un-registration",
 			}
 			sendResponseToSubscriberHttp(w, resp)
+			return
 		}
+		d.deleteSubscriberSafe(SubscriberID(subsID))
 
-		log.Infof("sucesfull un-registration: %v, subscriber: %v", err, subsID)
+		log.Infof("sucesfull un-registration, subscriber: %v", subsID)
 
 		resp := neutrinodtypes.GeneralMessageResponse{
 			Message: "successful un-registration",
@@ -74,14 +98,13 @@ func (d *descriptorWalletNotifierHandler) HandleSubscriptionRequestHttp(
 		}
 		sendResponseToSubscriberHttp(w, resp)
 	}
-
-	log.Debugf("new ws subscriber connected: %v", subsID)
 }
 
 func sendResponseToSubscriberHttp[
 V neutrinodtypes.MessageErrorResponse |
 neutrinodtypes.OnChainEventResponse |
-neutrinodtypes.GeneralMessageResponse](
+neutrinodtypes.GeneralMessageResponse |
+neutrinodtypes.TxHistoryResponse](
 	w http.ResponseWriter,
 	resp V,
 ) {
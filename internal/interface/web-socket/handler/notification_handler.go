@@ -14,7 +14,7 @@ import (
 )
 
 const (
-	maxMessageSize = 512
+	maxMessageSize = 4096
 
 	wsType   SubscriberType = "ws"
 	httpType SubscriberType = "http"
@@ -48,6 +48,7 @@ type DescriptorWalletNotifierHandler interface {
 	Stop()
 	HandleSubscriptionRequestWs(w http.ResponseWriter, req *http.Request)
 	HandleSubscriptionRequestHttp(w http.ResponseWriter, req *http.Request)
+	HandleTxHistoryRequest(w http.ResponseWriter, req *http.Request)
 }
 
 func NewDescriptorWalletNotifierHandler(
@@ -65,6 +66,17 @@ func NewDescriptorWalletNotifierHandler(
 }
 
 func (d *descriptorWalletNotifierHandler) Start() {
+	// webhooks restored by the notification service must be known in order
+	// to forward them the events
+	for _, v := range d.notificationSvc.Subscribers() {
+		if v.EndpointUrl != "" {
+			d.addSubscriberSafe(&HttpSubscriber{
+				ID:          SubscriberID(v.ID),
+				EndpointUrl: v.EndpointUrl,
+			})
+		}
+	}
+
 	go d.handleOnChainNotifications()
 	go d.handleSubscribers()
 }
@@ -111,6 +123,10 @@ func (d *descriptorWalletNotifierHandler) handleOnChainNotifications() {
 		select {
 		case eventReport := <-d.notificationSvc.EventReport():
 			subscriber := d.getSubscriberSafe(SubscriberID(eventReport.SubscriberID))
+			if subscriber == nil {
+				// the subscriber disconnected while the event was being reported
+				continue
+			}
 
 			eventType, err := neutrinodtypes.FromScannerEventTypeToNeutrinodType(eventReport.EventType)
 			if err != nil {
@@ -118,9 +134,26 @@ func (d *descriptorWalletNotifierHandler) handleOnChainNotifications() {
 				continue
 			}
 
+			var conflictTxID string
+			if eventReport.ConflictTxHash != nil {
+				conflictTxID = eventReport.ConflictTxHash.String()
+			}
+
 			response := neutrinodtypes.OnChainEventResponse{
-				EventType: eventType,
-				TxID:      eventReport.Transaction.TxHash().String(),
+				EventType:       eventType,
+				TxID:            eventReport.Transaction.TxHash().String(),
+				TxIndex:         eventReport.TxIndex,
+				Operation:       eventReport.Operation.String(),
+				Outputs:         neutrinodtypes.FromScannerOutputs(eventReport.Outputs),
+				Inputs:          neutrinodtypes.FromScannerInputs(eventReport.Inputs),
+				Pegins:          neutrinodtypes.FromScannerPegins(eventReport.Pegins),
+				Pegouts:         neutrinodtypes.FromScannerPegouts(eventReport.Pegouts),
+				Derivation:      neutrinodtypes.FromScannerDerivation(eventReport.Derivation),
+				Confirmations:   eventReport.Confirmations,
+				Reverted:        eventReport.Reverted,
+				Unconfirmed:     eventReport.Unconfirmed,
+				SeenUnconfirmed: eventReport.SeenUnconfirmed,
+				ConflictTxID:    conflictTxID,
 			}
 
 			switch subscriber.Type() {
@@ -159,6 +192,9 @@ func (d *descriptorWalletNotifierHandler) handleOnChainNotifications() {
 			)
 
 			subscriber := d.getSubscriberSafe(SubscriberID(errReport.SubscriberID))
+			if subscriber == nil {
+				continue
+			}
 
 			response := neutrinodtypes.MessageErrorResponse{
 				ErrorMessage: errReport.ErrorMsg.Error(),
@@ -1,6 +1,8 @@
 package handler
 
 import (
+	"time"
+
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
@@ -39,3 +41,12 @@ func (h *HttpSubscriber) Type() SubscriberType {
 func (h *HttpSubscriber) SubscriberID() SubscriberID {
 	return h.ID
 }
+
+// birthdayTime converts the unix time of a request, zero means not set
+func birthdayTime(unix int64) time.Time {
+	if unix <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(unix, 0)
+}
@@ -46,6 +46,14 @@ func (d *descriptorWalletNotifierHandler) handleRequest(conn *websocket.Conn) {
 
 	log.Debugf("new ws subscriber connected: %v", subsID)
 
+	// whatever the reason the connection is closed, the subscriber stops
+	// watching the chain
+	defer func() {
+		d.unregisterSubs <- &WsSubscriber{
+			ID: SubscriberID(subsID),
+		}
+	}()
+
 msgloop:
 	for {
 		_, message, err := conn.ReadMessage()
@@ -62,10 +70,6 @@ msgloop:
 				log.Warnf("Error reading message: %v\n", err)
 			}
 
-			d.unregisterSubs <- &WsSubscriber{
-				ID: SubscriberID(subsID),
-			}
-
 			return
 		}
 
@@ -101,11 +105,30 @@ msgloop:
 
 		switch wsMsg.ActionType {
 		case neutrinodtypes.Register:
+			descriptors, err := wsMsg.Descriptors()
+			if err != nil {
+				log.Errorf("unsucesfull registration: %v, subscriber: %v", err, subsID)
+
+				if err := sendResponseToSubscriberWs(*subscriber, neutrinodtypes.MessageErrorResponse{
+					ErrorMessage: err.Error(),
+				}); err != nil {
+					log.Errorf("failed sending response to subscriber: %v", err.Error())
+				}
+
+				goto msgloop
+			}
+
 			if err := d.notificationSvc.Subscribe(application.Subscriber{
-				ID:               application.SubscriberID(subsID),
-				BlockHeight:      wsMsg.StartBlockHeight,
-				Events:           events,
-				WalletDescriptor: wsMsg.DescriptorWallet,
+				ID:                application.SubscriberID(subsID),
+				BlockHeight:       wsMsg.StartBlockHeight,
+				Events:            events,
+				WalletDescriptors: descriptors,
+				BirthdayTime:      birthdayTime(wsMsg.BirthdayTime),
+				StartBlockHash:    wsMsg.StartBlockHash,
+				BlindingKeys:      wsMsg.BlindingKeys,
+				MasterBlindingKey: wsMsg.MasterBlindingKey,
+				ConfirmationDepth: wsMsg.ConfirmationDepth,
+				AssetID:           wsMsg.AssetID,
 			}); err != nil {
 				log.Errorf("unsucesfull registration: %v, subscriber: %v", err, subsID)
 
@@ -119,7 +142,8 @@ msgloop:
 			log.Infof("sucesfull registration, subscriber: %v", subsID)
 
 			if err := sendResponseToSubscriberWs(*subscriber, neutrinodtypes.GeneralMessageResponse{
-				Message: "successfully registered",
+				Message:        "successfully registered",
+				SubscriptionID: subsID.String(),
 			}); err != nil {
 				log.Errorf("failed sending response to subscriber: %v", err.Error())
 				goto msgloop
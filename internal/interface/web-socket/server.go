@@ -6,6 +6,7 @@ import (
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
 	"github.com/vulpemventures/neutrino-elements/internal/core/application"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
 	"github.com/vulpemventures/neutrino-elements/internal/interface/web-socket/handler"
 	"github.com/vulpemventures/neutrino-elements/internal/interface/web-socket/middleware"
 	"github.com/vulpemventures/neutrino-elements/pkg/blockservice"
@@ -21,18 +22,26 @@ const (
 )
 
 type NeutrinoServer struct {
-	nodeSvc       node.NodeService
-	nodeCfg       node.NodeConfig
-	blockSvc      blockservice.BlockService
-	peerUrl       string
-	serverAddress string
+	nodeSvc          node.NodeService
+	nodeCfg          node.NodeConfig
+	blockSvc         blockservice.BlockService
+	subscriptionRepo domain.SubscriptionRepository
+	utxoRepo         domain.UtxoRepository
+	txHistoryRepo    domain.TxHistoryRepository
+	peerUrl          string
+	serverAddress    string
+	scannerOpts      []scanner.ServiceOption
 }
 
 func NewElementsNeutrinoServer(
 	nodeCfg node.NodeConfig,
 	blockSvc blockservice.BlockService,
+	subscriptionRepo domain.SubscriptionRepository,
+	utxoRepo domain.UtxoRepository,
+	txHistoryRepo domain.TxHistoryRepository,
 	peerUrl string,
 	serverAddress string,
+	scannerOpts ...scanner.ServiceOption,
 ) (*NeutrinoServer, error) {
 	nodeSvc, err := node.New(nodeCfg)
 	if err != nil {
@@ -40,11 +49,15 @@ func NewElementsNeutrinoServer(
 	}
 
 	return &NeutrinoServer{
-		nodeSvc:       nodeSvc,
-		nodeCfg:       nodeCfg,
-		blockSvc:      blockSvc,
-		peerUrl:       peerUrl,
-		serverAddress: serverAddress,
+		nodeSvc:          nodeSvc,
+		nodeCfg:          nodeCfg,
+		blockSvc:         blockSvc,
+		subscriptionRepo: subscriptionRepo,
+		utxoRepo:         utxoRepo,
+		txHistoryRepo:    txHistoryRepo,
+		peerUrl:          peerUrl,
+		serverAddress:    serverAddress,
+		scannerOpts:      scannerOpts,
 	}, nil
 }
 
@@ -63,14 +76,35 @@ func (n *NeutrinoServer) Start(ctx context.Context, stop context.CancelFunc) <-c
 		errC <- err
 	}
 
+	scannerOpts := append(
+		[]scanner.ServiceOption{
+			scanner.WithChainNotifier(n.nodeSvc),
+			scanner.WithMempoolNotifier(n.nodeSvc),
+		},
+		n.scannerOpts...,
+	)
+	// with lazy filters the node syncs headers only, the filters are fetched
+	// from the peer when scanned. Otherwise the pruned filters are not
+	// fetched again and the subscriptions behind the pruned height are
+	// rejected with ErrPruned
+	if n.nodeCfg.LazyFilters {
+		scannerOpts = append(scannerOpts, scanner.WithFilterFetcher(n.nodeSvc))
+	}
+
 	scannerSvc := scanner.New(
 		n.nodeCfg.FiltersDB,
 		n.nodeCfg.BlockHeadersDB,
 		n.blockSvc,
 		genesisBlockHash,
+		scannerOpts...,
 	)
 
-	notificationSvc := application.NewNotificationService(scannerSvc)
+	notificationSvc := application.NewNotificationService(
+		scannerSvc,
+		n.subscriptionRepo,
+		n.utxoRepo,
+		n.txHistoryRepo,
+	)
 
 	if err := notificationSvc.Start(); err != nil {
 		errC <- err
@@ -98,6 +132,12 @@ func (n *NeutrinoServer) Start(ctx context.Context, stop context.CancelFunc) <-c
 			descriptorWalletNotifierSvc.HandleSubscriptionRequestHttp, middlewares...),
 	)
 
+	muxRouter.HandleFunc(
+		"/neutrino/subscriptions/{id}/history",
+		middlewareSvc.WrapHandlerWithMiddlewares(
+			descriptorWalletNotifierSvc.HandleTxHistoryRequest, middlewares...),
+	).Methods(http.MethodGet)
+
 	httpServer := &http.Server{
 		Addr:    n.serverAddress,
 		Handler: muxRouter,
@@ -0,0 +1,255 @@
+package consistency
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+const (
+	// MissingHeader means there is no header at the given height (gap)
+	MissingHeader ProblemType = iota
+	// BrokenLinkage means the header does not link to the previous one
+	BrokenLinkage
+	// MissingFilter means the filter of the header is not stored
+	MissingFilter
+	// OrphanFilter means the filter does not belong to any known header
+	OrphanFilter
+)
+
+type ProblemType int
+
+func (p ProblemType) String() string {
+	switch p {
+	case MissingHeader:
+		return "missing header"
+	case BrokenLinkage:
+		return "broken linkage"
+	case MissingFilter:
+		return "missing filter"
+	case OrphanFilter:
+		return "orphan filter"
+	default:
+		return "unknown"
+	}
+}
+
+// Problem is an inconsistency found in the repositories.
+type Problem struct {
+	Type ProblemType
+	// Height is not set for orphan filters
+	Height uint32
+	// BlockHash is set for broken linkages and missing filters only
+	BlockHash *chainhash.Hash
+	// FilterKey is set for orphan filters only
+	FilterKey string
+}
+
+func (p Problem) String() string {
+	switch p.Type {
+	case OrphanFilter:
+		return fmt.Sprintf("%v: key %v", p.Type, p.FilterKey)
+	case MissingHeader:
+		return fmt.Sprintf("%v: height %v", p.Type, p.Height)
+	default:
+		return fmt.Sprintf("%v: height %v, block %v", p.Type, p.Height, p.BlockHash)
+	}
+}
+
+// Report is the result of the verification of the repositories.
+type Report struct {
+	TipHeight uint32
+	Problems  []Problem
+}
+
+func (r *Report) IsConsistent() bool {
+	return len(r.Problems) == 0
+}
+
+// firstBrokenHeight returns the lowest height from which the header chain
+// can't be trusted anymore
+func (r *Report) firstBrokenHeight() (uint32, bool) {
+	for _, p := range r.Problems {
+		// problems are sorted by height (orphan filters come last)
+		if p.Type == MissingHeader || p.Type == BrokenLinkage {
+			return p.Height, true
+		}
+	}
+
+	return 0, false
+}
+
+// FilterFetcher downloads the filters of the given blocks and stores them
+// in the filters repository.
+type FilterFetcher interface {
+	RequestFilters(blockHashes ...chainhash.Hash) error
+}
+
+// Verify walks the header chain, from the genesis up to the tip, checking the
+// linkage and contiguity of the headers and that every header has a filter.
+// It also reports the filters that don't belong to any header.
+// Filters pruned by the retention policy are not reported as missing.
+func Verify(
+	ctx context.Context,
+	headerDB repository.BlockHeaderRepository,
+	filterDB repository.FilterRepository,
+	genesisHash *chainhash.Hash,
+) (*Report, error) {
+	report := &Report{Problems: make([]Problem, 0)}
+
+	knownFilterKeys := map[string]struct{}{
+		filterKey(genesisHash).String(): {},
+	}
+
+	// filters pruned by the retention policy are not expected to be stored
+	prunedHeight, err := filterDB.GetPrunedHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := headerDB.ChainTip(ctx)
+	if err != nil && err != repository.ErrNoBlocksHeaders {
+		return nil, err
+	}
+
+	if tip != nil {
+		report.TipHeight = tip.Height
+		prevHash := genesisHash
+
+		for height := uint32(1); height <= tip.Height; height++ {
+			hash, err := headerDB.GetBlockHashByHeight(ctx, height)
+			if err != nil {
+				if err != repository.ErrBlockNotFound && err != repository.ErrNoBlocksHeaders {
+					return nil, err
+				}
+
+				report.Problems = append(report.Problems, Problem{
+					Type:   MissingHeader,
+					Height: height,
+				})
+				// linkage of the next header can't be checked
+				prevHash = nil
+				continue
+			}
+
+			header, err := headerDB.GetBlockHeader(ctx, *hash)
+			if err != nil {
+				return nil, err
+			}
+
+			if prevHash != nil && !bytes.Equal(header.PrevBlockHash, prevHash.CloneBytes()) {
+				report.Problems = append(report.Problems, Problem{
+					Type:      BrokenLinkage,
+					Height:    height,
+					BlockHash: hash,
+				})
+			}
+			prevHash = hash
+
+			key := filterKey(hash)
+			knownFilterKeys[key.String()] = struct{}{}
+
+			if height <= prunedHeight {
+				continue
+			}
+
+			if _, err := filterDB.GetFilter(ctx, key); err != nil {
+				if err != repository.ErrFilterNotFound {
+					return nil, err
+				}
+
+				report.Problems = append(report.Problems, Problem{
+					Type:      MissingFilter,
+					Height:    height,
+					BlockHash: hash,
+				})
+			}
+		}
+	}
+
+	keys, err := filterDB.GetFilterKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if _, ok := knownFilterKeys[k]; !ok {
+			report.Problems = append(report.Problems, Problem{
+				Type:      OrphanFilter,
+				FilterKey: k,
+			})
+		}
+	}
+
+	return report, nil
+}
+
+// Repair fixes the problems of the report:
+//   - headers from the first gap or broken linkage are deleted together with
+//     their filters, the node will sync them again
+//   - orphan filters are deleted
+//   - missing filters are requested to the fetcher, if not nil
+func Repair(
+	ctx context.Context,
+	headerDB repository.BlockHeaderRepository,
+	filterDB repository.FilterRepository,
+	report *Report,
+	fetcher FilterFetcher,
+) error {
+	keysToDelete := make([]string, 0)
+	missingFilters := make([]chainhash.Hash, 0)
+
+	brokenHeight, isBroken := report.firstBrokenHeight()
+	if isBroken {
+		for height := brokenHeight; height <= report.TipHeight; height++ {
+			hash, err := headerDB.GetBlockHashByHeight(ctx, height)
+			if err != nil {
+				continue
+			}
+			keysToDelete = append(keysToDelete, filterKey(hash).String())
+		}
+
+		log.Infof("consistency: deleting headers from height %v", brokenHeight)
+		if err := headerDB.DeleteHeadersFromHeight(ctx, brokenHeight); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range report.Problems {
+		switch p.Type {
+		case OrphanFilter:
+			keysToDelete = append(keysToDelete, p.FilterKey)
+		case MissingFilter:
+			if !isBroken || p.Height < brokenHeight {
+				missingFilters = append(missingFilters, *p.BlockHash)
+			}
+		}
+	}
+
+	if len(keysToDelete) > 0 {
+		log.Infof("consistency: deleting %v filters", len(keysToDelete))
+		if err := filterDB.DeleteFilters(ctx, keysToDelete...); err != nil {
+			return err
+		}
+	}
+
+	if len(missingFilters) > 0 && fetcher != nil {
+		log.Infof("consistency: requesting %v missing filters", len(missingFilters))
+		if err := fetcher.RequestFilters(missingFilters...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func filterKey(hash *chainhash.Hash) repository.FilterKey {
+	return repository.FilterKey{
+		BlockHash:  hash.CloneBytes(),
+		FilterType: repository.RegularFilter,
+	}
+}
@@ -0,0 +1,177 @@
+package consistency_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/inmemory"
+	"github.com/vulpemventures/neutrino-elements/pkg/consistency"
+	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+var (
+	ctx = context.Background()
+
+	// regtest headers from height 1 to 5
+	regtestHeaders = []string{
+		"000000b021cab1e5da4718ea140d9716931702422f0e6ad915c8d9b583cac2706b2a9000ac20a615d9b0d4df3e3ac2cb7018a07bd314d6bb715a57adead7c03e208b3658c192d56201000000022200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a00000017a91472c44f957fc011d97e3406667dca5b1c930c4026870151014202fcba7ecf41bc7e1be4ee122d9d22e3333671eb0a3a87b5cdf099d59874e1940f02fcba7ecf41bc7e1be4ee122d9d22e3333671eb0a3a87b5cdf099d59874e1940f00010151",
+		"000000b00cbe7961ae265e4ff0a23ee6e73b6dcea894919747542cad9a1ec9f584fe555ecebbf12fff089fc6aca1e9f1c8e0dbfd00c001a8eeec2ab7b14d405c6ec4c091c552da6202000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+		"000000a0f51d387048f065d5b6a284f90d5c795deb55f913a83e6c17dcada6854c1e6e9d09ae9d6bdae43a2c6188ea6af1097980d7810fe0f95198fe3f22c7c35df0bdcdc552da6203000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+		"000000a009ac04fc51e004185689547548f45cf7780d323ff2e44c215db474c09729729629e7595e1920771b14a5065bf55a364dd07469d1f09b6b433372183b3ab1d5f8c652da6204000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+		"000000a0a3cbd75af5a7d40788c985ddbb56ac09b33126857359ff454ec872571b93edfeea5886799f0eebf85b795d6e75fe65bbbb8766e77f53acf6d20be1268672323dc652da6205000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+	}
+)
+
+type fetcherMock struct {
+	requested []chainhash.Hash
+}
+
+func (f *fetcherMock) RequestFilters(blockHashes ...chainhash.Hash) error {
+	f.requested = append(f.requested, blockHashes...)
+	return nil
+}
+
+func TestVerifyConsistent(t *testing.T) {
+	headers := decodeHeaders(t)
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	require.NoError(t, headerDB.WriteHeaders(ctx, headers...))
+	for _, header := range headers {
+		putFilter(t, filterDB, blockHash(t, header))
+	}
+
+	report, err := consistency.Verify(ctx, headerDB, filterDB, genesisHash(t))
+	require.NoError(t, err)
+	require.True(t, report.IsConsistent())
+	require.Equal(t, uint32(5), report.TipHeight)
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+	headers := decodeHeaders(t)
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	// header at height 3 is missing
+	require.NoError(t, headerDB.WriteHeaders(ctx, headers[0], headers[1], headers[3], headers[4]))
+	// filters at height 2 and 5 are missing, the one at height 3 is orphan
+	for _, i := range []int{0, 2, 3} {
+		putFilter(t, filterDB, blockHash(t, headers[i]))
+	}
+	// filter of an unknown block
+	putFilter(t, filterDB, &chainhash.Hash{0x01})
+
+	report, err := consistency.Verify(ctx, headerDB, filterDB, genesisHash(t))
+	require.NoError(t, err)
+	require.False(t, report.IsConsistent())
+	require.Equal(t, uint32(5), report.TipHeight)
+
+	problems := make(map[consistency.ProblemType][]consistency.Problem)
+	for _, p := range report.Problems {
+		problems[p.Type] = append(problems[p.Type], p)
+	}
+
+	require.Len(t, problems[consistency.MissingHeader], 1)
+	require.Equal(t, uint32(3), problems[consistency.MissingHeader][0].Height)
+	require.Len(t, problems[consistency.MissingFilter], 2)
+	require.Equal(t, uint32(2), problems[consistency.MissingFilter][0].Height)
+	require.Equal(t, uint32(5), problems[consistency.MissingFilter][1].Height)
+	require.Len(t, problems[consistency.OrphanFilter], 2)
+	require.Len(t, problems[consistency.BrokenLinkage], 0)
+
+	fetcher := &fetcherMock{}
+	require.NoError(t, consistency.Repair(ctx, headerDB, filterDB, report, fetcher))
+
+	// headers from the gap are deleted, only the filter below it is requested
+	require.Len(t, fetcher.requested, 1)
+	require.Equal(t, *blockHash(t, headers[1]), fetcher.requested[0])
+
+	tip, err := headerDB.ChainTip(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(2), tip.Height)
+
+	keys, err := filterDB.GetFilterKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+
+	report, err = consistency.Verify(ctx, headerDB, filterDB, genesisHash(t))
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 1)
+	require.Equal(t, consistency.MissingFilter, report.Problems[0].Type)
+}
+
+func TestVerifyBrokenLinkage(t *testing.T) {
+	headers := decodeHeaders(t)
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	// header at height 3 does not link to header at height 2
+	headers[2].PrevBlockHash = make([]byte, 32)
+	require.NoError(t, headerDB.WriteHeaders(ctx, headers...))
+	for _, header := range headers {
+		putFilter(t, filterDB, blockHash(t, header))
+	}
+
+	report, err := consistency.Verify(ctx, headerDB, filterDB, genesisHash(t))
+	require.NoError(t, err)
+	require.Len(t, report.Problems, 2)
+	require.Equal(t, consistency.BrokenLinkage, report.Problems[0].Type)
+	require.Equal(t, uint32(3), report.Problems[0].Height)
+	// header 4 links to the original header 3, not the tampered one
+	require.Equal(t, consistency.BrokenLinkage, report.Problems[1].Type)
+	require.Equal(t, uint32(4), report.Problems[1].Height)
+
+	require.NoError(t, consistency.Repair(ctx, headerDB, filterDB, report, nil))
+
+	report, err = consistency.Verify(ctx, headerDB, filterDB, genesisHash(t))
+	require.NoError(t, err)
+	require.True(t, report.IsConsistent())
+	require.Equal(t, uint32(2), report.TipHeight)
+}
+
+func decodeHeaders(t *testing.T) []block.Header {
+	headers := make([]block.Header, 0, len(regtestHeaders))
+	for _, v := range regtestHeaders {
+		b, err := hex.DecodeString(v)
+		require.NoError(t, err)
+
+		header, err := block.DeserializeHeader(bytes.NewBuffer(b))
+		require.NoError(t, err)
+
+		headers = append(headers, *header)
+	}
+
+	return headers
+}
+
+func genesisHash(t *testing.T) *chainhash.Hash {
+	hash, err := chainhash.NewHashFromStr(protocol.GetCheckpoints(protocol.MagicRegtest)[0])
+	require.NoError(t, err)
+	return hash
+}
+
+func blockHash(t *testing.T, header block.Header) *chainhash.Hash {
+	hash, err := header.Hash()
+	require.NoError(t, err)
+	return &hash
+}
+
+func putFilter(t *testing.T, filterDB repository.FilterRepository, hash *chainhash.Hash) {
+	var key [gcs.KeySize]byte
+	filter, err := gcs.BuildGCSFilter(19, 784931, key, [][]byte{hash.CloneBytes()})
+	require.NoError(t, err)
+
+	entry, err := repository.NewFilterEntry(repository.FilterKey{
+		BlockHash:  hash.CloneBytes(),
+		FilterType: repository.RegularFilter,
+	}, filter)
+	require.NoError(t, err)
+	require.NoError(t, filterDB.PutFilter(ctx, entry))
+}
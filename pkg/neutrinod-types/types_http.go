@@ -6,6 +6,60 @@ type SubscriptionRequestHttp struct {
 	ActionType       ActionType          `json:"actionType"`
 	EventTypes       []scanner.EventType `json:"eventTypes"`
 	DescriptorWallet string              `json:"descriptorWallet"`
-	StartBlockHeight int                 `json:"startBlockHeight"`
-	EndpointUrl      string              `json:"endpointUrl"`
+	// DescriptorWallets allows to watch several descriptors (eg. receive and
+	// change branches) with the same subscription
+	DescriptorWallets []string `json:"descriptorWallets,omitempty"`
+	// ExtendedKeys and Addresses are watched in place of, or together with,
+	// the descriptors: the receive and change branches of the extended keys
+	// are derived with the same gap limit as range descriptors
+	ExtendedKeys     []ExtendedKey `json:"extendedKeys,omitempty"`
+	Addresses        []string      `json:"addresses,omitempty"`
+	StartBlockHeight int           `json:"startBlockHeight"`
+	EndpointUrl      string        `json:"endpointUrl"`
+	// SubscriptionID is the one returned at registration, it selects the
+	// subscription to unregister
+	SubscriptionID string `json:"subscriptionId,omitempty"`
+	// BirthdayTime (unix seconds) or StartBlockHash can be used in place of
+	// StartBlockHeight, the scan starts from the block they resolve to
+	BirthdayTime   int64  `json:"birthdayTime,omitempty"`
+	StartBlockHash string `json:"startBlockHash,omitempty"`
+	// BlindingKeys and MasterBlindingKey (SLIP-77), hex encoded, are used to
+	// unblind the outputs of the subscription
+	BlindingKeys      []string `json:"blindingKeys,omitempty"`
+	MasterBlindingKey string   `json:"masterBlindingKey,omitempty"`
+	// ConfirmationDepth if greater than 1, the events are sent again for every
+	// new confirmation of their block up to the depth, or as reverted if the
+	// block is disconnected
+	ConfirmationDepth uint32 `json:"confirmationDepth,omitempty"`
+	// AssetID (hex) is the asset whose outputs are sent as assetUtxo events,
+	// it is required by those
+	AssetID string `json:"assetId,omitempty"`
+}
+
+// Descriptors returns all the descriptors of the request, the extended keys
+// and addresses are converted to descriptors
+func (r SubscriptionRequestHttp) Descriptors() ([]string, error) {
+	return descriptors(r.DescriptorWallet, r.DescriptorWallets, r.ExtendedKeys, r.Addresses)
+}
+
+// TxHistoryResponse is a page of the tx history of a subscription, from the
+// most recent transaction. NextCursor, if set, is the cursor query parameter
+// of the next page.
+type TxHistoryResponse struct {
+	Txs        []TxHistoryEntry `json:"txs"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// TxHistoryEntry is a confirmed transaction touching the subscription
+// scripts, direction is incoming or outgoing. The amounts by asset are those
+// of the explicit or unblinded outputs received and utxos sent, netAmounts
+// is the difference.
+type TxHistoryEntry struct {
+	TxID        string            `json:"txId"`
+	BlockHeight uint32            `json:"blockHeight"`
+	TxIndex     uint32            `json:"txIndex"`
+	Direction   string            `json:"direction"`
+	Received    map[string]uint64 `json:"received"`
+	Sent        map[string]uint64 `json:"sent"`
+	NetAmounts  map[string]int64  `json:"netAmounts"`
 }
@@ -1,7 +1,9 @@
 package neutrinodtypes
 
 import (
+	"encoding/hex"
 	"errors"
+	"github.com/vulpemventures/go-elements/elementsutil"
 	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
 )
 
@@ -15,6 +17,16 @@ const (
 
 	UnspentUtxo EventType = "unspentUtxo"
 	SpentUtxo   EventType = "spentUtxo"
+	Issuance    EventType = "issuance"
+	Reissuance  EventType = "reissuance"
+	// AssetUtxo is sent for the outputs of the subscription asset (see
+	// AssetID) paying to the watched scripts
+	AssetUtxo EventType = "assetUtxo"
+	Pegin     EventType = "pegin"
+	Pegout    EventType = "pegout"
+	// Conflict is only sent, to the subscribers of utxo events, if a
+	// transaction double-spends a watched outpoint (see ConflictTxID)
+	Conflict EventType = "conflict"
 )
 
 type EventType string
@@ -25,16 +37,255 @@ type SubscriptionRequestWs struct {
 	ActionType       ActionType  `json:"actionType"`
 	EventTypes       []EventType `json:"eventTypes"`
 	DescriptorWallet string      `json:"descriptorWallet"`
-	StartBlockHeight int         `json:"startBlockHeight"`
+	// DescriptorWallets allows to watch several descriptors (eg. receive and
+	// change branches) with the same subscription
+	DescriptorWallets []string `json:"descriptorWallets,omitempty"`
+	// ExtendedKeys and Addresses are watched in place of, or together with,
+	// the descriptors: the receive and change branches of the extended keys
+	// are derived with the same gap limit as range descriptors
+	ExtendedKeys     []ExtendedKey `json:"extendedKeys,omitempty"`
+	Addresses        []string      `json:"addresses,omitempty"`
+	StartBlockHeight int           `json:"startBlockHeight"`
+	// BirthdayTime (unix seconds) or StartBlockHash can be used in place of
+	// StartBlockHeight, the scan starts from the block they resolve to
+	BirthdayTime   int64  `json:"birthdayTime,omitempty"`
+	StartBlockHash string `json:"startBlockHash,omitempty"`
+	// BlindingKeys and MasterBlindingKey (SLIP-77), hex encoded, are used to
+	// unblind the outputs of the subscription
+	BlindingKeys      []string `json:"blindingKeys,omitempty"`
+	MasterBlindingKey string   `json:"masterBlindingKey,omitempty"`
+	// ConfirmationDepth if greater than 1, the events are sent again for every
+	// new confirmation of their block up to the depth, or as reverted if the
+	// block is disconnected
+	ConfirmationDepth uint32 `json:"confirmationDepth,omitempty"`
+	// AssetID (hex) is the asset whose outputs are sent as assetUtxo events,
+	// it is required by those
+	AssetID string `json:"assetId,omitempty"`
+}
+
+// Descriptors returns all the descriptors of the request, the extended keys
+// and addresses are converted to descriptors
+func (r SubscriptionRequestWs) Descriptors() ([]string, error) {
+	return descriptors(r.DescriptorWallet, r.DescriptorWallets, r.ExtendedKeys, r.Addresses)
+}
+
+// ExtendedKey is an extended public key, scriptType is one of p2wpkh (the
+// default), p2sh-p2wpkh and p2pkh
+type ExtendedKey struct {
+	Key        string `json:"key"`
+	ScriptType string `json:"scriptType,omitempty"`
 }
 
 type OnChainEventResponse struct {
 	EventType EventType `json:"eventType"`
 	TxID      string    `json:"txId"`
+	// TxIndex is the position of the transaction in the block
+	TxIndex uint32 `json:"txIndex"`
+	// Operation is one of transfer, issuance, reissuance and burn
+	Operation string `json:"operation,omitempty"`
+	// Outputs and Inputs are the ones of the transaction the event is about
+	Outputs []MatchedOutput `json:"outputs,omitempty"`
+	Inputs  []MatchedInput  `json:"inputs,omitempty"`
+	// Pegins and Pegouts are the peg-in inputs and peg-out outputs of the
+	// transaction, if any
+	Pegins  []PeginInput   `json:"pegins,omitempty"`
+	Pegouts []PegoutOutput `json:"pegouts,omitempty"`
+	// Confirmations is the number of confirmations of the block of the event,
+	// set if the subscription tracks them (see ConfirmationDepth). Reverted is
+	// set if the block has been disconnected, the event is not valid anymore.
+	Confirmations uint32 `json:"confirmations,omitempty"`
+	Reverted      bool   `json:"reverted,omitempty"`
+	// Unconfirmed is set if the transaction is in the mempool, once confirmed
+	// the event is sent again with SeenUnconfirmed set
+	Unconfirmed     bool `json:"unconfirmed,omitempty"`
+	SeenUnconfirmed bool `json:"seenUnconfirmed,omitempty"`
+	// ConflictTxID is set for conflict events: the transaction TxID spends
+	// the same watched outpoints (Inputs) as this other transaction
+	ConflictTxID string `json:"conflictTxId,omitempty"`
+	// Derivation is set if the event is related to a descriptor script
+	Derivation *ScriptDerivation `json:"derivation,omitempty"`
+}
+
+// MatchedOutput is a transaction output paying to a watched script, value and
+// asset are set if explicit or unblinded, the commitments otherwise
+type MatchedOutput struct {
+	Index           uint32 `json:"index"`
+	Script          string `json:"script"`
+	Value           uint64 `json:"value,omitempty"`
+	Asset           string `json:"asset,omitempty"`
+	ValueCommitment string `json:"valueCommitment,omitempty"`
+	AssetCommitment string `json:"assetCommitment,omitempty"`
+	// ValueBlinder and AssetBlinder are set if the output has been unblinded
+	ValueBlinder string `json:"valueBlinder,omitempty"`
+	AssetBlinder string `json:"assetBlinder,omitempty"`
+}
+
+// MatchedInput is a transaction input spending a watched outpoint
+type MatchedInput struct {
+	Index        uint32 `json:"index"`
+	PrevoutTxID  string `json:"prevoutTxId"`
+	PrevoutIndex uint32 `json:"prevoutIndex"`
+	// Issuance is set if the input (re)issues an asset
+	Issuance *MatchedIssuance `json:"issuance,omitempty"`
+}
+
+// MatchedIssuance is the issuance of an input, amounts are set if explicit
+type MatchedIssuance struct {
+	IsReissuance bool   `json:"isReissuance"`
+	AssetID      string `json:"assetId"`
+	TokenID      string `json:"tokenId,omitempty"`
+	AssetAmount  uint64 `json:"assetAmount,omitempty"`
+	TokenAmount  uint64 `json:"tokenAmount,omitempty"`
+}
+
+// PeginInput is an input claiming funds pegged in from the mainchain output
+type PeginInput struct {
+	Index         uint32 `json:"index"`
+	MainchainTxID string `json:"mainchainTxId"`
+	MainchainVout uint32 `json:"mainchainVout"`
+	Amount        uint64 `json:"amount"`
+	Asset         string `json:"asset,omitempty"`
+	ClaimScript   string `json:"claimScript,omitempty"`
+}
+
+// PegoutOutput is an output pegging out funds to the mainchain script, value
+// and asset are set if explicit
+type PegoutOutput struct {
+	Index           uint32 `json:"index"`
+	GenesisHash     string `json:"genesisHash"`
+	MainchainScript string `json:"mainchainScript"`
+	Value           uint64 `json:"value,omitempty"`
+	Asset           string `json:"asset,omitempty"`
+}
+
+func FromScannerOutputs(outputs []scanner.MatchedOutput) []MatchedOutput {
+	result := make([]MatchedOutput, 0, len(outputs))
+	for _, out := range outputs {
+		result = append(result, MatchedOutput{
+			Index:           out.Index,
+			Script:          hex.EncodeToString(out.Script),
+			Value:           out.Value,
+			Asset:           out.Asset,
+			ValueCommitment: hex.EncodeToString(out.ValueCommitment),
+			AssetCommitment: hex.EncodeToString(out.AssetCommitment),
+			ValueBlinder:    hex.EncodeToString(elementsutil.ReverseBytes(out.ValueBlindingFactor)),
+			AssetBlinder:    hex.EncodeToString(elementsutil.ReverseBytes(out.AssetBlindingFactor)),
+		})
+	}
+
+	return result
+}
+
+func FromScannerInputs(inputs []scanner.MatchedInput) []MatchedInput {
+	result := make([]MatchedInput, 0, len(inputs))
+	for _, in := range inputs {
+		input := MatchedInput{
+			Index:        in.Index,
+			PrevoutTxID:  in.PrevoutHash.String(),
+			PrevoutIndex: in.PrevoutIndex,
+		}
+		if iss := in.Issuance; iss != nil {
+			input.Issuance = &MatchedIssuance{
+				IsReissuance: iss.IsReissuance,
+				AssetID:      iss.AssetID,
+				TokenID:      iss.TokenID,
+				AssetAmount:  iss.AssetAmount,
+				TokenAmount:  iss.TokenAmount,
+			}
+		}
+
+		result = append(result, input)
+	}
+
+	return result
+}
+
+func FromScannerPegins(pegins []scanner.PeginInput) []PeginInput {
+	result := make([]PeginInput, 0, len(pegins))
+	for _, in := range pegins {
+		result = append(result, PeginInput{
+			Index:         in.Index,
+			MainchainTxID: in.MainchainTxID,
+			MainchainVout: in.MainchainVout,
+			Amount:        in.Amount,
+			Asset:         in.Asset,
+			ClaimScript:   hex.EncodeToString(in.ClaimScript),
+		})
+	}
+
+	return result
+}
+
+func FromScannerPegouts(pegouts []scanner.PegoutOutput) []PegoutOutput {
+	result := make([]PegoutOutput, 0, len(pegouts))
+	for _, out := range pegouts {
+		result = append(result, PegoutOutput{
+			Index:           out.Index,
+			GenesisHash:     out.GenesisHash,
+			MainchainScript: hex.EncodeToString(out.MainchainScript),
+			Value:           out.Value,
+			Asset:           out.Asset,
+		})
+	}
+
+	return result
+}
+
+// ScriptDerivation identifies the descriptor script an event is related to
+type ScriptDerivation struct {
+	Descriptor string `json:"descriptor"`
+	Branch     uint32 `json:"branch"`
+	Index      uint32 `json:"index"`
+}
+
+func FromScannerDerivation(derivation *scanner.ScriptDerivation) *ScriptDerivation {
+	if derivation == nil {
+		return nil
+	}
+
+	return &ScriptDerivation{
+		Descriptor: derivation.Descriptor,
+		Branch:     derivation.Branch,
+		Index:      derivation.Index,
+	}
+}
+
+func descriptors(
+	descriptor string,
+	others []string,
+	extendedKeys []ExtendedKey,
+	addresses []string,
+) ([]string, error) {
+	all := make([]string, 0, len(others)+len(extendedKeys)+len(addresses)+1)
+	if descriptor != "" {
+		all = append(all, descriptor)
+	}
+	all = append(all, others...)
+
+	for _, v := range extendedKeys {
+		desc, err := scanner.ExtendedKeyDescriptor(v.Key, scanner.ScriptType(v.ScriptType))
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, desc)
+	}
+
+	for _, v := range addresses {
+		desc, err := scanner.AddressDescriptor(v)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, desc)
+	}
+
+	return all, nil
 }
 
 type GeneralMessageResponse struct {
 	Message string `json:"message"`
+	// SubscriptionID is set at registration, it identifies the subscription
+	// in the queries (eg. its tx history)
+	SubscriptionID string `json:"subscriptionId,omitempty"`
 }
 
 type MessageErrorResponse struct {
@@ -47,6 +298,18 @@ func FromScannerEventTypeToNeutrinodType(eventType scanner.EventType) (EventType
 		return UnspentUtxo, nil
 	case scanner.SpentUtxo:
 		return SpentUtxo, nil
+	case scanner.Issuance:
+		return Issuance, nil
+	case scanner.Reissuance:
+		return Reissuance, nil
+	case scanner.AssetUtxo:
+		return AssetUtxo, nil
+	case scanner.Pegin:
+		return Pegin, nil
+	case scanner.Pegout:
+		return Pegout, nil
+	case scanner.Conflict:
+		return Conflict, nil
 	default:
 		return "", ErrInvalidEventType
 	}
@@ -58,6 +321,16 @@ func FromNeutrinodTypeToScannerEventType(eventType EventType) (scanner.EventType
 		return scanner.UnspentUtxo, nil
 	case SpentUtxo:
 		return scanner.SpentUtxo, nil
+	case Issuance:
+		return scanner.Issuance, nil
+	case Reissuance:
+		return scanner.Reissuance, nil
+	case AssetUtxo:
+		return scanner.AssetUtxo, nil
+	case Pegin:
+		return scanner.Pegin, nil
+	case Pegout:
+		return scanner.Pegout, nil
 	default:
 		return 0, ErrInvalidEventType
 	}
@@ -0,0 +1,44 @@
+package node
+
+import "sync"
+
+// chainNotifier signals the subscribers that new block headers or filters
+// have been stored, signals not consumed yet are coalesced.
+type chainNotifier struct {
+	subscribers []chan struct{}
+	locker      *sync.Mutex
+}
+
+func newChainNotifier() *chainNotifier {
+	return &chainNotifier{
+		subscribers: make([]chan struct{}, 0),
+		locker:      new(sync.Mutex),
+	}
+}
+
+func (c *chainNotifier) subscribe() <-chan struct{} {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	ch := make(chan struct{}, 1)
+	c.subscribers = append(c.subscribers, ch)
+	return ch
+}
+
+func (c *chainNotifier) notify() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	for _, ch := range c.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// NotifyChainUpdates returns a channel receiving a signal every time new
+// block headers or filters are stored
+func (n *node) NotifyChainUpdates() <-chan struct{} {
+	return n.chainNotifier.subscribe()
+}
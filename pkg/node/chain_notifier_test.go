@@ -0,0 +1,35 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainNotifier(t *testing.T) {
+	notifier := newChainNotifier()
+	first := notifier.subscribe()
+	second := notifier.subscribe()
+
+	// signals not consumed yet are coalesced
+	notifier.notify()
+	notifier.notify()
+
+	for _, ch := range []<-chan struct{}{first, second} {
+		select {
+		case <-ch:
+		default:
+			t.Fatal("expected chain update signal")
+		}
+
+		select {
+		case <-ch:
+			t.Fatal("unexpected chain update signal")
+		default:
+		}
+	}
+
+	notifier.notify()
+	require.Len(t, first, 1)
+	require.Len(t, second, 1)
+}
@@ -42,6 +42,15 @@ func (n node) handleGetCFilters(header *protocol.MessageHeader, p peer.Peer) err
 		return fmt.Errorf("end height is too far away from start height")
 	}
 
+	prunedHeight, err := n.filtersDb.GetPrunedHeight(context.Background())
+	if err != nil {
+		return err
+	}
+
+	if prunedHeight > 0 && getCFilters.StartHeight <= prunedHeight {
+		return repository.ErrPruned
+	}
+
 	for height := endBlockHeader.Height; height > getCFilters.StartHeight; height-- {
 		blockHash, err := n.blockHeadersDb.GetBlockHashByHeight(context.Background(), height)
 		if err != nil {
@@ -0,0 +1,184 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+// maxFiltersPerFetch is the max number of filters requested with a single
+// getcfilters message
+const maxFiltersPerFetch = 1000
+
+var ErrInvalidFilterRange = errors.New("invalid filter range")
+
+// filterWaiters keeps track of the callers waiting for a filter requested
+// on demand via FetchFilter and FetchFilters.
+type filterWaiters struct {
+	waiters map[chainhash.Hash][]chan *repository.FilterEntry
+	locker  *sync.Mutex
+}
+
+func newFilterWaiters() *filterWaiters {
+	return &filterWaiters{
+		waiters: make(map[chainhash.Hash][]chan *repository.FilterEntry),
+		locker:  new(sync.Mutex),
+	}
+}
+
+func (w *filterWaiters) add(blockHash chainhash.Hash) chan *repository.FilterEntry {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+
+	ch := make(chan *repository.FilterEntry, 1)
+	w.waiters[blockHash] = append(w.waiters[blockHash], ch)
+	return ch
+}
+
+func (w *filterWaiters) remove(blockHash chainhash.Hash, ch chan *repository.FilterEntry) {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+
+	waiters := w.waiters[blockHash]
+	for i, c := range waiters {
+		if c == ch {
+			waiters = append(waiters[:i], waiters[i+1:]...)
+			break
+		}
+	}
+
+	if len(waiters) == 0 {
+		delete(w.waiters, blockHash)
+		return
+	}
+	w.waiters[blockHash] = waiters
+}
+
+// notify sends the filter to all the callers waiting for it
+func (w *filterWaiters) notify(blockHash chainhash.Hash, entry *repository.FilterEntry) {
+	w.locker.Lock()
+	defer w.locker.Unlock()
+
+	for _, ch := range w.waiters[blockHash] {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+	delete(w.waiters, blockHash)
+}
+
+// FetchFilter returns the filter of the given block, if it is not stored yet
+// it is requested to the best peer and the call blocks until it is received
+// (and cached in the filters repository) or the context is done.
+func (n *node) FetchFilter(
+	ctx context.Context,
+	blockHash chainhash.Hash,
+) (*repository.FilterEntry, error) {
+	entry, err := n.filtersDb.GetFilter(ctx, repository.FilterKey{
+		BlockHash:  blockHash.CloneBytes(),
+		FilterType: repository.RegularFilter,
+	})
+	if err == nil {
+		return entry, nil
+	}
+	if err != repository.ErrFilterNotFound {
+		return nil, err
+	}
+
+	ch := n.filterWaiters.add(blockHash)
+	defer n.filterWaiters.remove(blockHash, ch)
+
+	if err := n.RequestFilters(blockHash); err != nil {
+		return nil, err
+	}
+
+	select {
+	case entry := <-ch:
+		return entry, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// FetchFilters returns the filters of the blocks from startHeight up to the
+// one of stopHash, at most maxFiltersPerFetch. The ones not stored yet are
+// requested to the best peer with a single getcfilters message and the call
+// blocks until all of them are received or the context is done.
+func (n *node) FetchFilters(
+	ctx context.Context,
+	startHeight uint32,
+	stopHash chainhash.Hash,
+) ([]*repository.FilterEntry, error) {
+	stopHeader, err := n.blockHeadersDb.GetBlockHeader(ctx, stopHash)
+	if err != nil {
+		return nil, err
+	}
+
+	if stopHeader.Height < startHeight || stopHeader.Height-startHeight >= maxFiltersPerFetch {
+		return nil, ErrInvalidFilterRange
+	}
+
+	type waiter struct {
+		index     int
+		blockHash chainhash.Hash
+		ch        chan *repository.FilterEntry
+	}
+
+	entries := make([]*repository.FilterEntry, stopHeader.Height-startHeight+1)
+	missing := make([]waiter, 0)
+	defer func() {
+		for _, w := range missing {
+			n.filterWaiters.remove(w.blockHash, w.ch)
+		}
+	}()
+
+	for i := range entries {
+		blockHash, err := n.blockHeadersDb.GetBlockHashByHeight(ctx, startHeight+uint32(i))
+		if err != nil {
+			return nil, err
+		}
+
+		entry, err := n.filtersDb.GetFilter(ctx, repository.FilterKey{
+			BlockHash:  blockHash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		})
+		if err == nil {
+			entries[i] = entry
+			continue
+		}
+		if err != repository.ErrFilterNotFound {
+			return nil, err
+		}
+
+		missing = append(missing, waiter{i, *blockHash, n.filterWaiters.add(*blockHash)})
+	}
+
+	if len(missing) == 0 {
+		return entries, nil
+	}
+
+	p := n.getBestPeerForSync()
+	if p == nil {
+		return nil, errors.New("node: no peer connected")
+	}
+
+	// the range starts from the first missing filter
+	if err := n.sendGetCFilters(p, startHeight+uint32(missing[0].index), stopHash); err != nil {
+		return nil, err
+	}
+
+	for _, w := range missing {
+		select {
+		case entry := <-w.ch:
+			entries[w.index] = entry
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return entries, nil
+}
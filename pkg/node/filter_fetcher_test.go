@@ -0,0 +1,121 @@
+package node
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/inmemory"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+func TestFilterWaiters(t *testing.T) {
+	waiters := newFilterWaiters()
+	hash := chainhash.Hash{0x01}
+	entry := &repository.FilterEntry{NBytes: []byte{0x02}}
+
+	ch := waiters.add(hash)
+	other := waiters.add(hash)
+	waiters.remove(hash, other)
+
+	waiters.notify(hash, entry)
+
+	select {
+	case got := <-ch:
+		require.Equal(t, entry, got)
+	case <-time.After(time.Second):
+		t.Fatal("expected filter to be notified")
+	}
+
+	require.Len(t, other, 0)
+	require.Len(t, waiters.waiters, 0)
+}
+
+func TestFetchFilterStored(t *testing.T) {
+	ctx := context.Background()
+	filterDB := inmemory.NewFilterInmemory()
+	hash := chainhash.Hash{0x01}
+
+	key := repository.FilterKey{
+		BlockHash:  hash.CloneBytes(),
+		FilterType: repository.RegularFilter,
+	}
+	require.NoError(t, filterDB.PutFilter(ctx, &repository.FilterEntry{
+		Key:    key,
+		NBytes: []byte{0x02},
+	}))
+
+	n := &node{
+		filtersDb:     filterDB,
+		filterWaiters: newFilterWaiters(),
+	}
+
+	// stored filters are returned without asking any peer
+	entry, err := n.FetchFilter(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0x02}, entry.NBytes)
+
+	// no peer connected to fetch missing filters
+	_, err = n.FetchFilter(ctx, chainhash.Hash{0x03})
+	require.Error(t, err)
+}
+
+func TestFetchFiltersStored(t *testing.T) {
+	ctx := context.Background()
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	hashes := make([]chainhash.Hash, 0)
+	prevHash := make([]byte, 32)
+	for height := uint32(1); height <= 4; height++ {
+		header := block.Header{
+			Version:       1,
+			PrevBlockHash: prevHash,
+			MerkleRoot:    make([]byte, 32),
+			Height:        height,
+			ExtData:       &block.ExtData{Proof: &block.Proof{}},
+		}
+		require.NoError(t, headerDB.WriteHeaders(ctx, header))
+
+		hash, err := header.Hash()
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+		prevHash = hash.CloneBytes()
+
+		// the filter of the last block is missing
+		if height == 4 {
+			continue
+		}
+		require.NoError(t, filterDB.PutFilter(ctx, &repository.FilterEntry{
+			Key: repository.FilterKey{
+				BlockHash:  hash.CloneBytes(),
+				FilterType: repository.RegularFilter,
+			},
+			NBytes: []byte{byte(height)},
+		}))
+	}
+
+	n := &node{
+		filtersDb:      filterDB,
+		blockHeadersDb: headerDB,
+		filterWaiters:  newFilterWaiters(),
+	}
+
+	entries, err := n.FetchFilters(ctx, 1, hashes[2])
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for i, entry := range entries {
+		require.Equal(t, []byte{byte(i + 1)}, entry.NBytes)
+	}
+
+	_, err = n.FetchFilters(ctx, 3, hashes[0])
+	require.ErrorIs(t, err, ErrInvalidFilterRange)
+
+	// no peer connected to fetch missing filters
+	_, err = n.FetchFilters(ctx, 1, hashes[3])
+	require.Error(t, err)
+	require.Len(t, n.filterWaiters.waiters, 0)
+}
@@ -2,6 +2,7 @@ package node
 
 import (
 	"errors"
+	"github.com/google/uuid"
 	"github.com/vulpemventures/go-elements/block"
 	"github.com/vulpemventures/go-elements/transaction"
 	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
@@ -31,6 +32,9 @@ type MemPool struct {
 	txSubscribersMutex *sync.RWMutex
 	//txSubscribers is a list of subscribers listening for new transactions
 	txSubscribers []txSubscriber
+	//senders are the goroutines sending events to the subscribers, their
+	//channels are closed once all of them are done
+	senders *sync.WaitGroup
 }
 
 func NewMemPool() MemPool {
@@ -40,6 +44,7 @@ func NewMemPool() MemPool {
 		quitChan:           make(chan struct{}),
 		txsMutex:           new(sync.RWMutex),
 		txSubscribersMutex: new(sync.RWMutex),
+		senders:            new(sync.WaitGroup),
 	}
 }
 
@@ -63,6 +68,10 @@ func (t TxConfirmedEvent) TxID() string {
 	return t.txID
 }
 
+func (t TxConfirmedEvent) Transaction() transaction.Transaction {
+	return t.tx
+}
+
 type TxUnConfirmedEvent struct {
 	txID string
 	tx   transaction.Transaction
@@ -76,6 +85,10 @@ func (t TxUnConfirmedEvent) TxID() string {
 	return t.txID
 }
 
+func (t TxUnConfirmedEvent) Transaction() transaction.Transaction {
+	return t.tx
+}
+
 type txData struct {
 	tx           transaction.Transaction
 	timeReceived time.Time
@@ -92,10 +105,13 @@ func (m *MemPool) Start() {
 }
 
 func (m *MemPool) Stop() {
-	close(m.txChan)
+	// no sender is started once quitChan is closed, the ones running give up
+	m.txSubscribersMutex.Lock()
 	close(m.quitChan)
-	subs := m.getSubscribersSafe()
-	for _, v := range subs {
+	m.txSubscribersMutex.Unlock()
+
+	m.senders.Wait()
+	for _, v := range m.getSubscribersSafe() {
 		close(v.txEvent)
 	}
 }
@@ -113,7 +129,10 @@ func (m *MemPool) GetMemPool() map[string]transaction.Transaction {
 }
 
 func (m *MemPool) AddTx(tx protocol.MsgTx) {
-	m.txChan <- tx
+	select {
+	case m.txChan <- tx:
+	case <-m.quitChan:
+	}
 }
 
 func (m *MemPool) AddSubscriber(id string) <-chan TxEvent {
@@ -141,10 +160,10 @@ func (m *MemPool) CheckTxConfirmed(block block.Block) {
 
 func (m *MemPool) checkTxConfirmed(block block.Block) {
 	//TODO: check if this is the best way to do this
-	for _, v := range m.txs {
+	for _, v := range m.GetMemPool() {
 		for _, tx := range block.TransactionsData.Transactions {
-			if tx.TxHash().String() == v.tx.TxHash().String() {
-				if err := m.removeTxFromMemPool(v.tx.TxHash().String()); err != nil {
+			if tx.TxHash().String() == v.TxHash().String() {
+				if err := m.removeTxFromMemPool(v.TxHash().String()); err != nil {
 					log.Errorln("failed to remove tx from memPool")
 				}
 
@@ -180,7 +199,15 @@ func (m *MemPool) addTx(txID string, txData txData) {
 func (m *MemPool) listenForNewTxs() {
 	log.Debugln("mem-pool: listening for new transactions")
 
-	for tx := range m.txChan {
+	for {
+		var tx protocol.MsgTx
+		select {
+		case <-m.quitChan:
+			log.Debugln("mem-pool: memPool listener stopped")
+			return
+		case tx = <-m.txChan:
+		}
+
 		m.addTx(
 			tx.HashStr(),
 			txData{
@@ -196,17 +223,53 @@ func (m *MemPool) listenForNewTxs() {
 
 		log.Debugf("tx %s added to memPool", tx.HashStr())
 	}
-
-	log.Debugln("mem-pool: memPool listener stopped")
 }
 
 func (m *MemPool) notifySubscribers(txEvent TxEvent) {
-	subs := m.getSubscribersSafe()
-	for _, v := range subs {
+	m.txSubscribersMutex.RLock()
+	defer m.txSubscribersMutex.RUnlock()
+
+	select {
+	case <-m.quitChan:
+		return
+	default:
+	}
+
+	for _, v := range m.txSubscribers {
+		m.senders.Add(1)
 		go func(subscriber txSubscriber) {
+			defer m.senders.Done()
+
 			log.Debugf("notifying subscriber %s of new tx started", subscriber.id)
-			subscriber.txEvent <- txEvent
-			log.Debugf("notifying subscriber %s of new tx done", subscriber.id)
+			select {
+			case subscriber.txEvent <- txEvent:
+				log.Debugf("notifying subscriber %s of new tx done", subscriber.id)
+			case <-m.quitChan:
+			}
 		}(v)
 	}
 }
+
+// NotifyUnconfirmedTxs returns a channel receiving the transactions added to
+// the memPool, it is closed when the node stops
+func (n *node) NotifyUnconfirmedTxs() <-chan *transaction.Transaction {
+	txEvents := n.memPool.AddSubscriber(uuid.New().String())
+
+	txs := make(chan *transaction.Transaction)
+	go func() {
+		defer close(txs)
+
+		for txEvent := range txEvents {
+			if event, ok := txEvent.(TxUnConfirmedEvent); ok {
+				tx := event.Transaction()
+				select {
+				case txs <- &tx:
+				case <-n.quit:
+					return
+				}
+			}
+		}
+	}()
+
+	return txs
+}
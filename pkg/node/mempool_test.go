@@ -84,3 +84,70 @@ func TestNewMemPool(t *testing.T) {
 	memPool.Stop()
 	time.Sleep(time.Second * 1)
 }
+
+func TestNotifyUnconfirmedTxs(t *testing.T) {
+	tx, err := transaction.NewTxFromHex(testTxs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := &node{memPool: NewMemPool()}
+	n.memPool.Start()
+
+	txs := n.NotifyUnconfirmedTxs()
+	go n.memPool.AddTx(protocol.MsgTx{Transaction: *tx})
+
+	select {
+	case unconfirmed := <-txs:
+		assert.Equal(t, tx.TxHash(), unconfirmed.TxHash())
+	case <-time.After(time.Second * 3):
+		t.Fatal("unconfirmed tx not notified")
+	}
+
+	// confirmed txs are not notified
+	n.memPool.CheckTxConfirmed(block.Block{
+		TransactionsData: &block.Transactions{
+			Transactions: []*transaction.Transaction{tx},
+		},
+	})
+
+	select {
+	case <-txs:
+		t.Fatal("confirmed tx notified")
+	case <-time.After(time.Second):
+	}
+
+	n.memPool.Stop()
+}
+
+func TestMemPoolStop(t *testing.T) {
+	tx, err := transaction.NewTxFromHex(testTxs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memPool := NewMemPool()
+	memPool.Start()
+
+	// the subscriber never reads the event
+	txEvents := memPool.AddSubscriber("idle")
+	memPool.AddTx(protocol.MsgTx{Transaction: *tx})
+
+	stopped := make(chan struct{})
+	go func() {
+		memPool.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second * 3):
+		t.Fatal("mem-pool not stopped")
+	}
+
+	for range txEvents {
+	}
+
+	// txs added after stop are dropped
+	memPool.AddTx(protocol.MsgTx{Transaction: *tx})
+}
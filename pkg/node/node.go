@@ -3,10 +3,13 @@ package node
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/go-elements/transaction"
 	"github.com/vulpemventures/neutrino-elements/pkg/binary"
 	"github.com/vulpemventures/neutrino-elements/pkg/peer"
 	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
@@ -27,6 +30,11 @@ type NodeService interface {
 	AddOutboundPeer(peer.Peer) error
 	SendTransaction(txhex string) error
 	GetChainTip() (*block.Header, error)
+	RequestFilters(blockHashes ...chainhash.Hash) error
+	FetchFilter(ctx context.Context, blockHash chainhash.Hash) (*repository.FilterEntry, error)
+	FetchFilters(ctx context.Context, startHeight uint32, stopHash chainhash.Hash) ([]*repository.FilterEntry, error)
+	NotifyChainUpdates() <-chan struct{}
+	NotifyUnconfirmedTxs() <-chan *transaction.Transaction
 }
 
 // node implements an Elements full node.
@@ -45,6 +53,10 @@ type node struct {
 	blockHeadersCh   chan block.Header
 	filtersDb        repository.FilterRepository
 	blockHeadersDb   repository.BlockHeaderRepository
+	filterRetention  FilterRetention
+	lazyFilters      bool
+	filterWaiters    *filterWaiters
+	chainNotifier    *chainNotifier
 
 	memPool MemPool
 
@@ -61,6 +73,11 @@ type NodeConfig struct {
 	UserAgent      string
 	FiltersDB      repository.FilterRepository
 	BlockHeadersDB repository.BlockHeaderRepository
+	// FilterRetention prunes old filters, by default all of them are kept
+	FilterRetention FilterRetention
+	// LazyFilters syncs block headers only, filters are downloaded on demand
+	// via FetchFilter and FetchFilters
+	LazyFilters bool
 }
 
 // New returns a new Node.
@@ -70,6 +87,10 @@ func New(config NodeConfig) (NodeService, error) {
 		return nil, fmt.Errorf("unsupported network %s", config.Network)
 	}
 
+	if err := config.FilterRetention.validate(); err != nil {
+		return nil, err
+	}
+
 	return &node{
 		Network:     networkMagic,
 		Peers:       make(map[peer.PeerID]peer.Peer),
@@ -83,6 +104,10 @@ func New(config NodeConfig) (NodeService, error) {
 		blockHeadersCh:   make(chan block.Header),
 		filtersDb:        config.FiltersDB,
 		blockHeadersDb:   config.BlockHeadersDB,
+		filterRetention:  config.FilterRetention,
+		lazyFilters:      config.LazyFilters,
+		filterWaiters:    newFilterWaiters(),
+		chainNotifier:    newChainNotifier(),
 		memPool:          NewMemPool(),
 		quit:             make(chan struct{}),
 		syncedChan:       make(chan struct{}),
@@ -133,6 +158,9 @@ func (n node) Start(initialOutboundPeerAddr string) error {
 	go n.monitorBlockHeaders()
 	go n.monitorCFilters()
 	go n.checkSyncedInitial(initialPeer)
+	if n.filterRetention.isEnabled() {
+		go n.monitorFiltersRetention()
+	}
 
 	n.memPool.Start()
 
@@ -322,9 +350,22 @@ func (n *node) monitorBlockHeaders() {
 				logrus.Error(err)
 				continue
 			}
+			n.chainNotifier.notify()
 
 			log.Debugf("node: new block header: %v\n", newHeader.Height)
 
+			prunedHeight, err := n.filtersDb.GetPrunedHeight(context.Background())
+			if err != nil {
+				logrus.Error(err)
+				continue
+			}
+
+			// the filter would be deleted by the retention policy, or it will
+			// be fetched on demand
+			if n.lazyFilters || newHeader.Height <= prunedHeight {
+				continue
+			}
+
 			if len(n.Peers) > 0 {
 				hash, err := newHeader.Hash()
 				if err != nil {
@@ -371,11 +412,24 @@ func (n *node) monitorCFilters() {
 				continue
 			}
 
-			err = n.filtersDb.PutFilter(context.Background(), entry)
+			// the filters fetched on demand below the retention policy are
+			// handed to the waiters without being stored
+			pruned, err := n.isFilterPruned(context.Background(), *newCFilterMsg.BlockHash)
 			if err != nil {
 				logrus.Error(err)
 				continue
 			}
+
+			if !pruned {
+				err = n.filtersDb.PutFilter(context.Background(), entry)
+				if err != nil {
+					logrus.Error(err)
+					continue
+				}
+			}
+
+			n.filterWaiters.notify(*newCFilterMsg.BlockHash, entry)
+			n.chainNotifier.notify()
 		}
 	}
 }
@@ -400,3 +454,42 @@ func (n *node) SendTransaction(txhex string) error {
 
 	return nil
 }
+
+// RequestFilters asks the best peer for the filters of the given blocks,
+// they are stored in the filters repository once received.
+func (n *node) RequestFilters(blockHashes ...chainhash.Hash) error {
+	p := n.getBestPeerForSync()
+	if p == nil {
+		return errors.New("node: no peer connected")
+	}
+
+	for _, hash := range blockHashes {
+		header, err := n.blockHeadersDb.GetBlockHeader(context.Background(), hash)
+		if err != nil {
+			return err
+		}
+
+		if err := n.sendGetCFilters(p, header.Height, hash); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sendGetCFilters asks the peer for the filters of the blocks from startHeight
+// up to the one of stopHash
+func (n *node) sendGetCFilters(p peer.Peer, startHeight uint32, stopHash chainhash.Hash) error {
+	getcFilter := protocol.MsgGetCFilters{
+		FilterType:  0,
+		StartHeight: startHeight,
+		StopHash:    stopHash,
+	}
+
+	msg, err := protocol.NewMessage("getcfilters", n.Network, &getcFilter)
+	if err != nil {
+		return err
+	}
+
+	return n.sendMessage(p.Connection(), msg)
+}
@@ -0,0 +1,158 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+const (
+	pruneInterval = 10 * time.Minute
+	// pruneBatchSize is the max number of filters deleted at once
+	pruneBatchSize = 1000
+)
+
+// FilterRetention is the policy used to prune old filters, the zero value
+// keeps all of them.
+type FilterRetention struct {
+	// LastBlocks keeps the filters of the last N blocks only
+	LastBlocks uint32
+	// SinceHeight keeps the filters of the blocks from the given height only
+	SinceHeight uint32
+}
+
+func (r FilterRetention) validate() error {
+	if r.LastBlocks > 0 && r.SinceHeight > 0 {
+		return errors.New("filter retention: only one of last blocks and since height can be set")
+	}
+
+	return nil
+}
+
+func (r FilterRetention) isEnabled() bool {
+	return r.LastBlocks > 0 || r.SinceHeight > 0
+}
+
+// pruneHeight returns the height up to which filters can be deleted
+func (r FilterRetention) pruneHeight(tipHeight uint32) uint32 {
+	if r.SinceHeight > 0 {
+		return r.SinceHeight - 1
+	}
+
+	if tipHeight < r.LastBlocks {
+		return 0
+	}
+
+	return tipHeight - r.LastBlocks
+}
+
+// monitorFiltersRetention periodically deletes the filters that are out of
+// the retention policy of the node.
+func (n *node) monitorFiltersRetention() {
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := n.pruneFilters(context.Background()); err != nil {
+			log.Errorf("node: failed to prune filters: %v", err)
+		}
+
+		select {
+		case <-n.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *node) pruneFilters(ctx context.Context) error {
+	prunedHeight, err := n.filtersDb.GetPrunedHeight(ctx)
+	if err != nil {
+		return err
+	}
+
+	var tipHeight uint32
+	tip, err := n.blockHeadersDb.ChainTip(ctx)
+	if err != nil {
+		if err != repository.ErrNoBlocksHeaders {
+			return err
+		}
+	} else {
+		tipHeight = tip.Height
+	}
+
+	pruneHeight := n.filterRetention.pruneHeight(tipHeight)
+	if pruneHeight <= prunedHeight {
+		return nil
+	}
+
+	// the pruned height is updated before deleting, this way nobody waits for
+	// filters that are going to be deleted
+	if err := n.filtersDb.SetPrunedHeight(ctx, pruneHeight); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, pruneBatchSize)
+	for height := prunedHeight + 1; height <= pruneHeight && height <= tipHeight; height++ {
+		hash, err := n.blockHeadersDb.GetBlockHashByHeight(ctx, height)
+		if err != nil {
+			if err == repository.ErrBlockNotFound || err == repository.ErrNoBlocksHeaders {
+				continue
+			}
+			return err
+		}
+
+		keys = append(keys, repository.FilterKey{
+			BlockHash:  hash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		}.String())
+
+		if len(keys) == pruneBatchSize {
+			if err := n.filtersDb.DeleteFilters(ctx, keys...); err != nil {
+				return err
+			}
+			keys = keys[:0]
+		}
+	}
+
+	if err := n.filtersDb.DeleteFilters(ctx, keys...); err != nil {
+		return err
+	}
+
+	log.Infof("node: pruned filters up to height %v", pruneHeight)
+
+	return nil
+}
+
+// isFilterPruned returns true if the filter of the block is out of the
+// retention policy of the node, either already pruned or about to be
+func (n *node) isFilterPruned(ctx context.Context, blockHash chainhash.Hash) (bool, error) {
+	if !n.filterRetention.isEnabled() {
+		return false, nil
+	}
+
+	header, err := n.blockHeadersDb.GetBlockHeader(ctx, blockHash)
+	if err != nil {
+		return false, err
+	}
+
+	prunedHeight, err := n.filtersDb.GetPrunedHeight(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if header.Height <= prunedHeight {
+		return true, nil
+	}
+
+	tip, err := n.blockHeadersDb.ChainTip(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return header.Height <= n.filterRetention.pruneHeight(tip.Height), nil
+}
@@ -0,0 +1,140 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/inmemory"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+func TestFilterRetentionPruneHeight(t *testing.T) {
+	tests := []struct {
+		name      string
+		retention FilterRetention
+		tipHeight uint32
+		want      uint32
+	}{
+		{"last blocks", FilterRetention{LastBlocks: 10}, 100, 90},
+		{"last blocks above tip", FilterRetention{LastBlocks: 10}, 5, 0},
+		{"since height", FilterRetention{SinceHeight: 50}, 100, 49},
+		{"since height above tip", FilterRetention{SinceHeight: 50}, 10, 49},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.retention.pruneHeight(tt.tipHeight))
+		})
+	}
+
+	require.Error(t, FilterRetention{LastBlocks: 1, SinceHeight: 1}.validate())
+}
+
+func TestPruneFilters(t *testing.T) {
+	ctx := context.Background()
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	var key [gcs.KeySize]byte
+	filter, err := gcs.BuildGCSFilter(19, 784931, key, [][]byte{[]byte("dummy")})
+	require.NoError(t, err)
+
+	prevHash := make([]byte, 32)
+	for height := uint32(1); height <= 10; height++ {
+		header := block.Header{
+			Version:       1,
+			PrevBlockHash: prevHash,
+			MerkleRoot:    make([]byte, 32),
+			Height:        height,
+			ExtData:       &block.ExtData{Proof: &block.Proof{}},
+		}
+		require.NoError(t, headerDB.WriteHeaders(ctx, header))
+
+		hash, err := header.Hash()
+		require.NoError(t, err)
+		prevHash = hash.CloneBytes()
+
+		entry, err := repository.NewFilterEntry(repository.FilterKey{
+			BlockHash:  hash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		}, filter)
+		require.NoError(t, err)
+		require.NoError(t, filterDB.PutFilter(ctx, entry))
+	}
+
+	n := &node{
+		filtersDb:       filterDB,
+		blockHeadersDb:  headerDB,
+		filterRetention: FilterRetention{LastBlocks: 3},
+	}
+	require.NoError(t, n.pruneFilters(ctx))
+
+	prunedHeight, err := filterDB.GetPrunedHeight(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(7), prunedHeight)
+
+	keys, err := filterDB.GetFilterKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 3)
+
+	for height := uint32(1); height <= 10; height++ {
+		hash, err := headerDB.GetBlockHashByHeight(ctx, height)
+		require.NoError(t, err)
+
+		_, err = filterDB.GetFilter(ctx, repository.FilterKey{
+			BlockHash:  hash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		})
+		if height <= prunedHeight {
+			require.ErrorIs(t, err, repository.ErrFilterNotFound)
+		} else {
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestIsFilterPruned(t *testing.T) {
+	ctx := context.Background()
+	headerDB := inmemory.NewHeaderInmemory()
+
+	hashes := make(map[uint32]chainhash.Hash)
+	prevHash := make([]byte, 32)
+	for height := uint32(1); height <= 10; height++ {
+		header := block.Header{
+			Version:       1,
+			PrevBlockHash: prevHash,
+			MerkleRoot:    make([]byte, 32),
+			Height:        height,
+			ExtData:       &block.ExtData{Proof: &block.Proof{}},
+		}
+		require.NoError(t, headerDB.WriteHeaders(ctx, header))
+
+		hash, err := header.Hash()
+		require.NoError(t, err)
+		hashes[height] = hash
+		prevHash = hash.CloneBytes()
+	}
+
+	// the filters not pruned yet are out of the retention too
+	n := &node{
+		filtersDb:       inmemory.NewFilterInmemory(),
+		blockHeadersDb:  headerDB,
+		filterRetention: FilterRetention{LastBlocks: 3},
+	}
+	pruned, err := n.isFilterPruned(ctx, hashes[7])
+	require.NoError(t, err)
+	require.True(t, pruned)
+
+	pruned, err = n.isFilterPruned(ctx, hashes[8])
+	require.NoError(t, err)
+	require.False(t, pruned)
+
+	n.filterRetention = FilterRetention{}
+	pruned, err = n.isFilterPruned(ctx, hashes[1])
+	require.NoError(t, err)
+	require.False(t, pruned)
+}
@@ -14,11 +14,26 @@ const (
 	RegularFilter FilterType = iota
 )
 
-var ErrFilterNotFound = errors.New("filter not found")
+var (
+	ErrFilterNotFound = errors.New("filter not found")
+	// ErrPruned is returned when the filters of the requested blocks have
+	// been deleted by the retention policy
+	ErrPruned = errors.New("filters have been pruned up to the requested height")
+)
 
 type FilterRepository interface {
 	PutFilter(context.Context, *FilterEntry) error
 	GetFilter(context.Context, FilterKey) (*FilterEntry, error)
+	// GetFilterKeys returns the keys (see FilterKey.String) of all the stored filters
+	GetFilterKeys(context.Context) ([]string, error)
+	// DeleteFilters removes the filters stored with the given keys
+	DeleteFilters(context.Context, ...string) error
+	// SetPrunedHeight records that the filters of the blocks up to the given
+	// height (included) are not available anymore
+	SetPrunedHeight(context.Context, uint32) error
+	// GetPrunedHeight returns the height up to which filters have been pruned,
+	// 0 means nothing has been pruned
+	GetPrunedHeight(context.Context) (uint32, error)
 }
 
 // FilterEntry is the base filter structure using to store filter data.
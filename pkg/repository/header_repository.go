@@ -3,6 +3,8 @@ package repository
 import (
 	"context"
 	"errors"
+	"sort"
+	"time"
 
 	"github.com/btcsuite/btcd/blockchain"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
@@ -23,4 +25,50 @@ type BlockHeaderRepository interface {
 	// LatestBlockLocator returns the block locator for the latest known tip as root of the locator
 	LatestBlockLocator(context.Context) (blockchain.BlockLocator, error)
 	HasAllAncestors(context.Context, chainhash.Hash) (bool, error)
+	// DeleteHeadersFromHeight removes all the headers with height greater or equal to the given one
+	DeleteHeadersFromHeight(context.Context, uint32) error
+	// GetHeightByTime returns the height of the first block with timestamp
+	// greater or equal to the given time, see SearchHeightByTime
+	GetHeightByTime(context.Context, time.Time) (uint32, error)
+}
+
+// MaxTimestampDrift is how far a block timestamp can be from the time the
+// block is mined, the limit accepted by the nodes for timestamps in the future.
+const MaxTimestampDrift = 2 * time.Hour
+
+// SearchHeightByTime binary searches the heights from 1 to tipHeight for the
+// first block with timestamp greater or equal to t - MaxTimestampDrift. Block
+// timestamps are not strictly increasing, the search starts that margin
+// earlier so that the blocks mined after t are not skipped because of a block
+// out of order. 0 is returned if the first block is not older than the margin,
+// tipHeight + 1 if all the blocks are older.
+func SearchHeightByTime(
+	tipHeight uint32,
+	t time.Time,
+	timestampAt func(height uint32) (uint32, error),
+) (uint32, error) {
+	t = t.Add(-MaxTimestampDrift)
+
+	var searchErr error
+	i := sort.Search(int(tipHeight), func(i int) bool {
+		if searchErr != nil {
+			return true
+		}
+
+		timestamp, err := timestampAt(uint32(i) + 1)
+		if err != nil {
+			searchErr = err
+			return true
+		}
+
+		return int64(timestamp) >= t.Unix()
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+
+	if i == 0 {
+		return 0, nil
+	}
+	return uint32(i) + 1, nil
 }
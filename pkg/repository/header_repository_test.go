@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearchHeightByTime(t *testing.T) {
+	const base = 1658163900
+	const blockTime = 60
+
+	// one block per minute, the block at height 302 has a timestamp 200
+	// minutes behind the others
+	timestamps := make(map[uint32]uint32)
+	for height := uint32(1); height <= 500; height++ {
+		timestamps[height] = base + height*blockTime
+	}
+	timestamps[302] = base + 100*blockTime
+
+	timestampAt := func(height uint32) (uint32, error) {
+		return timestamps[height], nil
+	}
+
+	// the blocks from 300, mined after the time, are not skipped
+	height, err := SearchHeightByTime(500, time.Unix(base+300*blockTime, 0), timestampAt)
+	require.NoError(t, err)
+	require.LessOrEqual(t, height, uint32(300))
+	require.Equal(t, uint32(300-MaxTimestampDrift/time.Minute), height)
+
+	height, err = SearchHeightByTime(500, time.Unix(base, 0), timestampAt)
+	require.NoError(t, err)
+	require.Equal(t, uint32(0), height)
+
+	height, err = SearchHeightByTime(500, time.Unix(base+1000*blockTime, 0), timestampAt)
+	require.NoError(t, err)
+	require.Equal(t, uint32(501), height)
+}
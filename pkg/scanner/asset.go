@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"errors"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/vulpemventures/go-elements/address"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+// ErrMissingTrackedAsset is returned if AssetUtxo events are watched without
+// the asset to watch (see WithAssetTracking)
+var ErrMissingTrackedAsset = errors.New("missing asset to watch")
+
+// AssetOperation classifies the transaction of a report by the effect it has
+// on the supply of the assets it moves
+type AssetOperation int
+
+const (
+	// AssetTransfer moves assets without changing their supply
+	AssetTransfer AssetOperation = iota
+	// AssetIssuance issues a new asset (and its reissuance token)
+	AssetIssuance
+	// AssetReissuance issues more of an existing asset
+	AssetReissuance
+	// AssetBurn destroys assets sending them to an OP_RETURN output
+	AssetBurn
+)
+
+func (o AssetOperation) String() string {
+	switch o {
+	case AssetIssuance:
+		return "issuance"
+	case AssetReissuance:
+		return "reissuance"
+	case AssetBurn:
+		return "burn"
+	default:
+		return "transfer"
+	}
+}
+
+// MatchedIssuance is the issuance carried by a matched input. The amounts are
+// set if explicit, TokenID is empty for reissuances.
+type MatchedIssuance struct {
+	IsReissuance bool
+	AssetID      string
+	TokenID      string
+	AssetAmount  uint64
+	TokenAmount  uint64
+}
+
+func newMatchedIssuance(in *transaction.TxInput) (*MatchedIssuance, error) {
+	// the entropy is copied not to alter the transaction when hashing it
+	entropy := append([]byte{}, in.Issuance.AssetEntropy...)
+
+	var issuance *transaction.TxIssuanceExtended
+	if in.Issuance.IsReissuance() {
+		issuance = transaction.NewTxIssuanceFromEntropy(entropy)
+	} else {
+		issuance = transaction.NewTxIssuanceFromContractHash(entropy)
+		if err := issuance.GenerateEntropy(in.Hash, in.Index); err != nil {
+			return nil, err
+		}
+	}
+
+	asset, err := issuance.GenerateAsset()
+	if err != nil {
+		return nil, err
+	}
+
+	matched := &MatchedIssuance{
+		IsReissuance: in.Issuance.IsReissuance(),
+		AssetID:      elementsutil.AssetHashFromBytes(append([]byte{0x01}, asset...)),
+	}
+
+	if !matched.IsReissuance {
+		// the token of issuances with a blinded amount is a different one
+		var flag uint
+		if len(in.Issuance.AssetAmount) > 9 {
+			flag = 1
+		}
+
+		token, err := issuance.GenerateReissuanceToken(flag)
+		if err != nil {
+			return nil, err
+		}
+		matched.TokenID = elementsutil.AssetHashFromBytes(append([]byte{0x01}, token...))
+	}
+
+	if amount, err := elementsutil.ValueFromBytes(in.Issuance.AssetAmount); err == nil {
+		matched.AssetAmount = amount
+	}
+	if amount, err := elementsutil.ValueFromBytes(in.Issuance.TokenAmount); err == nil {
+		matched.TokenAmount = amount
+	}
+
+	return matched, nil
+}
+
+// classifyOperation returns the asset operation of the transaction
+func classifyOperation(tx *transaction.Transaction) AssetOperation {
+	for _, in := range tx.Inputs {
+		if in.Issuance == nil {
+			continue
+		}
+
+		if in.Issuance.IsReissuance() {
+			return AssetReissuance
+		}
+		return AssetIssuance
+	}
+
+	for _, out := range tx.Outputs {
+		if isBurnOutput(out) {
+			return AssetBurn
+		}
+	}
+
+	return AssetTransfer
+}
+
+// isBurnOutput returns true if the output sends a non zero amount to an
+// OP_RETURN script, the fee output has an empty script instead
+func isBurnOutput(out *transaction.TxOutput) bool {
+	if len(out.Script) == 0 || out.Script[0] != txscript.OP_RETURN {
+		return false
+	}
+
+	value, err := elementsutil.ValueFromBytes(out.Value)
+	return err != nil || value > 0
+}
+
+// reportFilter is implemented by the watch items matching more transactions
+// than the ones to report (eg. IssuanceWatchItem matches every spending of
+// the outpoint so that the request is resolved). filterReport returns false
+// if the report must not be sent, it may drop the outputs not to report.
+type reportFilter interface {
+	filterReport(report *Report) bool
+}
+
+// IssuanceWatchItem is used to watch for the issuance (or reissuance) of an
+// asset by the input spending an outpoint. The item is resolved by any
+// spending of the outpoint, but only the (re)issuances are reported.
+type IssuanceWatchItem struct {
+	SpentWatchItem
+	reissuance bool
+}
+
+// NewIssuanceWatchItemFromInput watches for the issuance made by the input
+// spending the given outpoint
+func NewIssuanceWatchItemFromInput(
+	input *transaction.TxInput,
+	prevoutScript []byte,
+) (WatchItem, error) {
+	return newIssuanceWatchItem(input, prevoutScript, false)
+}
+
+// NewReissuanceWatchItemFromInput watches for the reissuance made by the
+// input spending the given outpoint
+func NewReissuanceWatchItemFromInput(
+	input *transaction.TxInput,
+	prevoutScript []byte,
+) (WatchItem, error) {
+	return newIssuanceWatchItem(input, prevoutScript, true)
+}
+
+func newIssuanceWatchItem(
+	input *transaction.TxInput,
+	prevoutScript []byte,
+	reissuance bool,
+) (WatchItem, error) {
+	h, err := chainhash.NewHash(input.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &IssuanceWatchItem{
+		SpentWatchItem: SpentWatchItem{
+			hash:         h,
+			index:        input.Index,
+			outputScript: prevoutScript,
+		},
+		reissuance: reissuance,
+	}, nil
+}
+
+func (i *IssuanceWatchItem) EventType() EventType {
+	if i.reissuance {
+		return Reissuance
+	}
+	return Issuance
+}
+
+func (i *IssuanceWatchItem) filterReport(report *Report) bool {
+	for _, in := range report.Inputs {
+		if in.Issuance != nil && in.Issuance.IsReissuance == i.reissuance {
+			return true
+		}
+	}
+	return false
+}
+
+// AssetWatchItem is used to recognise new outputs of a specific asset paying
+// to a script, confidential outputs are reported only if they can be
+// unblinded (see WithBlindingKeys)
+type AssetWatchItem struct {
+	UnspentWatchItem
+	asset string
+}
+
+// NewAssetWatchItemFromAddress watches for the outputs of the given asset
+// (hex id) paying to the address
+func NewAssetWatchItemFromAddress(addr, asset string) (WatchItem, error) {
+	script, err := address.ToOutputScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AssetWatchItem{
+		UnspentWatchItem: UnspentWatchItem{outputScript: script},
+		asset:            asset,
+	}, nil
+}
+
+func (a *AssetWatchItem) EventType() EventType {
+	return AssetUtxo
+}
+
+func (a *AssetWatchItem) filterReport(report *Report) bool {
+	outputs := make([]MatchedOutput, 0, len(report.Outputs))
+	for _, out := range report.Outputs {
+		if out.Asset == a.asset {
+			outputs = append(outputs, out)
+		}
+	}
+	report.Outputs = outputs
+
+	return len(outputs) > 0
+}
+
+// sameAsset returns true if the items watch for the same asset
+func sameAsset(a, b WatchItem) bool {
+	assetA, okA := a.(*AssetWatchItem)
+	assetB, okB := b.(*AssetWatchItem)
+	if okA != okB {
+		return false
+	}
+
+	return !okA || assetA.asset == assetB.asset
+}
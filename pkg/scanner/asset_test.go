@@ -0,0 +1,195 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+const (
+	issuanceTxHash = "39453cf897e2f0c2e9563364874f4b2a85be06dd8ec10665085033eeb75016c3"
+	issuedAsset    = "dedf795f74e8b52c6ff8a9ad390850a87b18aeb2be9d1967038308290093a893"
+	issuedToken    = "fa1074db60b598cf1d6d0318655125c26a2afc9fe57fb2bdff8d8f7408f8814d"
+)
+
+func TestMatchedIssuance(t *testing.T) {
+	in := newIssuanceInput(t, false)
+
+	matched, err := newMatchedInput(0, in)
+	require.NoError(t, err)
+	require.Equal(t, &MatchedIssuance{
+		AssetID:     issuedAsset,
+		TokenID:     issuedToken,
+		AssetAmount: 1000,
+		TokenAmount: 1,
+	}, matched.Issuance)
+
+	reissuance := newIssuanceInput(t, true)
+	matched, err = newMatchedInput(0, reissuance)
+	require.NoError(t, err)
+	require.True(t, matched.Issuance.IsReissuance)
+	require.Equal(t, issuedAsset, matched.Issuance.AssetID)
+	require.Empty(t, matched.Issuance.TokenID)
+}
+
+func TestSpentWatchItemInvalidIssuance(t *testing.T) {
+	// the entropy of the reissuance is missing, the asset can't be computed
+	in := newIssuanceInput(t, true)
+	in.Issuance.AssetEntropy = nil
+	_, err := newMatchedInput(0, in)
+	require.Error(t, err)
+
+	tx := transaction.NewTx(2)
+	tx.AddInput(in)
+	hash, err := chainhash.NewHash(in.Hash)
+	require.NoError(t, err)
+	item := &SpentWatchItem{hash: hash, index: in.Index}
+
+	// the spending is reported without the issuance
+	match := item.Match(tx)
+	require.NotNil(t, match)
+	require.Len(t, match.Inputs, 1)
+	require.Equal(t, *hash, match.Inputs[0].PrevoutHash)
+	require.Equal(t, in.Index, match.Inputs[0].PrevoutIndex)
+	require.Nil(t, match.Inputs[0].Issuance)
+}
+
+func TestClassifyOperation(t *testing.T) {
+	value, err := elementsutil.ValueToBytes(1000)
+	require.NoError(t, err)
+	zero, err := elementsutil.ValueToBytes(0)
+	require.NoError(t, err)
+
+	transfer := transaction.NewTx(2)
+	transfer.AddInput(transaction.NewTxInput(make([]byte, 32), 0))
+	transfer.AddOutput(transaction.NewTxOutput(nil, value, []byte{0x51}))
+	transfer.AddOutput(transaction.NewTxOutput(nil, value, []byte{}))
+	// OP_RETURN data outputs without value are not burns
+	transfer.AddOutput(transaction.NewTxOutput(nil, zero, []byte{0x6a, 0x01, 0x01}))
+	require.Equal(t, AssetTransfer, classifyOperation(transfer))
+
+	burn := transfer.Copy()
+	burn.AddOutput(transaction.NewTxOutput(nil, value, []byte{0x6a}))
+	require.Equal(t, AssetBurn, classifyOperation(burn))
+
+	issuance := transaction.NewTx(2)
+	issuance.AddInput(newIssuanceInput(t, false))
+	require.Equal(t, AssetIssuance, classifyOperation(issuance))
+
+	reissuance := transaction.NewTx(2)
+	reissuance.AddInput(newIssuanceInput(t, true))
+	require.Equal(t, AssetReissuance, classifyOperation(reissuance))
+}
+
+func TestIssuanceWatchItem(t *testing.T) {
+	in := newIssuanceInput(t, false)
+	script := []byte{0x00, 0x14, 0x01}
+
+	item, err := NewIssuanceWatchItemFromInput(in, script)
+	require.NoError(t, err)
+	reissuanceItem, err := NewReissuanceWatchItemFromInput(in, script)
+	require.NoError(t, err)
+	spentItem, err := NewSpentWatchItemFromInput(in, script)
+	require.NoError(t, err)
+
+	require.Equal(t, Issuance, item.EventType())
+	require.Equal(t, Reissuance, reissuanceItem.EventType())
+	require.False(t, sameItem(item, reissuanceItem))
+	require.False(t, sameItem(item, spentItem))
+
+	tx := transaction.NewTx(2)
+	tx.AddInput(in)
+
+	// the items match any spending of the outpoint, the kind of issuance
+	// decides if the match is reported
+	for _, v := range []struct {
+		item     WatchItem
+		reported bool
+	}{
+		{item, true},
+		{reissuanceItem, false},
+	} {
+		details := v.item.Match(tx)
+		require.NotNil(t, details)
+
+		report := &Report{Inputs: details.Inputs}
+		require.Equal(t, v.reported, v.item.(reportFilter).filterReport(report))
+	}
+
+	// indexed by outpoint in the scan batch
+	batch := newScanBatch()
+	req := newScanRequest(WithWatchItem(item))
+	batch.add(req)
+	require.Equal(t, []*ScanRequest{req}, matchedRequests(batch.match(tx)))
+}
+
+func TestAssetWatchItem(t *testing.T) {
+	const otherAsset = "25b251070e29ca19043cf33ccd7324e2ddab03ecc4ae0b5e77c4fc0e5cf6c95a"
+	script := []byte{0x00, 0x14, 0x01}
+
+	item := &AssetWatchItem{
+		UnspentWatchItem: UnspentWatchItem{outputScript: script},
+		asset:            issuedAsset,
+	}
+	require.Equal(t, AssetUtxo, item.EventType())
+	require.False(t, sameItem(item, &AssetWatchItem{
+		UnspentWatchItem: UnspentWatchItem{outputScript: script},
+		asset:            otherAsset,
+	}))
+	require.False(t, sameItem(item, &UnspentWatchItem{outputScript: script}))
+
+	value, err := elementsutil.ValueToBytes(1000)
+	require.NoError(t, err)
+
+	tx := transaction.NewTx(2)
+	for _, asset := range []string{otherAsset, issuedAsset} {
+		assetBytes, err := elementsutil.AssetHashToBytes(asset)
+		require.NoError(t, err)
+		tx.AddOutput(transaction.NewTxOutput(assetBytes, value, script))
+	}
+
+	details := item.Match(tx)
+	require.NotNil(t, details)
+	require.Len(t, details.Outputs, 2)
+
+	report := &Report{Outputs: details.Outputs}
+	require.True(t, item.filterReport(report))
+	require.Len(t, report.Outputs, 1)
+	require.Equal(t, uint32(1), report.Outputs[0].Index)
+
+	report = &Report{Outputs: details.Outputs[:1]}
+	require.False(t, item.filterReport(report))
+}
+
+func newIssuanceInput(t *testing.T, reissuance bool) *transaction.TxInput {
+	hash, err := chainhash.NewHashFromStr(issuanceTxHash)
+	require.NoError(t, err)
+
+	assetAmount, err := elementsutil.ValueToBytes(1000)
+	require.NoError(t, err)
+	tokenAmount, err := elementsutil.ValueToBytes(1)
+	require.NoError(t, err)
+
+	in := transaction.NewTxInput(hash[:], 68)
+	in.Issuance = &transaction.TxIssuance{
+		AssetBlindingNonce: make([]byte, 32),
+		AssetEntropy:       make([]byte, 32),
+		AssetAmount:        assetAmount,
+		TokenAmount:        tokenAmount,
+	}
+
+	if reissuance {
+		entropy, err := hex.DecodeString("3db9d8b4a9da087b42f29f34431412aaa24d63750bb31b9a2e263797248135e0")
+		require.NoError(t, err)
+
+		in.Issuance.AssetBlindingNonce = append([]byte{0x01}, make([]byte, 31)...)
+		in.Issuance.AssetEntropy = entropy
+		in.Issuance.TokenAmount = []byte{0x00}
+	}
+
+	return in
+}
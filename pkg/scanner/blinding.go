@@ -0,0 +1,163 @@
+package scanner
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/vulpemventures/go-elements/confidential"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/slip77"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+var (
+	ErrInvalidConfidentialDescriptor = errors.New("invalid ct descriptor")
+	// ErrUnsupportedBlindingKey is returned for ct descriptors whose blinding
+	// key is not a slip77(<master key>) expression
+	ErrUnsupportedBlindingKey = errors.New("unsupported ct descriptor blinding key")
+	ErrInvalidBlindingKey     = errors.New("invalid blinding key")
+	ErrUnblindOutput          = errors.New("unable to unblind output")
+)
+
+// BlindingKeys are used to unblind the confidential outputs matched by a
+// request: every private key is tried, then the one derived from the SLIP-77
+// master key for the output script, if set
+type BlindingKeys struct {
+	PrivateKeys [][]byte
+	MasterKey   []byte
+}
+
+// WithBlindingKeys adds the keys used to unblind the outputs matched by the
+// request, the master key replaces the one already set, if any
+func WithBlindingKeys(keys BlindingKeys) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.BlindingKeys = req.BlindingKeys.merge(keys)
+	}
+}
+
+func (k *BlindingKeys) merge(other BlindingKeys) *BlindingKeys {
+	merged := &BlindingKeys{MasterKey: other.MasterKey}
+	if k != nil {
+		merged.PrivateKeys = append(merged.PrivateKeys, k.PrivateKeys...)
+		if len(merged.MasterKey) == 0 {
+			merged.MasterKey = k.MasterKey
+		}
+	}
+	merged.PrivateKeys = append(merged.PrivateKeys, other.PrivateKeys...)
+
+	return merged
+}
+
+func (k *BlindingKeys) unblind(out *transaction.TxOutput) (*confidential.UnblindOutputResult, error) {
+	for _, key := range k.PrivateKeys {
+		if res, err := confidential.UnblindOutputWithKey(out, key); err == nil {
+			return res, nil
+		}
+	}
+
+	if len(k.MasterKey) > 0 {
+		masterKey, err := slip77.FromMasterKey(k.MasterKey)
+		if err != nil {
+			return nil, err
+		}
+
+		key, _, err := masterKey.DeriveKey(out.Script)
+		if err != nil {
+			return nil, err
+		}
+
+		if res, err := confidential.UnblindOutputWithKey(out, key.Serialize()); err == nil {
+			return res, nil
+		}
+	}
+
+	return nil, ErrUnblindOutput
+}
+
+// unblindOutputs sets the asset, value and blinders of the confidential
+// outputs that can be unblinded with the keys
+func (k *BlindingKeys) unblindOutputs(tx *transaction.Transaction, outputs []MatchedOutput) {
+	for i, out := range outputs {
+		if !out.IsConfidential() || int(out.Index) >= len(tx.Outputs) {
+			continue
+		}
+
+		res, err := k.unblind(tx.Outputs[out.Index])
+		if err != nil {
+			continue
+		}
+
+		outputs[i].Unblinded = true
+		outputs[i].Value = res.Value
+		outputs[i].Asset = elementsutil.AssetHashFromBytes(append([]byte{0x01}, res.Asset...))
+		outputs[i].ValueBlindingFactor = res.ValueBlindingFactor
+		outputs[i].AssetBlindingFactor = res.AssetBlindingFactor
+	}
+}
+
+// splitConfidentialDescriptor splits a ct(<blinding key>,<descriptor>) into
+// the inner descriptor and the blinding keys, other descriptors are returned
+// as they are. The checksum of ct descriptors is dropped since it doesn't apply
+// to the inner one.
+func splitConfidentialDescriptor(desc string) (string, *BlindingKeys, error) {
+	if !strings.HasPrefix(desc, "ct(") {
+		return desc, nil, nil
+	}
+
+	if i := strings.Index(desc, "#"); i >= 0 {
+		desc = desc[:i]
+	}
+	if !strings.HasSuffix(desc, ")") {
+		return "", nil, ErrInvalidConfidentialDescriptor
+	}
+	args := desc[len("ct(") : len(desc)-1]
+
+	// the blinding key is followed by the first top level comma
+	depth, comma := 0, -1
+	for i := 0; i < len(args) && comma < 0; i++ {
+		switch args[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				comma = i
+			}
+		}
+	}
+	if comma <= 0 || comma == len(args)-1 {
+		return "", nil, ErrInvalidConfidentialDescriptor
+	}
+
+	keys, err := parseBlindingKeyExpression(args[:comma])
+	if err != nil {
+		return "", nil, err
+	}
+
+	return args[comma+1:], keys, nil
+}
+
+func parseBlindingKeyExpression(expr string) (*BlindingKeys, error) {
+	if !strings.HasPrefix(expr, "slip77(") || !strings.HasSuffix(expr, ")") {
+		return nil, ErrUnsupportedBlindingKey
+	}
+
+	masterKey, err := ParseBlindingKey(expr[len("slip77(") : len(expr)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlindingKeys{MasterKey: masterKey}, nil
+}
+
+// ParseBlindingKey decodes a hex encoded 32 bytes blinding key
+func ParseBlindingKey(key string) ([]byte, error) {
+	buf, err := hex.DecodeString(key)
+	if err != nil || len(buf) != 32 {
+		return nil, ErrInvalidBlindingKey
+	}
+
+	return buf, nil
+}
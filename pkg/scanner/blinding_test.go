@@ -0,0 +1,160 @@
+package scanner
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/confidential"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/slip77"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+func TestSplitConfidentialDescriptor(t *testing.T) {
+	const masterKey = "b2f6cb0a1b4f8d2bbd0d3bc3c8e8dd47f0e1c3d5a6b7c8d9e0f1a2b3c4d5e6f7"
+	const inner = "elwpkh(xpub6CUGRUonZSQ4TWtTMmzXdrXDtypWKiKrhko4egpiMZbpiaQL2jkwSB1icqYh2cfDfVxdx4df189oLKnC5fSwqPfgyP3hooxujYzAu3fDVmz/0/*)"
+
+	desc, keys, err := splitConfidentialDescriptor("ct(slip77(" + masterKey + ")," + inner + ")#abcdefgh")
+	require.NoError(t, err)
+	require.Equal(t, inner, desc)
+	require.Equal(t, masterKey, hex.EncodeToString(keys.MasterKey))
+
+	desc, keys, err = splitConfidentialDescriptor(inner)
+	require.NoError(t, err)
+	require.Equal(t, inner, desc)
+	require.Nil(t, keys)
+
+	_, _, err = splitConfidentialDescriptor("ct(" + masterKey + "," + inner + ")")
+	require.ErrorIs(t, err, ErrUnsupportedBlindingKey)
+
+	_, _, err = splitConfidentialDescriptor("ct(slip77(00)," + inner + ")")
+	require.ErrorIs(t, err, ErrInvalidBlindingKey)
+
+	_, _, err = splitConfidentialDescriptor("ct(slip77(" + masterKey + "))")
+	require.ErrorIs(t, err, ErrInvalidConfidentialDescriptor)
+}
+
+func TestBlindingKeysUnblindOutputs(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01, 0x02, 0x03}
+	masterKey := randomBytes(t)
+
+	slip, err := slip77.FromMasterKey(masterKey)
+	require.NoError(t, err)
+	blindingKey, blindingPubKey, err := slip.DeriveKey(script)
+	require.NoError(t, err)
+
+	otherKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	asset := randomBytes(t)
+	tx := transaction.NewTx(2)
+	tx.AddOutput(blindOutput(t, blindingPubKey, script, asset, 1000))
+
+	tests := []struct {
+		name      string
+		keys      BlindingKeys
+		unblinded bool
+	}{
+		{
+			name:      "slip77 master key",
+			keys:      BlindingKeys{MasterKey: masterKey},
+			unblinded: true,
+		},
+		{
+			name:      "private keys",
+			keys:      BlindingKeys{PrivateKeys: [][]byte{otherKey.Serialize(), blindingKey.Serialize()}},
+			unblinded: true,
+		},
+		{
+			name:      "wrong private key",
+			keys:      BlindingKeys{PrivateKeys: [][]byte{otherKey.Serialize()}},
+			unblinded: false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			outputs := []MatchedOutput{newMatchedOutput(0, tx.Outputs[0])}
+			require.True(tt, outputs[0].IsConfidential())
+
+			keys := (*BlindingKeys)(nil).merge(test.keys)
+			keys.unblindOutputs(tx, outputs)
+
+			require.Equal(tt, test.unblinded, outputs[0].Unblinded)
+			if test.unblinded {
+				require.Equal(tt, uint64(1000), outputs[0].Value)
+				require.Equal(tt, elementsutil.AssetHashFromBytes(append([]byte{0x01}, asset...)), outputs[0].Asset)
+				require.Len(tt, outputs[0].AssetBlindingFactor, 32)
+				require.Len(tt, outputs[0].ValueBlindingFactor, 32)
+			}
+		})
+	}
+}
+
+func TestBlindingKeysMerge(t *testing.T) {
+	keyA, keyB := []byte{0x01}, []byte{0x02}
+	masterA, masterB := []byte{0x0a}, []byte{0x0b}
+
+	req := newScanRequest(
+		WithBlindingKeys(BlindingKeys{PrivateKeys: [][]byte{keyA}, MasterKey: masterA}),
+		WithBlindingKeys(BlindingKeys{PrivateKeys: [][]byte{keyB}}),
+	)
+	require.Equal(t, [][]byte{keyA, keyB}, req.BlindingKeys.PrivateKeys)
+	require.Equal(t, masterA, req.BlindingKeys.MasterKey)
+
+	WithBlindingKeys(BlindingKeys{MasterKey: masterB})(req)
+	require.Equal(t, masterB, req.BlindingKeys.MasterKey)
+}
+
+func blindOutput(
+	t *testing.T,
+	blindingPubKey *btcec.PublicKey,
+	script, asset []byte,
+	value uint64,
+) *transaction.TxOutput {
+	ephemeralKey, err := btcec.NewPrivateKey()
+	require.NoError(t, err)
+
+	nonce, err := confidential.NonceHash(blindingPubKey.SerializeCompressed(), ephemeralKey.Serialize())
+	require.NoError(t, err)
+
+	assetBlinder := randomBytes(t)
+	var valueBlinder [32]byte
+	copy(valueBlinder[:], randomBytes(t))
+
+	assetCommitment, err := confidential.AssetCommitment(asset, assetBlinder)
+	require.NoError(t, err)
+	valueCommitment, err := confidential.ValueCommitment(value, assetCommitment, valueBlinder[:])
+	require.NoError(t, err)
+
+	rangeProof, err := confidential.RangeProof(confidential.RangeProofArgs{
+		Value:               value,
+		Nonce:               nonce,
+		Asset:               asset,
+		AssetBlindingFactor: assetBlinder,
+		ValueBlindFactor:    valueBlinder,
+		ValueCommit:         valueCommitment,
+		ScriptPubkey:        script,
+	})
+	require.NoError(t, err)
+
+	return &transaction.TxOutput{
+		Asset:      assetCommitment,
+		Value:      valueCommitment,
+		Script:     script,
+		Nonce:      ephemeralKey.PubKey().SerializeCompressed(),
+		RangeProof: rangeProof,
+	}
+}
+
+func randomBytes(t *testing.T) []byte {
+	buf := make([]byte, 32)
+	_, err := rand.Read(buf)
+	require.NoError(t, err)
+	require.False(t, bytes.Equal(buf, make([]byte, 32)))
+	return buf
+}
@@ -0,0 +1,264 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/go-elements/transaction"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+// ErrMissingOutputScript is returned if the transaction to watch has no
+// output script to search in the block filters
+var ErrMissingOutputScript = errors.New("missing output script to watch")
+
+// TxConfirmationWatchItem is used to watch for the confirmation of a
+// transaction, eg. one broadcasted with NodeService.SendTransaction. The
+// output script is the element searched in the block filters.
+// The block including the transaction is reported with 1 confirmation, if the
+// depth is greater than 1 a report is sent for every new block until the
+// transaction has depth confirmations (see WithConfirmationDepth).
+type TxConfirmationWatchItem struct {
+	txHash       chainhash.Hash
+	outputScript []byte
+	depth        uint32
+}
+
+// NewTxConfirmationWatchItem watches for the transaction with the given id,
+// outputScript must be the script of one of its outputs
+func NewTxConfirmationWatchItem(
+	txID string,
+	outputScript []byte,
+	depth uint32,
+) (WatchItem, error) {
+	hash, err := chainhash.NewHashFromStr(txID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(outputScript) == 0 {
+		return nil, ErrMissingOutputScript
+	}
+
+	return &TxConfirmationWatchItem{
+		txHash:       *hash,
+		outputScript: outputScript,
+		depth:        depth,
+	}, nil
+}
+
+// NewTxConfirmationWatchItemFromTx watches for the given transaction, the
+// script of its first output (not the fee one) is searched in the filters
+func NewTxConfirmationWatchItemFromTx(
+	tx *transaction.Transaction,
+	depth uint32,
+) (WatchItem, error) {
+	for _, out := range tx.Outputs {
+		if len(out.Script) > 0 {
+			return NewTxConfirmationWatchItem(tx.TxHash().String(), out.Script, depth)
+		}
+	}
+
+	return nil, ErrMissingOutputScript
+}
+
+func (c *TxConfirmationWatchItem) Bytes() []byte {
+	return c.outputScript
+}
+
+func (c *TxConfirmationWatchItem) Match(tx *transaction.Transaction) *MatchDetails {
+	if tx.TxHash() != c.txHash {
+		return nil
+	}
+
+	details := &MatchDetails{}
+	for i, txOutput := range tx.Outputs {
+		if bytes.Equal(c.outputScript, txOutput.Script) {
+			details.Outputs = append(details.Outputs, newMatchedOutput(i, txOutput))
+		}
+	}
+
+	return details
+}
+
+func (c *TxConfirmationWatchItem) EventType() EventType {
+	return TxConfirmation
+}
+
+func (c *TxConfirmationWatchItem) script() []byte {
+	return c.outputScript
+}
+
+// sameTx returns true if the items watch for the same transaction
+func sameTx(a, b WatchItem) bool {
+	txA, okA := a.(*TxConfirmationWatchItem)
+	txB, okB := b.(*TxConfirmationWatchItem)
+	if okA != okB {
+		return false
+	}
+
+	return !okA || txA.txHash == txB.txHash
+}
+
+// reorgTrackingDepth is the min number of confirmations up to which the
+// reports are tracked to detect the reorgs disconnecting their block
+const reorgTrackingDepth = 6
+
+// confirmationTracker holds the sent reports until their block has the
+// confirmation depth of the request, and at least reorgTrackingDepth
+// confirmations, or until it is disconnected from the chain
+type confirmationTracker struct {
+	tracked []trackedReport
+	locker  sync.Locker
+}
+
+type trackedReport struct {
+	report Report
+	// depth is the number of confirmations up to which they are reported
+	depth uint32
+}
+
+func newConfirmationTracker() *confirmationTracker {
+	return &confirmationTracker{
+		tracked: make([]trackedReport, 0),
+		locker:  new(sync.Mutex),
+	}
+}
+
+func (t *confirmationTracker) track(report Report, depth uint32) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	t.tracked = append(t.tracked, trackedReport{report, depth})
+}
+
+// remove stops tracking the reports of the requests matching the predicate
+func (t *confirmationTracker) remove(match func(req *ScanRequest) bool) {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	tracked := make([]trackedReport, 0, len(t.tracked))
+	for _, v := range t.tracked {
+		if !match(v.report.Request) {
+			tracked = append(tracked, v)
+		}
+	}
+	t.tracked = tracked
+}
+
+// update returns a report for every new confirmation of the tracked reports
+// and a Reverted one for those whose block is not at its height anymore.
+// hashAt returns the hash of the block at the given height of the chain.
+func (t *confirmationTracker) update(
+	tipHeight uint32,
+	hashAt func(height uint32) (*chainhash.Hash, error),
+) []Report {
+	t.locker.Lock()
+	defer t.locker.Unlock()
+
+	reports := make([]Report, 0)
+	tracked := make([]trackedReport, 0, len(t.tracked))
+	for _, v := range t.tracked {
+		reverted, err := isReverted(v.report, tipHeight, hashAt)
+		if err != nil {
+			// retry at the next update
+			tracked = append(tracked, v)
+			continue
+		}
+
+		if reverted {
+			report := v.report
+			report.Confirmations = 0
+			report.Reverted = true
+			reports = append(reports, report)
+			continue
+		}
+
+		confirmations := tipHeight - v.report.BlockHeight + 1
+		for v.report.Confirmations < confirmations && v.report.Confirmations < v.depth {
+			v.report.Confirmations++
+			reports = append(reports, v.report)
+		}
+
+		if confirmations < v.depth || confirmations < reorgTrackingDepth {
+			tracked = append(tracked, v)
+		}
+	}
+	t.tracked = tracked
+
+	return reports
+}
+
+func isReverted(
+	report Report,
+	tipHeight uint32,
+	hashAt func(height uint32) (*chainhash.Hash, error),
+) (bool, error) {
+	if report.BlockHeight > tipHeight {
+		return true, nil
+	}
+
+	hash, err := hashAt(report.BlockHeight)
+	if err != nil {
+		if err == repository.ErrBlockNotFound || err == repository.ErrNoBlocksHeaders {
+			return true, nil
+		}
+		return false, err
+	}
+
+	return !hash.IsEqual(report.BlockHash), nil
+}
+
+// sendConfirmations sends the reports of the new confirmations and of the
+// reverted blocks of the tracked reports, the requests of the clients of the
+// reverted ones are scanned again from the fork point
+func (s *scannerService) sendConfirmations(reportsChan chan<- Report) {
+	tip, err := s.headerDB.ChainTip(context.Background())
+	if err != nil {
+		return
+	}
+
+	reports := s.confirmations.update(tip.Height, func(height uint32) (*chainhash.Hash, error) {
+		return s.headerDB.GetBlockHashByHeight(context.Background(), height)
+	})
+	for _, report := range reports {
+		if report.Reverted {
+			s.revert(report)
+		}
+		reportsChan <- report
+	}
+}
+
+// revert scans again, from the height of the reverted report, the requests of
+// its client, the in flight ones included: the blocks from that height have
+// been replaced by a reorg
+func (s *scannerService) revert(report Report) {
+	clientID := report.Request.ClientID
+	height := report.BlockHeight
+
+	// the outpoints of the reverted transaction are watched again if it is
+	// confirmed on the new fork
+	if report.Transaction != nil {
+		txHash := report.Transaction.TxHash()
+		spendsRevertedTx := func(req *ScanRequest) bool {
+			item, ok := req.Item.(outpointItem)
+			return ok && req.ClientID == clientID && item.outpoint().hash == txHash
+		}
+		s.requestsQueue.remove(spendsRevertedTx)
+		s.rescanQueue.remove(spendsRevertedTx)
+	}
+
+	// the outpoint spent by the reverted transaction is unspent again
+	if _, ok := report.Request.Item.(outpointItem); ok && !report.Request.IsPersistent {
+		req := *report.Request
+		req.StartHeight = height
+		s.queueFor(height).enqueue(&req)
+	}
+
+	ofClient := func(req *ScanRequest) bool { return req.ClientID == clientID }
+	s.requestsQueue.rewind(height, ofClient)
+	s.rescanQueue.rewind(height, ofClient)
+}
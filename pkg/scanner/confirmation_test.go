@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/transaction"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+func TestTxConfirmationWatchItem(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+
+	tx := transaction.NewTx(2)
+	tx.AddInput(transaction.NewTxInput(make([]byte, 32), 0))
+	tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), []byte{}))
+	tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+
+	item, err := NewTxConfirmationWatchItemFromTx(tx, 3)
+	require.NoError(t, err)
+	require.Equal(t, TxConfirmation, item.EventType())
+	require.Equal(t, script, item.Bytes())
+
+	_, err = NewTxConfirmationWatchItemFromTx(transaction.NewTx(2), 1)
+	require.ErrorIs(t, err, ErrMissingOutputScript)
+
+	details := item.Match(tx)
+	require.NotNil(t, details)
+	require.Len(t, details.Outputs, 1)
+	require.Equal(t, uint32(1), details.Outputs[0].Index)
+
+	// another transaction paying to the script doesn't match
+	other := tx.Copy()
+	other.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+	require.Nil(t, item.Match(other))
+
+	otherItem, err := NewTxConfirmationWatchItemFromTx(other, 3)
+	require.NoError(t, err)
+	require.False(t, sameItem(item, otherItem))
+	require.False(t, sameItem(item, &UnspentWatchItem{outputScript: script}))
+}
+
+func TestConfirmationTracker(t *testing.T) {
+	tx := transaction.NewTx(2)
+	tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), []byte{0x51}))
+
+	item, err := NewTxConfirmationWatchItemFromTx(tx, 3)
+	require.NoError(t, err)
+
+	req := newScanRequest(WithWatchItem(item))
+	require.Equal(t, uint32(3), req.confirmationDepth())
+
+	chain := map[uint32]chainhash.Hash{10: {0x0a}, 11: {0x0b}, 12: {0x0c}}
+	hashAt := func(height uint32) (*chainhash.Hash, error) {
+		hash, ok := chain[height]
+		if !ok {
+			return nil, repository.ErrBlockNotFound
+		}
+		return &hash, nil
+	}
+
+	blockHash := chain[10]
+	tracker := newConfirmationTracker()
+	tracker.track(Report{
+		Transaction:   tx,
+		BlockHash:     &blockHash,
+		BlockHeight:   10,
+		Request:       req,
+		Confirmations: 1,
+	}, req.confirmationDepth())
+
+	require.Empty(t, tracker.update(10, hashAt))
+
+	// a report is sent for every new confirmation, up to the depth
+	reports := tracker.update(12, hashAt)
+	require.Len(t, reports, 2)
+	for i, report := range reports {
+		require.Equal(t, uint32(i+2), report.Confirmations)
+		require.Equal(t, uint32(10), report.BlockHeight)
+		require.False(t, report.Reverted)
+	}
+	require.Empty(t, tracker.update(13, hashAt))
+
+	// the block of the report is replaced before the depth is reached
+	unconfirmed := newScanRequest(WithWatchItem(item), WithConfirmationDepth(6))
+	require.Equal(t, uint32(6), unconfirmed.confirmationDepth())
+	tracker.track(Report{BlockHash: &blockHash, BlockHeight: 10, Request: unconfirmed, Confirmations: 1}, 6)
+	tracker.track(Report{BlockHash: &blockHash, BlockHeight: 10, Request: req, Confirmations: 1}, 6)
+	tracker.remove(func(r *ScanRequest) bool { return r == req })
+
+	chain[10] = chainhash.Hash{0xff}
+	reports = tracker.update(12, hashAt)
+	require.Len(t, reports, 1)
+	require.True(t, reports[0].Reverted)
+	require.Zero(t, reports[0].Confirmations)
+	require.Equal(t, unconfirmed, reports[0].Request)
+	require.Empty(t, tracker.update(12, hashAt))
+
+	// untracked requests don't report confirmations
+	require.Zero(t, newScanRequest(WithWatchItem(&UnspentWatchItem{})).confirmationDepth())
+}
+
+func TestConfirmationTrackerReorgDepth(t *testing.T) {
+	chain := map[uint32]chainhash.Hash{10: {0x0a}}
+	hashAt := func(height uint32) (*chainhash.Hash, error) {
+		hash, ok := chain[height]
+		if !ok {
+			return nil, repository.ErrBlockNotFound
+		}
+		return &hash, nil
+	}
+
+	req := newScanRequest(WithWatchItem(&UnspentWatchItem{}))
+	blockHash := chain[10]
+	tracker := newConfirmationTracker()
+	tracker.track(Report{BlockHash: &blockHash, BlockHeight: 10, Request: req}, req.confirmationDepth())
+
+	// no confirmation is reported without a depth, the revert is
+	require.Empty(t, tracker.update(12, hashAt))
+	chain[10] = chainhash.Hash{0xff}
+	reports := tracker.update(12, hashAt)
+	require.Len(t, reports, 1)
+	require.True(t, reports[0].Reverted)
+
+	// the report is not tracked anymore once its block is deep enough
+	chain[10] = blockHash
+	tracker.track(Report{BlockHash: &blockHash, BlockHeight: 10, Request: req}, req.confirmationDepth())
+	require.Empty(t, tracker.update(10+reorgTrackingDepth-1, hashAt))
+	chain[10] = chainhash.Hash{0xff}
+	require.Empty(t, tracker.update(10+reorgTrackingDepth-1, hashAt))
+}
+
+func TestRevertInFlightRequests(t *testing.T) {
+	clientA, clientB := uuid.New(), uuid.New()
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+	}
+
+	// the worker is scanning the requests of both clients at height 7
+	reqA := newScanRequest(WithRequestID(clientA), WithStartBlock(3), WithPersistentWatch(),
+		WithWatchItem(&UnspentWatchItem{outputScript: []byte{0x00, 0x14, 0x01}}))
+	reqB := newScanRequest(WithRequestID(clientB), WithStartBlock(3), WithPersistentWatch(),
+		WithWatchItem(&UnspentWatchItem{outputScript: []byte{0x00, 0x14, 0x02}}))
+	s.rescanQueue.enqueue(reqA)
+	s.rescanQueue.enqueue(reqB)
+	s.rescanQueue.dequeueAtHeight(3)
+	s.rescanQueue.dequeueAtHeight(7)
+
+	// the block at height 5 reported to client A is reverted
+	s.revert(Report{BlockHeight: 5, Request: reqA, Reverted: true})
+
+	require.False(t, s.rescanQueue.isInFlight(reqA))
+	require.True(t, s.rescanQueue.isInFlight(reqB))
+	require.Equal(t, reqA, s.rescanQueue.peek())
+	require.Equal(t, uint32(5), reqA.StartHeight)
+
+	// the requests not scanned up to the fork point yet are left in flight
+	s.rescanQueue.dequeueAtHeight(3)
+	s.revert(Report{BlockHeight: 5, Request: reqB, Reverted: true})
+	require.True(t, s.rescanQueue.isInFlight(reqB))
+}
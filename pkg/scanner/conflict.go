@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+)
+
+// spendKey identifies the spending of a watched outpoint by a client
+type spendKey struct {
+	clientID uuid.UUID
+	outpoint outpointKey
+}
+
+// unconfirmedSpends holds the unconfirmed transactions spending the watched
+// outpoints, the first one seen for each outpoint, until they are confirmed
+// or expired (see unconfirmedExpiry)
+type unconfirmedSpends struct {
+	spends map[spendKey]unconfirmedSpend
+	locker sync.Locker
+}
+
+type unconfirmedSpend struct {
+	txHash chainhash.Hash
+	seen   time.Time
+}
+
+func newUnconfirmedSpends() *unconfirmedSpends {
+	return &unconfirmedSpends{
+		spends: make(map[spendKey]unconfirmedSpend),
+		locker: new(sync.Mutex),
+	}
+}
+
+// add records the outpoints spent by the unconfirmed transaction of the
+// report, it returns the hash of another transaction already spending one of
+// them, if any
+func (u *unconfirmedSpends) add(report Report) *chainhash.Hash {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	now := time.Now()
+	u.expire(now.Add(-unconfirmedExpiry))
+
+	txHash := report.Transaction.TxHash()
+
+	var conflict *chainhash.Hash
+	for _, key := range spendKeys(report) {
+		spend, ok := u.spends[key]
+		if !ok {
+			u.spends[key] = unconfirmedSpend{txHash, now}
+			continue
+		}
+
+		if spend.txHash != txHash && conflict == nil {
+			spentBy := spend.txHash
+			conflict = &spentBy
+		}
+	}
+
+	return conflict
+}
+
+// expire drops the spends seen before the given time, the lock must be held
+func (u *unconfirmedSpends) expire(before time.Time) {
+	for key, spend := range u.spends {
+		if spend.seen.Before(before) {
+			delete(u.spends, key)
+		}
+	}
+}
+
+// confirm drops the outpoints spent by the confirmed transaction of the
+// report, it returns the hash of the unconfirmed transaction that was
+// spending one of them, if not the confirmed one
+func (u *unconfirmedSpends) confirm(report Report) *chainhash.Hash {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	txHash := report.Transaction.TxHash()
+
+	var conflict *chainhash.Hash
+	for _, key := range spendKeys(report) {
+		spend, ok := u.spends[key]
+		if !ok {
+			continue
+		}
+		delete(u.spends, key)
+
+		if spend.txHash != txHash && conflict == nil {
+			spentBy := spend.txHash
+			conflict = &spentBy
+		}
+	}
+
+	return conflict
+}
+
+// remove drops the outpoints watched by the client
+func (u *unconfirmedSpends) remove(clientID uuid.UUID) {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	for key := range u.spends {
+		if key.clientID == clientID {
+			delete(u.spends, key)
+		}
+	}
+}
+
+func spendKeys(report Report) []spendKey {
+	keys := make([]spendKey, 0, len(report.Inputs))
+	for _, in := range report.Inputs {
+		keys = append(keys, spendKey{
+			clientID: report.Request.ClientID,
+			outpoint: outpointKey{hash: in.PrevoutHash, index: in.PrevoutIndex},
+		})
+	}
+	return keys
+}
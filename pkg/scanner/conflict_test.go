@@ -0,0 +1,114 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+func TestResolveConflictingTxs(t *testing.T) {
+	outpoint := chainhash.Hash{0x01}
+
+	s := &scannerService{
+		requestsQueue:     newScanRequestQueue(),
+		rescanQueue:       newScanRequestQueue(),
+		unconfirmed:       newUnconfirmedReports(),
+		unconfirmedSpends: newUnconfirmedSpends(),
+	}
+
+	clientID := uuid.New()
+	spent := newScanRequest(
+		WithRequestID(clientID),
+		WithStartBlock(10),
+		WithWatchItem(&SpentWatchItem{hash: &outpoint, outputScript: []byte{0x51}}),
+	)
+	s.requestsQueue.enqueue(spent)
+
+	spendingTx := func(script []byte) *transaction.Transaction {
+		tx := transaction.NewTx(2)
+		tx.AddInput(transaction.NewTxInput(outpoint[:], 0))
+		tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+		return tx
+	}
+	tx := spendingTx([]byte{0x00, 0x14, 0x01})
+	doubleSpend := spendingTx([]byte{0x00, 0x14, 0x02})
+
+	reportsChan := make(chan Report, 10)
+	s.resolveUnconfirmedTx(tx, reportsChan)
+	s.resolveUnconfirmedTx(doubleSpend, reportsChan)
+	close(reportsChan)
+
+	reports := make([]Report, 0)
+	for report := range reportsChan {
+		reports = append(reports, report)
+	}
+	require.Len(t, reports, 2)
+	require.Equal(t, SpentUtxo, reports[0].EventType())
+	require.Nil(t, reports[0].ConflictTxHash)
+
+	// the second transaction spending the outpoint is a conflict
+	require.Equal(t, Conflict, reports[1].EventType())
+	require.True(t, reports[1].Unconfirmed)
+	require.Equal(t, doubleSpend.TxHash(), reports[1].Transaction.TxHash())
+	require.Equal(t, tx.TxHash(), *reports[1].ConflictTxHash)
+
+	// the double spend is confirmed in place of the first transaction
+	confirmed := Report{Transaction: doubleSpend, Request: spent, Inputs: reports[1].Inputs}
+	conflictTxHash := s.unconfirmedSpends.confirm(confirmed)
+	require.NotNil(t, conflictTxHash)
+	require.Equal(t, tx.TxHash(), *conflictTxHash)
+	require.Nil(t, s.unconfirmedSpends.confirm(confirmed))
+
+	// the confirmed transaction is the one seen in the mempool
+	require.Nil(t, s.unconfirmedSpends.add(reports[0]))
+	require.Nil(t, s.unconfirmedSpends.confirm(reports[0]))
+
+	s.unconfirmedSpends.add(reports[0])
+	s.unconfirmedSpends.remove(clientID)
+	require.Nil(t, s.unconfirmedSpends.confirm(confirmed))
+}
+
+func TestResolveConflictsOnly(t *testing.T) {
+	outpoint := chainhash.Hash{0x01}
+
+	s := &scannerService{
+		requestsQueue:     newScanRequestQueue(),
+		rescanQueue:       newScanRequestQueue(),
+		unconfirmed:       newUnconfirmedReports(),
+		unconfirmedSpends: newUnconfirmedSpends(),
+	}
+
+	s.requestsQueue.enqueue(newScanRequest(
+		WithRequestID(uuid.New()),
+		WithStartBlock(10),
+		WithWatchItem(&SpentWatchItem{hash: &outpoint, outputScript: []byte{0x51}}),
+		withConflictsOnly(),
+	))
+
+	spendingTx := func(script []byte) *transaction.Transaction {
+		tx := transaction.NewTx(2)
+		tx.AddInput(transaction.NewTxInput(outpoint[:], 0))
+		tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+		return tx
+	}
+	tx := spendingTx([]byte{0x00, 0x14, 0x01})
+	doubleSpend := spendingTx([]byte{0x00, 0x14, 0x02})
+
+	reportsChan := make(chan Report, 10)
+	s.resolveUnconfirmedTx(tx, reportsChan)
+	s.resolveUnconfirmedTx(doubleSpend, reportsChan)
+	close(reportsChan)
+
+	// the spending is not reported, the double spend is
+	reports := make([]Report, 0)
+	for report := range reportsChan {
+		reports = append(reports, report)
+	}
+	require.Len(t, reports, 1)
+	require.Equal(t, Conflict, reports[0].EventType())
+	require.Equal(t, doubleSpend.TxHash(), reports[0].Transaction.TxHash())
+	require.Equal(t, tx.TxHash(), *reports[0].ConflictTxHash)
+}
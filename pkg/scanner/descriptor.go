@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/go-elements/descriptor"
+)
+
+// DefaultGapLimit is the number of consecutive unused scripts watched after
+// the last used one of a range descriptor (BIP44).
+const DefaultGapLimit = 20
+
+// ScriptDerivation identifies the descriptor script matched by a report.
+type ScriptDerivation struct {
+	// Descriptor is the descriptor the script is derived from, as given by the client
+	Descriptor string
+	// Branch is the multipath step (eg. 0 receive, 1 change), or the path
+	// step before the range wildcard
+	Branch uint32
+	// Index is the range index of the script, 0 for non range descriptors
+	Index uint32
+}
+
+// WalletState is the state of the descriptors watched by a client that can't
+// be rebuilt by scanning from the resume height (see WithWalletState).
+type WalletState struct {
+	// Unspents are the outpoints funded to the descriptor scripts, those
+	// funded before the start height are tracked as if they were scanned
+	Unspents []WalletOutpoint
+	// LastUsedIndexes are the highest indexes of the range descriptor scripts
+	// that received funds, the ranges are derived up to the gap limit after them
+	LastUsedIndexes []ScriptDerivation
+}
+
+// lastUsedIndex returns the saved last used index of the descriptor branch
+func (w *WalletState) lastUsedIndex(desc string, branch uint32) (uint32, bool) {
+	if w == nil {
+		return 0, false
+	}
+
+	for _, v := range w.LastUsedIndexes {
+		if v.Descriptor == desc && v.Branch == branch {
+			return v.Index, true
+		}
+	}
+
+	return 0, false
+}
+
+// WalletOutpoint is an outpoint funded to a descriptor script.
+type WalletOutpoint struct {
+	Hash        chainhash.Hash
+	Index       uint32
+	Script      []byte
+	BlockHeight uint32
+}
+
+// rangeDescriptor keeps the derivation state of a range wallet descriptor
+// watched by a client: scripts are derived up to gapLimit after the last one
+// that received funds.
+type rangeDescriptor struct {
+	wallet   descriptor.Wallet
+	source   string
+	branch   uint32
+	gapLimit uint32
+	// nextIndex is the first index not derived yet
+	nextIndex uint32
+	locker    *sync.Mutex
+}
+
+func newRangeDescriptor(
+	wallet descriptor.Wallet,
+	source string,
+	branch uint32,
+	gapLimit uint32,
+) *rangeDescriptor {
+	return &rangeDescriptor{
+		wallet:   wallet,
+		source:   source,
+		branch:   branch,
+		gapLimit: gapLimit,
+		locker:   new(sync.Mutex),
+	}
+}
+
+// derivedScript is a script derived from a range descriptor
+type derivedScript struct {
+	derivation *ScriptDerivation
+	script     []byte
+}
+
+// initialWindow derives the first gapLimit scripts of the descriptor
+func (d *rangeDescriptor) initialWindow() ([]derivedScript, error) {
+	return d.deriveUpTo(d.gapLimit - 1)
+}
+
+// extend derives the scripts needed to keep gapLimit unused scripts after
+// the given used index, it returns only the newly derived ones
+func (d *rangeDescriptor) extend(usedIndex uint32) ([]derivedScript, error) {
+	return d.deriveUpTo(usedIndex + d.gapLimit)
+}
+
+func (d *rangeDescriptor) deriveUpTo(lastIndex uint32) ([]derivedScript, error) {
+	d.locker.Lock()
+	defer d.locker.Unlock()
+
+	scripts := make([]derivedScript, 0)
+	for ; d.nextIndex <= lastIndex; d.nextIndex++ {
+		res, err := d.wallet.Script(descriptor.WithIndex(d.nextIndex))
+		if err != nil {
+			return nil, err
+		}
+
+		scripts = append(scripts, derivedScript{
+			derivation: &ScriptDerivation{
+				Descriptor: d.source,
+				Branch:     d.branch,
+				Index:      d.nextIndex,
+			},
+			script: res[0].Script,
+		})
+	}
+
+	return scripts, nil
+}
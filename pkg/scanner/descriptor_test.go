@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/descriptor"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+const rangeDescriptorStr = "elwpkh([ffffffff/13']xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH/1/2/*)"
+
+func TestRangeDescriptorGapLimit(t *testing.T) {
+	wallet, err := descriptor.Parse(rangeDescriptorStr)
+	require.NoError(t, err)
+
+	rangeDesc := newRangeDescriptor(wallet, rangeDescriptorStr, 2, 5)
+
+	scripts, err := rangeDesc.initialWindow()
+	require.NoError(t, err)
+	require.Len(t, scripts, 5)
+	for i, s := range scripts {
+		require.Equal(t, uint32(i), s.derivation.Index)
+		require.Equal(t, uint32(2), s.derivation.Branch)
+		require.Equal(t, rangeDescriptorStr, s.derivation.Descriptor)
+
+		expected, err := wallet.Script(descriptor.WithIndex(uint32(i)))
+		require.NoError(t, err)
+		require.Equal(t, expected[0].Script, s.script)
+	}
+
+	// index 0 used, 5 unused scripts are already derived
+	scripts, err = rangeDesc.extend(0)
+	require.NoError(t, err)
+	require.Len(t, scripts, 1)
+	require.Equal(t, uint32(5), scripts[0].derivation.Index)
+
+	// index 3 used, scripts up to 8 are derived
+	scripts, err = rangeDesc.extend(3)
+	require.NoError(t, err)
+	require.Len(t, scripts, 3)
+	require.Equal(t, uint32(6), scripts[0].derivation.Index)
+	require.Equal(t, uint32(8), scripts[2].derivation.Index)
+
+	// a lower index doesn't derive anything
+	scripts, err = rangeDesc.extend(1)
+	require.NoError(t, err)
+	require.Len(t, scripts, 0)
+}
+
+func TestExpandMultipath(t *testing.T) {
+	const xpub = "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"
+
+	expanded, err := expandMultipath("elwpkh(" + xpub + "/<0;1>/*)#abcdefgh")
+	require.NoError(t, err)
+	require.Len(t, expanded, 2)
+	require.Equal(t, "elwpkh("+xpub+"/0/*)", expanded[0].descriptor)
+	require.Equal(t, uint32(0), expanded[0].branch)
+	require.Equal(t, "elwpkh("+xpub+"/1/*)", expanded[1].descriptor)
+	require.Equal(t, uint32(1), expanded[1].branch)
+
+	for _, v := range expanded {
+		_, err := descriptor.Parse(v.descriptor)
+		require.NoError(t, err)
+	}
+
+	expanded, err = expandMultipath(rangeDescriptorStr)
+	require.NoError(t, err)
+	require.Len(t, expanded, 1)
+	require.Equal(t, rangeDescriptorStr, expanded[0].descriptor)
+	require.Equal(t, uint32(2), expanded[0].branch)
+
+	for _, invalid := range []string{
+		"elwpkh(" + xpub + "/<0>/*)",
+		"elwpkh(" + xpub + "/<0;a>/*)",
+		"elwpkh(" + xpub + "/<0;1>/<0;1>/*)",
+		"elwpkh(" + xpub + "/>0;1</*)",
+	} {
+		_, err := expandMultipath(invalid)
+		require.ErrorIs(t, err, ErrInvalidMultipath, invalid)
+	}
+}
+
+func TestWatchDescriptorWalletsState(t *testing.T) {
+	wallet, err := descriptor.Parse(rangeDescriptorStr)
+	require.NoError(t, err)
+	scripts, err := wallet.Script(descriptor.WithIndex(1))
+	require.NoError(t, err)
+	script := scripts[0].Script
+
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+		headerDB:      &fakeHeaderDB{},
+		filterDB:      &fakeFilterDB{},
+		gapLimit:      2,
+	}
+
+	// the first outpoint is funded before the resume height, the second one
+	// is found again by the scan
+	funded := chainhash.Hash{0x01}
+	state := WalletState{
+		Unspents: []WalletOutpoint{
+			{Hash: funded, Index: 0, Script: script, BlockHeight: 5},
+			{Hash: chainhash.Hash{0x02}, Index: 1, Script: script, BlockHeight: 10},
+		},
+	}
+	require.NoError(t, s.WatchDescriptorWallets(
+		uuid.New(),
+		[]string{rangeDescriptorStr},
+		[]EventType{UnspentUtxo, SpentUtxo},
+		10,
+		WithWalletState(state),
+	))
+
+	spent := make([]*SpentWatchItem, 0)
+	for _, req := range s.requestsQueue.byHeight[10] {
+		if item, ok := req.Item.(*SpentWatchItem); ok {
+			spent = append(spent, item)
+		}
+	}
+	require.Len(t, spent, 1)
+	require.Equal(t, outpointKey{funded, 0}, spent[0].outpoint())
+	require.Equal(t, uint32(1), spent[0].derivation.Index)
+}
+
+func TestWatchDescriptorWalletsConflictTracking(t *testing.T) {
+	wallet, err := descriptor.Parse(rangeDescriptorStr)
+	require.NoError(t, err)
+	scripts, err := wallet.Script(descriptor.WithIndex(1))
+	require.NoError(t, err)
+
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+		headerDB:      &fakeHeaderDB{},
+		filterDB:      &fakeFilterDB{},
+		gapLimit:      2,
+	}
+
+	// the spending of the utxos is watched for conflicts only
+	funded := chainhash.Hash{0x01}
+	state := WalletState{
+		Unspents: []WalletOutpoint{{Hash: funded, Script: scripts[0].Script, BlockHeight: 5}},
+	}
+	require.NoError(t, s.WatchDescriptorWallets(
+		uuid.New(),
+		[]string{rangeDescriptorStr},
+		[]EventType{UnspentUtxo},
+		10,
+		WithWalletState(state),
+	))
+
+	spent := make([]*ScanRequest, 0)
+	for _, req := range s.requestsQueue.byHeight[10] {
+		if _, ok := req.Item.(*SpentWatchItem); ok {
+			spent = append(spent, req)
+		}
+	}
+	require.Len(t, spent, 1)
+	require.True(t, spent[0].conflictsOnly)
+	require.Equal(t, outpointKey{funded, 0}, spent[0].Item.(*SpentWatchItem).outpoint())
+}
+
+func TestWatchDescriptorWalletsUsedIndex(t *testing.T) {
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+		headerDB:      &fakeHeaderDB{},
+		filterDB:      &fakeFilterDB{},
+		gapLimit:      2,
+	}
+
+	// the range is derived up to the gap limit after the saved index
+	state := WalletState{
+		LastUsedIndexes: []ScriptDerivation{{Descriptor: rangeDescriptorStr, Branch: 2, Index: 30}},
+	}
+	require.NoError(t, s.WatchDescriptorWallets(
+		uuid.New(),
+		[]string{rangeDescriptorStr},
+		[]EventType{UnspentUtxo},
+		10,
+		WithWalletState(state),
+	))
+
+	indexes := make([]uint32, 0)
+	for _, req := range s.requestsQueue.byHeight[10] {
+		if item, ok := req.Item.(*UnspentWatchItem); ok {
+			indexes = append(indexes, item.derivation.Index)
+		}
+	}
+	require.Len(t, indexes, 33)
+	require.Contains(t, indexes, uint32(32))
+}
+
+func TestWatchDescriptorWalletsAssetTracking(t *testing.T) {
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+		headerDB:      &fakeHeaderDB{},
+		filterDB:      &fakeFilterDB{},
+		gapLimit:      2,
+	}
+
+	events := []EventType{AssetUtxo}
+	require.ErrorIs(t, s.WatchDescriptorWallets(
+		uuid.New(), []string{rangeDescriptorStr}, events, 10,
+	), ErrMissingTrackedAsset)
+
+	require.NoError(t, s.WatchDescriptorWallets(
+		uuid.New(), []string{rangeDescriptorStr}, events, 10,
+		WithAssetTracking(issuedAsset),
+	))
+
+	// every derived script is watched for the asset, the unspent items only
+	// discover the outpoints
+	assets, unspents := 0, 0
+	for _, req := range s.requestsQueue.byHeight[10] {
+		switch item := req.Item.(type) {
+		case *AssetWatchItem:
+			require.Equal(t, issuedAsset, item.asset)
+			require.False(t, req.Silent)
+			require.Empty(t, req.TrackedAsset)
+			assets++
+		case *UnspentWatchItem:
+			require.True(t, req.Silent)
+			unspents++
+		}
+	}
+	require.Equal(t, 2, assets)
+	require.Equal(t, unspents, assets)
+}
+
+func TestWatchDescriptorWalletsPruned(t *testing.T) {
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+		headerDB:      &fakeHeaderDB{},
+		filterDB:      &fakeFilterDB{prunedHeight: 100},
+		gapLimit:      2,
+	}
+	events := []EventType{UnspentUtxo}
+
+	// the pruned filters can't be fetched again
+	err := s.WatchDescriptorWallets(uuid.New(), []string{rangeDescriptorStr}, events, 10)
+	require.ErrorIs(t, err, repository.ErrPruned)
+	require.NoError(t, s.WatchDescriptorWallets(uuid.New(), []string{rangeDescriptorStr}, events, 101))
+
+	s.filterFetcher = &fakeFilterFetcher{}
+	require.NoError(t, s.WatchDescriptorWallets(uuid.New(), []string{rangeDescriptorStr}, events, 10))
+}
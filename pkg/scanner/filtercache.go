@@ -0,0 +1,59 @@
+package scanner
+
+import (
+	"sync"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+// filterCache holds the last filters fetched on demand, those of a range are
+// fetched at once but are matched one block at a time. The oldest filters are
+// evicted once the cache is full.
+type filterCache struct {
+	filters map[chainhash.Hash]*repository.FilterEntry
+	order   []chainhash.Hash
+	size    int
+	locker  sync.Locker
+}
+
+func newFilterCache(size int) *filterCache {
+	return &filterCache{
+		filters: make(map[chainhash.Hash]*repository.FilterEntry),
+		order:   make([]chainhash.Hash, 0, size),
+		size:    size,
+		locker:  new(sync.Mutex),
+	}
+}
+
+func (c *filterCache) get(blockHash chainhash.Hash) (*repository.FilterEntry, bool) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	entry, ok := c.filters[blockHash]
+	return entry, ok
+}
+
+func (c *filterCache) add(entries ...*repository.FilterEntry) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	for _, entry := range entries {
+		blockHash, err := chainhash.NewHash(entry.Key.BlockHash)
+		if err != nil {
+			continue
+		}
+
+		if _, ok := c.filters[*blockHash]; ok {
+			continue
+		}
+
+		if len(c.order) == c.size {
+			delete(c.filters, c.order[0])
+			c.order = c.order[1:]
+		}
+
+		c.filters[*blockHash] = entry
+		c.order = append(c.order, *blockHash)
+	}
+}
@@ -0,0 +1,97 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+// fakeFilterFetcher serves the filters of fakeHeaderDB, the first fetches fail
+type fakeFilterFetcher struct {
+	headerDB *fakeHeaderDB
+	filters  map[chainhash.Hash]*repository.FilterEntry
+	failures int
+	calls    int
+}
+
+func (f *fakeFilterFetcher) FetchFilters(
+	_ context.Context,
+	startHeight uint32,
+	stopHash chainhash.Hash,
+) ([]*repository.FilterEntry, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, errors.New("timeout")
+	}
+
+	entries := make([]*repository.FilterEntry, 0)
+	for height := startHeight; ; height++ {
+		hash := f.headerDB.hashes[height]
+		entries = append(entries, f.filters[*hash])
+		if hash.IsEqual(&stopHash) {
+			return entries, nil
+		}
+	}
+}
+
+func TestFilterCache(t *testing.T) {
+	cache := newFilterCache(2)
+	entries := make([]*repository.FilterEntry, 0)
+	for i := byte(1); i <= 3; i++ {
+		hash := &chainhash.Hash{i}
+		entries = append(entries, newFilterEntry(t, hash, [][]byte{hash.CloneBytes()}))
+	}
+	cache.add(entries...)
+
+	// the oldest filter is evicted
+	_, ok := cache.get(chainhash.Hash{1})
+	require.False(t, ok)
+	entry, ok := cache.get(chainhash.Hash{3})
+	require.True(t, ok)
+	require.Equal(t, entries[2], entry)
+}
+
+func TestFetchFilterRange(t *testing.T) {
+	headerDB := &fakeHeaderDB{hashes: make(map[uint32]*chainhash.Hash)}
+	fetcher := &fakeFilterFetcher{
+		headerDB: headerDB,
+		filters:  make(map[chainhash.Hash]*repository.FilterEntry),
+		failures: 1,
+	}
+	for height := uint32(1); height <= 5; height++ {
+		hash := &chainhash.Hash{byte(height)}
+		headerDB.hashes[height] = hash
+		fetcher.filters[*hash] = newFilterEntry(t, hash, [][]byte{hash.CloneBytes()})
+	}
+
+	s := &scannerService{
+		headerDB:    headerDB,
+		genesisHash: &chainhash.Hash{},
+		quitCh:      make(chan struct{}),
+	}
+	WithFilterFetcher(fetcher)(s)
+
+	// the failed fetch is tried again, the whole range up to the tip is
+	// fetched at once
+	filter, err := s.fetchFilter(2, headerDB.hashes[2])
+	require.NoError(t, err)
+	require.Equal(t, fetcher.filters[*headerDB.hashes[2]], filter)
+	require.Equal(t, 2, fetcher.calls)
+
+	for height := uint32(3); height <= 5; height++ {
+		filter, err := s.fetchFilter(height, headerDB.hashes[height])
+		require.NoError(t, err)
+		require.Equal(t, fetcher.filters[*headerDB.hashes[height]], filter)
+	}
+	require.Equal(t, 2, fetcher.calls)
+
+	// the filter is not found once all the attempts fail
+	fetcher.calls, fetcher.failures = 0, filterFetchAttempts
+	_, err = s.fetchFilter(1, headerDB.hashes[1])
+	require.ErrorIs(t, err, repository.ErrFilterNotFound)
+	require.Equal(t, filterFetchAttempts, fetcher.calls)
+}
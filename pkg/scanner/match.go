@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+// MatchDetails says which outputs and inputs of a transaction match a watch item
+type MatchDetails struct {
+	Outputs []MatchedOutput
+	Inputs  []MatchedInput
+}
+
+// MatchedOutput is a transaction output matching a watch item. Value and Asset
+// are set if they are explicit, ValueCommitment and AssetCommitment otherwise.
+type MatchedOutput struct {
+	Index  uint32
+	Script []byte
+
+	Value           uint64
+	Asset           string
+	ValueCommitment []byte
+	AssetCommitment []byte
+
+	// Unblinded is set if the confidential output has been unblinded with
+	// the request blinding keys, Value and Asset are set together with the
+	// blinding factors
+	Unblinded           bool
+	ValueBlindingFactor []byte
+	AssetBlindingFactor []byte
+}
+
+// MatchedInput is a transaction input spending a watched outpoint, Issuance
+// is set if the input issues (or reissues) an asset
+type MatchedInput struct {
+	Index        uint32
+	PrevoutHash  chainhash.Hash
+	PrevoutIndex uint32
+	Issuance     *MatchedIssuance
+}
+
+// IsConfidential returns true if the value or the asset of the output is blinded
+func (o MatchedOutput) IsConfidential() bool {
+	return len(o.ValueCommitment) > 0 || len(o.AssetCommitment) > 0
+}
+
+func newMatchedOutput(index int, out *transaction.TxOutput) MatchedOutput {
+	matched := MatchedOutput{
+		Index:  uint32(index),
+		Script: out.Script,
+	}
+
+	if value, err := elementsutil.ValueFromBytes(out.Value); err == nil {
+		matched.Value = value
+	} else {
+		matched.ValueCommitment = out.Value
+	}
+
+	if len(out.Asset) == 33 && out.Asset[0] == 0x01 {
+		matched.Asset = elementsutil.AssetHashFromBytes(out.Asset)
+	} else {
+		matched.AssetCommitment = out.Asset
+	}
+
+	return matched
+}
+
+// newMatchedInput returns the matched input, if its issuance can't be parsed
+// the error is returned together with the input without the issuance
+func newMatchedInput(index int, in *transaction.TxInput) (MatchedInput, error) {
+	hash, err := chainhash.NewHash(in.Hash)
+	if err != nil {
+		return MatchedInput{}, err
+	}
+
+	matched := MatchedInput{
+		Index:        uint32(index),
+		PrevoutHash:  *hash,
+		PrevoutIndex: in.Index,
+	}
+
+	if in.Issuance != nil {
+		issuance, err := newMatchedIssuance(in)
+		if err != nil {
+			return matched, err
+		}
+		matched.Issuance = issuance
+	}
+
+	return matched, nil
+}
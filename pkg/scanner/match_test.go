@@ -0,0 +1,51 @@
+package scanner
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+func TestWatchItemMatchDetails(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+	prevout := chainhash.Hash{0x02}
+	asset := "5ac9f65c0efcc4775e0baec4ec03abdde22473cd3cf33c0419ca290e0751b225"
+
+	assetBytes, err := elementsutil.AssetHashToBytes(asset)
+	require.NoError(t, err)
+	valueBytes, err := elementsutil.ValueToBytes(1000)
+	require.NoError(t, err)
+	valueCommitment := append([]byte{0x08}, bytes.Repeat([]byte{0x01}, 32)...)
+	assetCommitment := append([]byte{0x0a}, bytes.Repeat([]byte{0x02}, 32)...)
+
+	tx := transaction.NewTx(2)
+	tx.AddInput(transaction.NewTxInput(bytes.Repeat([]byte{0x01}, 32), 0))
+	tx.AddInput(transaction.NewTxInput(prevout[:], 1))
+	tx.AddOutput(transaction.NewTxOutput(assetBytes, valueBytes, []byte{0x51}))
+	tx.AddOutput(transaction.NewTxOutput(assetBytes, valueBytes, script))
+	tx.AddOutput(transaction.NewTxOutput(assetCommitment, valueCommitment, script))
+
+	unspent := &UnspentWatchItem{outputScript: script}
+	details := unspent.Match(tx)
+	require.NotNil(t, details)
+	require.Empty(t, details.Inputs)
+	require.Equal(t, []MatchedOutput{
+		{Index: 1, Script: script, Value: 1000, Asset: asset},
+		{Index: 2, Script: script, ValueCommitment: valueCommitment, AssetCommitment: assetCommitment},
+	}, details.Outputs)
+	require.False(t, details.Outputs[0].IsConfidential())
+	require.True(t, details.Outputs[1].IsConfidential())
+
+	spent := &SpentWatchItem{hash: &prevout, index: 1, outputScript: script}
+	details = spent.Match(tx)
+	require.NotNil(t, details)
+	require.Empty(t, details.Outputs)
+	require.Equal(t, []MatchedInput{{Index: 1, PrevoutHash: prevout, PrevoutIndex: 1}}, details.Inputs)
+
+	require.Nil(t, (&UnspentWatchItem{outputScript: []byte{0x52}}).Match(tx))
+	require.Nil(t, (&SpentWatchItem{hash: &prevout, index: 0}).Match(tx))
+}
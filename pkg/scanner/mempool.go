@@ -0,0 +1,176 @@
+package scanner
+
+import (
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+// MempoolNotifier sends the transactions added to the mempool (eg. the node
+// receiving them from its peers).
+type MempoolNotifier interface {
+	NotifyUnconfirmedTxs() <-chan *transaction.Transaction
+}
+
+// WithMempoolNotifier makes the scanner match the UnspentUtxo and SpentUtxo
+// items against the unconfirmed transactions, those are reported as Unconfirmed
+func WithMempoolNotifier(notifier MempoolNotifier) ServiceOption {
+	return func(s *scannerService) {
+		s.mempoolNotifier = notifier
+	}
+}
+
+// unconfirmedExpiry is the time after which an unconfirmed transaction is
+// assumed evicted from the mempool, the default expiry of the nodes
+const unconfirmedExpiry = 14 * 24 * time.Hour
+
+// unconfirmedKey identifies the report of an unconfirmed transaction, the
+// watch item is kept by the requests watching it at the next heights
+type unconfirmedKey struct {
+	clientID uuid.UUID
+	txHash   chainhash.Hash
+	item     WatchItem
+}
+
+// unconfirmedReports holds the keys of the unconfirmed transactions reported,
+// with the time they have been seen, until they are confirmed or expired
+type unconfirmedReports struct {
+	reported map[unconfirmedKey]time.Time
+	locker   sync.Locker
+}
+
+func newUnconfirmedReports() *unconfirmedReports {
+	return &unconfirmedReports{
+		reported: make(map[unconfirmedKey]time.Time),
+		locker:   new(sync.Mutex),
+	}
+}
+
+// add returns false if the transaction has already been reported, the
+// transactions not confirmed within unconfirmedExpiry are dropped
+func (u *unconfirmedReports) add(key unconfirmedKey) bool {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	now := time.Now()
+	u.expire(now.Add(-unconfirmedExpiry))
+
+	if _, ok := u.reported[key]; ok {
+		return false
+	}
+	u.reported[key] = now
+	return true
+}
+
+// expire drops the transactions seen before the given time, the lock must
+// be held
+func (u *unconfirmedReports) expire(before time.Time) {
+	for key, seen := range u.reported {
+		if seen.Before(before) {
+			delete(u.reported, key)
+		}
+	}
+}
+
+// confirm returns true if the transaction has been reported unconfirmed,
+// the key is dropped
+func (u *unconfirmedReports) confirm(key unconfirmedKey) bool {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	if _, ok := u.reported[key]; !ok {
+		return false
+	}
+	delete(u.reported, key)
+	return true
+}
+
+// remove drops the transactions reported to the client
+func (u *unconfirmedReports) remove(clientID uuid.UUID) {
+	u.locker.Lock()
+	defer u.locker.Unlock()
+
+	for key := range u.reported {
+		if key.clientID == clientID {
+			delete(u.reported, key)
+		}
+	}
+}
+
+func reportKey(report Report) unconfirmedKey {
+	return unconfirmedKey{
+		clientID: report.Request.ClientID,
+		txHash:   report.Transaction.TxHash(),
+		item:     report.Request.Item,
+	}
+}
+
+// isMempoolWatched returns true if the request is matched against the
+// unconfirmed transactions
+func isMempoolWatched(req *ScanRequest) bool {
+	if req.Silent {
+		return false
+	}
+
+	switch req.Item.(type) {
+	case *UnspentWatchItem, *SpentWatchItem:
+		return true
+	default:
+		return false
+	}
+}
+
+// mempoolListener reports the unconfirmed transactions matching the queued
+// requests until the scanner is stopped
+func (s *scannerService) mempoolListener(
+	txs <-chan *transaction.Transaction,
+	reportsChan chan<- Report,
+) {
+	for {
+		select {
+		case <-s.quitCh:
+			return
+		case tx, ok := <-txs:
+			if !ok {
+				return
+			}
+
+			s.resolveUnconfirmedTx(tx, reportsChan)
+		}
+	}
+}
+
+// resolveUnconfirmedTx sends an Unconfirmed report for every request matching
+// the transaction, the requests are not resolved: they are matched again
+// when the transaction is confirmed. The report is a Conflict if the
+// transaction spends an outpoint already spent by another unconfirmed one.
+func (s *scannerService) resolveUnconfirmedTx(
+	tx *transaction.Transaction,
+	reportsChan chan<- Report,
+) {
+	matches := append(
+		s.requestsQueue.matchAll(tx, isMempoolWatched),
+		s.rescanQueue.matchAll(tx, isMempoolWatched)...,
+	)
+
+	for _, match := range matches {
+		report := newTxReport(tx, match)
+		report.Unconfirmed = true
+
+		// the mempool may relay the transaction again
+		if !s.unconfirmed.add(reportKey(report)) {
+			continue
+		}
+		// the transaction conflicts with another one spending the same
+		// watched outpoints
+		report.ConflictTxHash = s.unconfirmedSpends.add(report)
+		if report.Request.conflictsOnly && report.ConflictTxHash == nil {
+			continue
+		}
+
+		reportsChan <- report
+	}
+}
@@ -0,0 +1,91 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+func TestResolveUnconfirmedTx(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+
+	s := &scannerService{
+		requestsQueue:     newScanRequestQueue(),
+		rescanQueue:       newScanRequestQueue(),
+		unconfirmed:       newUnconfirmedReports(),
+		unconfirmedSpends: newUnconfirmedSpends(),
+	}
+
+	clientID := uuid.New()
+	unspent := newScanRequest(
+		WithRequestID(clientID),
+		WithStartBlock(10),
+		WithWatchItem(&UnspentWatchItem{outputScript: script}),
+	)
+	silent := newScanRequest(
+		WithRequestID(clientID),
+		WithStartBlock(10),
+		WithWatchItem(&UnspentWatchItem{outputScript: script}),
+		WithSilentWatch(),
+	)
+	asset := newScanRequest(
+		WithRequestID(clientID),
+		WithStartBlock(10),
+		WithWatchItem(&AssetWatchItem{UnspentWatchItem: UnspentWatchItem{outputScript: script}}),
+	)
+	s.requestsQueue.enqueue(unspent)
+	s.requestsQueue.enqueue(silent)
+	s.rescanQueue.enqueue(asset)
+
+	tx := transaction.NewTx(2)
+	tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+
+	reportsChan := make(chan Report, 10)
+	s.resolveUnconfirmedTx(tx, reportsChan)
+	// the mempool relays the tx again
+	s.resolveUnconfirmedTx(tx, reportsChan)
+	close(reportsChan)
+
+	reports := make([]Report, 0)
+	for report := range reportsChan {
+		reports = append(reports, report)
+	}
+	require.Len(t, reports, 1)
+	require.True(t, reports[0].Unconfirmed)
+	require.Nil(t, reports[0].BlockHash)
+	require.Equal(t, unspent, reports[0].Request)
+	require.Len(t, reports[0].Outputs, 1)
+
+	// the request is still queued, to be resolved by the confirmed tx
+	require.Equal(t, unspent, s.requestsQueue.peek())
+
+	// the request watching the next height keeps the item
+	next := newScanRequest(WithRequestID(clientID), WithWatchItem(unspent.Item))
+	confirmed := Report{Transaction: tx, Request: next}
+	require.True(t, s.unconfirmed.confirm(reportKey(confirmed)))
+	require.False(t, s.unconfirmed.confirm(reportKey(confirmed)))
+
+	s.unconfirmed.add(reportKey(confirmed))
+	s.unconfirmed.remove(clientID)
+	require.False(t, s.unconfirmed.confirm(reportKey(confirmed)))
+}
+
+func TestUnconfirmedReportsExpiry(t *testing.T) {
+	unconfirmed := newUnconfirmedReports()
+	stale := unconfirmedKey{clientID: uuid.New()}
+	fresh := unconfirmedKey{clientID: uuid.New()}
+
+	require.True(t, unconfirmed.add(stale))
+	// the tx has not been confirmed within the expiry
+	unconfirmed.reported[stale] = time.Now().Add(-unconfirmedExpiry - time.Minute)
+
+	require.True(t, unconfirmed.add(fresh))
+	require.False(t, unconfirmed.confirm(stale))
+	require.True(t, unconfirmed.confirm(fresh))
+
+	// an expired tx relayed again is reported again
+	require.True(t, unconfirmed.add(stale))
+}
@@ -0,0 +1,81 @@
+package scanner
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidMultipath = errors.New("invalid multipath descriptor")
+
+	// rangeBranchRegexp matches the path step before the range wildcard
+	rangeBranchRegexp = regexp.MustCompile(`/(\d+)/\*`)
+)
+
+// branchDescriptor is a single path descriptor, obtained by expanding a
+// multipath one
+type branchDescriptor struct {
+	descriptor string
+	branch     uint32
+}
+
+// expandMultipath turns a multipath descriptor (eg. wpkh(xpub/<0;1>/*)) into
+// one descriptor per branch, other descriptors are returned as they are.
+// The checksum of multipath descriptors is dropped since it doesn't apply to
+// the expanded ones.
+func expandMultipath(desc string) ([]branchDescriptor, error) {
+	start := strings.Index(desc, "<")
+	if start < 0 {
+		return []branchDescriptor{{
+			descriptor: desc,
+			branch:     rangeBranch(desc),
+		}}, nil
+	}
+
+	end := strings.Index(desc, ">")
+	if end < start || strings.Count(desc, "<") > 1 || strings.Count(desc, ">") > 1 {
+		return nil, ErrInvalidMultipath
+	}
+
+	if i := strings.Index(desc, "#"); i >= 0 {
+		desc = desc[:i]
+	}
+
+	steps := strings.Split(desc[start+1:end], ";")
+	if len(steps) < 2 {
+		return nil, ErrInvalidMultipath
+	}
+
+	descriptors := make([]branchDescriptor, 0, len(steps))
+	for _, step := range steps {
+		branch, err := strconv.ParseUint(step, 10, 32)
+		if err != nil {
+			return nil, ErrInvalidMultipath
+		}
+
+		descriptors = append(descriptors, branchDescriptor{
+			descriptor: desc[:start] + step + desc[end+1:],
+			branch:     uint32(branch),
+		})
+	}
+
+	return descriptors, nil
+}
+
+// rangeBranch returns the path step before the range wildcard, 0 if the
+// descriptor has none
+func rangeBranch(desc string) uint32 {
+	matches := rangeBranchRegexp.FindStringSubmatch(desc)
+	if len(matches) < 2 {
+		return 0
+	}
+
+	branch, err := strconv.ParseUint(matches[1], 10, 32)
+	if err != nil {
+		return 0
+	}
+
+	return uint32(branch)
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/vulpemventures/go-elements/address"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+// PeginInput is an input of a transaction claiming funds pegged in from the
+// mainchain, the outpoint spent is the mainchain one
+type PeginInput struct {
+	Index         uint32
+	MainchainTxID string
+	MainchainVout uint32
+	Amount        uint64
+	Asset         string
+	ClaimScript   []byte
+}
+
+// PegoutOutput is an output of a transaction pegging out funds to the
+// mainchain script
+type PegoutOutput struct {
+	Index           uint32
+	GenesisHash     string
+	MainchainScript []byte
+	// Value and Asset are set if explicit
+	Value uint64
+	Asset string
+}
+
+// extractPegins returns the peg-in inputs of the transaction
+func extractPegins(tx *transaction.Transaction) []PeginInput {
+	pegins := make([]PeginInput, 0)
+	for i, in := range tx.Inputs {
+		if !in.IsPegin {
+			continue
+		}
+
+		pegin := PeginInput{
+			Index:         uint32(i),
+			MainchainVout: in.Index,
+		}
+		if hash, err := chainhash.NewHash(in.Hash); err == nil {
+			pegin.MainchainTxID = hash.String()
+		}
+
+		// the witness is made of value, asset, genesis hash, claim script,
+		// mainchain tx and merkle proof
+		if w := in.PeginWitness; len(w) >= 4 {
+			if len(w[0]) == 8 {
+				pegin.Amount = binary.LittleEndian.Uint64(w[0])
+			}
+			if len(w[1]) == 32 {
+				pegin.Asset = elementsutil.AssetHashFromBytes(append([]byte{0x01}, w[1]...))
+			}
+			pegin.ClaimScript = w[3]
+		}
+
+		pegins = append(pegins, pegin)
+	}
+
+	return pegins
+}
+
+// extractPegouts returns the peg-out outputs of the transaction, their script
+// is OP_RETURN <genesis hash> <mainchain script> ...
+func extractPegouts(tx *transaction.Transaction) []PegoutOutput {
+	pegouts := make([]PegoutOutput, 0)
+	for i, out := range tx.Outputs {
+		if len(out.Script) == 0 || out.Script[0] != txscript.OP_RETURN {
+			continue
+		}
+
+		tokenizer := txscript.MakeScriptTokenizer(0, out.Script[1:])
+		if !tokenizer.Next() || len(tokenizer.Data()) != chainhash.HashSize {
+			continue
+		}
+		genesisHash, err := chainhash.NewHash(tokenizer.Data())
+		if err != nil {
+			continue
+		}
+
+		if !tokenizer.Next() || len(tokenizer.Data()) == 0 {
+			continue
+		}
+
+		pegout := PegoutOutput{
+			Index:           uint32(i),
+			GenesisHash:     genesisHash.String(),
+			MainchainScript: tokenizer.Data(),
+		}
+		if value, err := elementsutil.ValueFromBytes(out.Value); err == nil {
+			pegout.Value = value
+		}
+		if len(out.Asset) == 33 && out.Asset[0] == 0x01 {
+			pegout.Asset = elementsutil.AssetHashFromBytes(out.Asset)
+		}
+
+		pegouts = append(pegouts, pegout)
+	}
+
+	return pegouts
+}
+
+// PeginWatchItem is used to recognise the outputs paying to a script funded
+// by a peg-in claim
+type PeginWatchItem struct {
+	UnspentWatchItem
+}
+
+func NewPeginWatchItemFromAddress(addr string) (WatchItem, error) {
+	script, err := address.ToOutputScript(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PeginWatchItem{
+		UnspentWatchItem: UnspentWatchItem{outputScript: script},
+	}, nil
+}
+
+func (p *PeginWatchItem) EventType() EventType {
+	return Pegin
+}
+
+func (p *PeginWatchItem) filterReport(report *Report) bool {
+	return len(report.Pegins) > 0
+}
+
+// PegoutWatchItem is used to watch for an outpoint spent into a peg-out. The
+// item is resolved by any spending of the outpoint, but only peg-outs are reported.
+type PegoutWatchItem struct {
+	SpentWatchItem
+}
+
+func NewPegoutWatchItemFromInput(
+	input *transaction.TxInput,
+	prevoutScript []byte,
+) (WatchItem, error) {
+	h, err := chainhash.NewHash(input.Hash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PegoutWatchItem{
+		SpentWatchItem: SpentWatchItem{
+			hash:         h,
+			index:        input.Index,
+			outputScript: prevoutScript,
+		},
+	}, nil
+}
+
+func (p *PegoutWatchItem) EventType() EventType {
+	return Pegout
+}
+
+func (p *PegoutWatchItem) filterReport(report *Report) bool {
+	return len(report.Pegouts) > 0
+}
@@ -0,0 +1,150 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+const (
+	peginTxHash = "2e0d7dd2b2e7cf2ae3cd4bc0aeb4bc6bbba6ee1e41bd42d2fd1ac0a6dd1bdf73"
+	genesisHash = "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"
+)
+
+func TestExtractPegins(t *testing.T) {
+	tx := newPeginTx(t)
+
+	pegins := extractPegins(tx)
+	require.Equal(t, []PeginInput{{
+		Index:         1,
+		MainchainTxID: peginTxHash,
+		MainchainVout: 3,
+		Amount:        100000,
+		Asset:         issuedAsset,
+		ClaimScript:   []byte{0x00, 0x14, 0x02},
+	}}, pegins)
+
+	require.Empty(t, extractPegins(transaction.NewTx(2)))
+}
+
+func TestExtractPegouts(t *testing.T) {
+	tx := newPegoutTx(t)
+
+	pegouts := extractPegouts(tx)
+	require.Equal(t, []PegoutOutput{{
+		Index:           1,
+		GenesisHash:     genesisHash,
+		MainchainScript: []byte{0x00, 0x14, 0x03},
+		Value:           5000,
+		Asset:           issuedAsset,
+	}}, pegouts)
+}
+
+func TestPegWatchItems(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+
+	peginItem := &PeginWatchItem{UnspentWatchItem: UnspentWatchItem{outputScript: script}}
+	require.Equal(t, Pegin, peginItem.EventType())
+	require.False(t, sameItem(peginItem, &UnspentWatchItem{outputScript: script}))
+
+	in := transaction.NewTxInput(bytes.Repeat([]byte{0x01}, 32), 0)
+	pegoutItem, err := NewPegoutWatchItemFromInput(in, script)
+	require.NoError(t, err)
+	spentItem, err := NewSpentWatchItemFromInput(in, script)
+	require.NoError(t, err)
+	require.Equal(t, Pegout, pegoutItem.EventType())
+	require.False(t, sameItem(pegoutItem, spentItem))
+
+	pegin := newPeginTx(t)
+	pegin.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+	pegout := newPegoutTx(t)
+	pegout.AddInput(in)
+
+	// the items match any transaction, only the peg ones are reported
+	for _, v := range []struct {
+		item  WatchItem
+		tx    *transaction.Transaction
+		other *transaction.Transaction
+	}{
+		{peginItem, pegin, transaction.NewTx(2)},
+		{pegoutItem, pegout, transaction.NewTx(2)},
+	} {
+		require.NotNil(t, v.item.Match(v.tx))
+
+		report := &Report{Pegins: extractPegins(v.tx), Pegouts: extractPegouts(v.tx)}
+		require.True(t, v.item.(reportFilter).filterReport(report))
+
+		report = &Report{Pegins: extractPegins(v.other), Pegouts: extractPegouts(v.other)}
+		require.False(t, v.item.(reportFilter).filterReport(report))
+	}
+}
+
+func TestPeginWatchFlags(t *testing.T) {
+	parent := newScanRequest(
+		WithSpentTracking(SpentUtxo),
+		WithPeginTracking(),
+		WithAssetTracking(issuedAsset),
+		WithSilentWatch(),
+		WithEndBlock(10),
+	)
+
+	req := newScanRequest(withFlagsOf(parent), withDerivedWatch())
+	require.False(t, req.SpentTracking)
+	require.False(t, req.PeginTracking)
+	require.Empty(t, req.TrackedAsset)
+	require.False(t, req.Silent)
+	require.Equal(t, uint32(10), req.EndHeight)
+}
+
+func newPeginTx(t *testing.T) *transaction.Transaction {
+	hash, err := chainhash.NewHashFromStr(peginTxHash)
+	require.NoError(t, err)
+	genesis, err := chainhash.NewHashFromStr(genesisHash)
+	require.NoError(t, err)
+	asset, err := elementsutil.AssetHashToBytes(issuedAsset)
+	require.NoError(t, err)
+
+	amount := make([]byte, 8)
+	binary.LittleEndian.PutUint64(amount, 100000)
+
+	in := transaction.NewTxInput(hash[:], 3)
+	in.IsPegin = true
+	in.PeginWitness = [][]byte{
+		amount, asset[1:], genesis[:], {0x00, 0x14, 0x02}, {0x02}, {0x03},
+	}
+
+	tx := transaction.NewTx(2)
+	tx.AddInput(transaction.NewTxInput(bytes.Repeat([]byte{0x01}, 32), 0))
+	tx.AddInput(in)
+
+	return tx
+}
+
+func newPegoutTx(t *testing.T) *transaction.Transaction {
+	genesis, err := chainhash.NewHashFromStr(genesisHash)
+	require.NoError(t, err)
+	asset, err := elementsutil.AssetHashToBytes(issuedAsset)
+	require.NoError(t, err)
+	value, err := elementsutil.ValueToBytes(5000)
+	require.NoError(t, err)
+
+	script, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_RETURN).
+		AddData(genesis[:]).
+		AddData([]byte{0x00, 0x14, 0x03}).
+		Script()
+	require.NoError(t, err)
+
+	tx := transaction.NewTx(2)
+	// data outputs are not peg-outs
+	tx.AddOutput(transaction.NewTxOutput(asset, value, []byte{0x6a, 0x01, 0x01}))
+	tx.AddOutput(transaction.NewTxOutput(asset, value, script))
+
+	return tx
+}
@@ -1,16 +1,61 @@
 package scanner
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+)
 
 type ScanRequest struct {
 	// ClientID of the client sending request
 	ClientID uuid.UUID
 	// StartHeight from which scan should be performed, nil means scan from genesis block
 	StartHeight uint32
+	// StartTime (eg. a wallet birthday) or StartBlockHash, if set, take precedence
+	// over StartHeight: the scanner resolves them to the height of the first
+	// block mined after StartTime or the height of the block
+	StartTime      time.Time
+	StartBlockHash *chainhash.Hash
+	// EndHeight up to which scan should be performed (included), 0 means no end;
+	// once scanned up to it a Completed report is sent for the request
+	EndHeight uint32
 	// Item to watch
 	Item WatchItem
 	// IsPersistent if true, the request will be re-added with StartHeight = StartHeiht + 1
 	IsPersistent bool
+	// SpentTracking if true, a SpentWatchItem is registered for every outpoint
+	// matched by the (unspent) item, so that its spending is reported too
+	SpentTracking bool
+	// SpentEvents are the events watched on the tracked outpoints (SpentUtxo,
+	// Issuance, Reissuance, Pegout), SpentUtxo if empty
+	SpentEvents []EventType
+	// PeginTracking if true, a PeginWatchItem is registered together with
+	// the scripts derived from a descriptor
+	PeginTracking bool
+	// TrackedAsset, if set, is the asset (hex id) of the AssetWatchItem
+	// registered together with the scripts derived from a descriptor
+	TrackedAsset string
+	// Silent if true, the matches of the request are not reported
+	// (eg. it is used only to discover the outpoints to track)
+	Silent bool
+	// BlindingKeys, if set, are used to unblind the matched outputs
+	BlindingKeys *BlindingKeys
+	// ConfirmationDepth if greater than 1, the reports of the request are
+	// sent again with the number of confirmations of their block, until the
+	// depth is reached. The reports are sent again as Reverted if the block
+	// is disconnected, whatever the depth
+	ConfirmationDepth uint32
+
+	// walletState, if set, restores the state of the descriptors watched
+	// with WatchDescriptorWallets
+	walletState *WalletState
+	// conflictTracking if true, the spending of the tracked outpoints is
+	// watched for conflicts even if SpentUtxo is not one of the SpentEvents
+	conflictTracking bool
+	// conflictsOnly if true, the matches of the request are reported only if
+	// they conflict with another transaction (see Report.ConflictTxHash)
+	conflictsOnly bool
 }
 
 type ScanRequestOption func(req *ScanRequest)
@@ -27,18 +72,171 @@ func WithStartBlock(blockHeight uint32) ScanRequestOption {
 	}
 }
 
+func WithStartTime(startTime time.Time) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.StartTime = startTime
+	}
+}
+
+func WithStartBlockHash(blockHash chainhash.Hash) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.StartBlockHash = &blockHash
+	}
+}
+
+func WithEndBlock(blockHeight uint32) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.EndHeight = blockHeight
+	}
+}
+
 func WithPersistentWatch() ScanRequestOption {
 	return func(req *ScanRequest) {
 		req.IsPersistent = true
 	}
 }
 
+// WithSpentTracking tracks the spending of the outpoints matched by the item,
+// the given events (SpentUtxo by default) are watched on every outpoint
+func WithSpentTracking(events ...EventType) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.SpentTracking = true
+		req.SpentEvents = events
+	}
+}
+
+// withConflictTracking reports the conflicts of the transactions spending the
+// outpoints matched by the item, without reporting their spending
+func withConflictTracking() ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.SpentTracking = true
+		req.conflictTracking = true
+	}
+}
+
+// withConflictsOnly reports the matches of the request only as conflicts
+func withConflictsOnly() ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.conflictsOnly = true
+	}
+}
+
+// WithPeginTracking reports the peg-ins funding the scripts derived from the
+// watched descriptors (see WatchDescriptorWallets)
+func WithPeginTracking() ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.PeginTracking = true
+	}
+}
+
+// WithAssetTracking reports the outputs of the given asset (hex id) paying
+// to the scripts derived from the watched descriptors as AssetUtxo events
+// (see WatchDescriptorWallets)
+func WithAssetTracking(asset string) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.TrackedAsset = asset
+	}
+}
+
+// WithConfirmationDepth tracks the blocks of the reports of the request until
+// they have depth confirmations
+func WithConfirmationDepth(depth uint32) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.ConfirmationDepth = depth
+	}
+}
+
+// WithWalletState resumes watching the descriptors of WatchDescriptorWallets
+// from the state saved before a restart, it is ignored by Watch
+func WithWalletState(state WalletState) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.walletState = &state
+	}
+}
+
+func WithSilentWatch() ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.Silent = true
+	}
+}
+
 func WithRequestID(id uuid.UUID) ScanRequestOption {
 	return func(req *ScanRequest) {
 		req.ClientID = id
 	}
 }
 
+// withFlagsOf copies the spent, conflict, peg-in, asset tracking and silent flags,
+// the end height, the blinding keys and the confirmation depth of the given
+// request
+func withFlagsOf(other *ScanRequest) ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.SpentTracking = other.SpentTracking
+		req.SpentEvents = other.SpentEvents
+		req.conflictTracking = other.conflictTracking
+		req.PeginTracking = other.PeginTracking
+		req.TrackedAsset = other.TrackedAsset
+		req.Silent = other.Silent
+		req.EndHeight = other.EndHeight
+		req.BlindingKeys = other.BlindingKeys
+		req.ConfirmationDepth = other.ConfirmationDepth
+	}
+}
+
+// withDerivedWatch clears the flags of a request watching an item (eg. a
+// PeginWatchItem) derived from the ones of the unspent item
+func withDerivedWatch() ScanRequestOption {
+	return func(req *ScanRequest) {
+		req.SpentTracking = false
+		req.SpentEvents = nil
+		req.conflictTracking = false
+		req.PeginTracking = false
+		req.TrackedAsset = ""
+		req.Silent = false
+	}
+}
+
+// isStartResolved returns false if the start height must be resolved from
+// the start time or block hash
+func (req *ScanRequest) isStartResolved() bool {
+	return req.StartTime.IsZero() && req.StartBlockHash == nil
+}
+
+// spentEvents returns the events watched on the tracked outpoints, none if
+// they are tracked for conflicts only
+func (req *ScanRequest) spentEvents() []EventType {
+	if len(req.SpentEvents) == 0 && !req.conflictTracking {
+		return []EventType{SpentUtxo}
+	}
+	return req.SpentEvents
+}
+
+// confirmationDepth returns the depth up to which the confirmations of the
+// reports are tracked, the one of the TxConfirmationWatchItem if greater.
+// Transaction confirmations are always reported, from 1 confirmation.
+func (req *ScanRequest) confirmationDepth() uint32 {
+	depth := req.ConfirmationDepth
+	if item, ok := req.Item.(*TxConfirmationWatchItem); ok {
+		if item.depth > depth {
+			depth = item.depth
+		}
+		if depth == 0 {
+			depth = 1
+		}
+	}
+	return depth
+}
+
+// isBounded returns true if the request has an end height
+func (req *ScanRequest) isBounded() bool {
+	return req.EndHeight > 0
+}
+
+// endsAt returns true if the request is not scanned beyond height
+func (req *ScanRequest) endsAt(height uint32) bool {
+	return req.isBounded() && req.EndHeight <= height
+}
+
 func newScanRequest(options ...ScanRequestOption) *ScanRequest {
 	req := &ScanRequest{}
 	for _, option := range options {
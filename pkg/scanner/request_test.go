@@ -3,6 +3,9 @@ package scanner_test
 import (
 	"bytes"
 	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
 
 	"github.com/vulpemventures/go-elements/transaction"
 	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
@@ -23,8 +26,8 @@ func (f *fakeWatchItem) Bytes() []byte {
 	return f.bytes
 }
 
-func (f *fakeWatchItem) Match(*transaction.Transaction) bool {
-	return true
+func (f *fakeWatchItem) Match(*transaction.Transaction) *scanner.MatchDetails {
+	return &scanner.MatchDetails{}
 }
 
 func newFakeWatchItem(bytes []byte) scanner.WatchItem {
@@ -63,6 +66,30 @@ func TestRequestOptions(t *testing.T) {
 				IsPersistent: false,
 			},
 		},
+		{
+			name:   "WithEndBlock",
+			option: scanner.WithEndBlock(777),
+			expected: scanner.ScanRequest{
+				Item:      initialWatchItem,
+				EndHeight: 777,
+			},
+		},
+		{
+			name:   "WithStartTime",
+			option: scanner.WithStartTime(time.Unix(1658475206, 0)),
+			expected: scanner.ScanRequest{
+				Item:      initialWatchItem,
+				StartTime: time.Unix(1658475206, 0),
+			},
+		},
+		{
+			name:   "WithStartBlockHash",
+			option: scanner.WithStartBlockHash(chainhash.Hash{1}),
+			expected: scanner.ScanRequest{
+				Item:           initialWatchItem,
+				StartBlockHash: &chainhash.Hash{1},
+			},
+		},
 		{
 			name:   "WithPersistentWatch",
 			option: scanner.WithPersistentWatch(),
@@ -72,6 +99,24 @@ func TestRequestOptions(t *testing.T) {
 				IsPersistent: true,
 			},
 		},
+		{
+			name:   "WithSpentTracking",
+			option: scanner.WithSpentTracking(),
+			expected: scanner.ScanRequest{
+				Item:          initialWatchItem,
+				StartHeight:   0,
+				SpentTracking: true,
+			},
+		},
+		{
+			name:   "WithSilentWatch",
+			option: scanner.WithSilentWatch(),
+			expected: scanner.ScanRequest{
+				Item:        initialWatchItem,
+				StartHeight: 0,
+				Silent:      true,
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -86,6 +131,19 @@ func TestRequestOptions(t *testing.T) {
 			if req.StartHeight != test.expected.StartHeight {
 				tt.Errorf("expected: %d, got: %d", test.expected.StartHeight, req.StartHeight)
 			}
+
+			if req.EndHeight != test.expected.EndHeight {
+				tt.Errorf("expected: %d, got: %d", test.expected.EndHeight, req.EndHeight)
+			}
+
+			if !req.StartTime.Equal(test.expected.StartTime) {
+				tt.Errorf("expected: %v, got: %v", test.expected.StartTime, req.StartTime)
+			}
+
+			if (req.StartBlockHash == nil) != (test.expected.StartBlockHash == nil) ||
+				(req.StartBlockHash != nil && !req.StartBlockHash.IsEqual(test.expected.StartBlockHash)) {
+				tt.Errorf("expected: %v, got: %v", test.expected.StartBlockHash, req.StartBlockHash)
+			}
 		})
 	}
 }
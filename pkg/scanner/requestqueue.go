@@ -1,64 +1,389 @@
 package scanner
 
 import (
+	"sort"
 	"sync"
+
+	"github.com/google/uuid"
+	"github.com/vulpemventures/go-elements/transaction"
 )
 
+// scanRequestQueue holds the requests waiting to be scanned, indexed by start
+// height, and the batch of requests being scanned by the worker, indexed by
+// script, so that a single sweep over the chain serves all of them.
 type scanRequestQueue struct {
-	requests []*ScanRequest
-	locker   sync.Locker
-	cond     sync.Cond
+	// byHeight indexes the queued requests by start height, heights is the
+	// sorted list of its keys
+	byHeight map[uint32][]*ScanRequest
+	heights  []uint32
+	// inFlight are the requests dequeued by the worker and not yet resolved
+	// or enqueued back, removing them cancels the scan. inFlightHeight is
+	// the height of the block the worker is scanning them at
+	inFlight       *scanBatch
+	inFlightHeight uint32
+	// unresolved are the requests whose start height is not known yet
+	unresolved []*ScanRequest
+	locker     sync.Locker
+	// wakeCh signals that new requests have been enqueued
+	wakeCh chan struct{}
 }
 
 func newScanRequestQueue() *scanRequestQueue {
 
 	return &scanRequestQueue{
-		requests: make([]*ScanRequest, 0),
+		byHeight: make(map[uint32][]*ScanRequest),
+		heights:  make([]uint32, 0),
+		inFlight: newScanBatch(),
 		locker:   new(sync.Mutex),
-		cond:     sync.Cond{L: &sync.Mutex{}},
+		wakeCh:   make(chan struct{}, 1),
 	}
 }
 
+// dequeueAtHeight moves the requests with start height = height to the in
+// flight batch, they are in flight until resolved or enqueued back
+// the bounded requests starting beyond their end height are returned instead
 func (queue *scanRequestQueue) dequeueAtHeight(height uint32) []*ScanRequest {
 	queue.locker.Lock()
 	defer queue.locker.Unlock()
 
-	var selected []*ScanRequest // requests starting at hash
-	var remain []*ScanRequest   // remaining requests
+	queue.inFlightHeight = height
 
-	for _, req := range queue.requests {
-		if req.StartHeight == height {
-			selected = append(selected, req)
-		} else {
-			remain = append(remain, req)
+	var ended []*ScanRequest
+	for _, req := range queue.popHeight(height) {
+		if req.isBounded() && req.EndHeight < height {
+			ended = append(ended, req)
+			continue
 		}
+		queue.inFlight.add(req)
+	}
+	return ended
+}
+
+// completeInFlight removes and returns the in flight requests whose end
+// height is the given one
+func (queue *scanRequestQueue) completeInFlight(height uint32) []*ScanRequest {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	completed := queue.inFlight.endingAt(height)
+	for _, req := range completed {
+		queue.inFlight.remove(req)
+	}
+	return completed
+}
+
+// dequeueFromHeight removes and returns the requests with start height >= height
+func (queue *scanRequestQueue) dequeueFromHeight(height uint32) []*ScanRequest {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	var selected []*ScanRequest
+	for len(queue.heights) > 0 && queue.heights[len(queue.heights)-1] >= height {
+		selected = append(selected, queue.popHeight(queue.heights[len(queue.heights)-1])...)
+	}
+	return selected
+}
+
+// dequeueUpToHeight removes and returns the requests with start height <= height
+func (queue *scanRequestQueue) dequeueUpToHeight(height uint32) []*ScanRequest {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	var selected []*ScanRequest
+	for len(queue.heights) > 0 && queue.heights[0] <= height {
+		selected = append(selected, queue.popHeight(queue.heights[0])...)
 	}
-	queue.requests = remain
 	return selected
 }
 
 func (queue *scanRequestQueue) enqueue(req *ScanRequest) {
 	queue.locker.Lock()
 	defer queue.locker.Unlock()
-	defer queue.cond.Signal()
+	defer queue.wake()
+
+	queue.push(req)
+}
+
+// enqueueUnresolved adds a request whose start height must be resolved
+func (queue *scanRequestQueue) enqueueUnresolved(req *ScanRequest) {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+	defer queue.wake()
 
-	queue.requests = append(queue.requests, req)
+	queue.unresolved = append(queue.unresolved, req)
+}
+
+// dequeueUnresolved removes and returns the requests whose start height must be resolved
+func (queue *scanRequestQueue) dequeueUnresolved() []*ScanRequest {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	unresolved := queue.unresolved
+	queue.unresolved = nil
+	return unresolved
+}
+
+func (queue *scanRequestQueue) wake() {
+	select {
+	case queue.wakeCh <- struct{}{}:
+	default:
+	}
 }
 
+// enqueueFrom enqueues the requests originated by the resolution of parent
+// (eg. persistent re-watch), nothing is enqueued if parent has been removed
+func (queue *scanRequestQueue) enqueueFrom(parent *ScanRequest, reqs ...*ScanRequest) bool {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	if !queue.inFlight.has(parent) {
+		return false
+	}
+
+	for _, req := range reqs {
+		queue.push(req)
+	}
+	return true
+}
+
+// requeueInFlight enqueues back the in flight requests with the given start
+// height, they have been scanned up to height - 1
+func (queue *scanRequestQueue) requeueInFlight(height uint32) {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	for _, req := range queue.inFlight.list() {
+		queue.inFlight.remove(req)
+		req.StartHeight = height
+		queue.push(req)
+	}
+}
+
+// inFlightItems returns the unique elements to search in the block filters
+// for the in flight requests, and the version of the set which changes every
+// time a new element is added
+func (queue *scanRequestQueue) inFlightItems() ([][]byte, uint64) {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	return queue.inFlight.itemsBytes(), queue.inFlight.version
+}
+
+// matchInFlight returns the in flight requests matching the transaction
+func (queue *scanRequestQueue) matchInFlight(tx *transaction.Transaction) []requestMatch {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	return queue.inFlight.match(tx)
+}
+
+// matchAll returns the queued and in flight requests selected by the
+// predicate matching the transaction
+func (queue *scanRequestQueue) matchAll(
+	tx *transaction.Transaction,
+	selected func(req *ScanRequest) bool,
+) []requestMatch {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	batch := newScanBatch()
+	for _, height := range queue.heights {
+		for _, req := range queue.byHeight[height] {
+			if selected(req) {
+				batch.add(req)
+			}
+		}
+	}
+	for req := range queue.inFlight.requests {
+		if selected(req) {
+			batch.add(req)
+		}
+	}
+
+	return batch.match(tx)
+}
+
+func (queue *scanRequestQueue) isInFlight(req *ScanRequest) bool {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	return queue.inFlight.has(req)
+}
+
+// resolved marks the requests as no longer in flight
+func (queue *scanRequestQueue) resolved(reqs ...*ScanRequest) {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	for _, req := range reqs {
+		queue.inFlight.remove(req)
+	}
+}
+
+// remove removes the queued and in flight requests matching the predicate,
+// it returns the number of removed requests
+func (queue *scanRequestQueue) remove(match func(req *ScanRequest) bool) int {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	removed := 0
+	for _, height := range append([]uint32{}, queue.heights...) {
+		remain := make([]*ScanRequest, 0, len(queue.byHeight[height]))
+		for _, req := range queue.byHeight[height] {
+			if match(req) {
+				removed++
+			} else {
+				remain = append(remain, req)
+			}
+		}
+
+		if len(remain) == 0 {
+			queue.popHeight(height)
+			continue
+		}
+		queue.byHeight[height] = remain
+	}
+
+	for _, req := range queue.inFlight.list() {
+		if match(req) {
+			removed++
+			queue.inFlight.remove(req)
+		}
+	}
+
+	unresolved := make([]*ScanRequest, 0, len(queue.unresolved))
+	for _, req := range queue.unresolved {
+		if match(req) {
+			removed++
+		} else {
+			unresolved = append(unresolved, req)
+		}
+	}
+	queue.unresolved = unresolved
+
+	return removed
+}
+
+// rewind moves back to height the queued requests matching the predicate
+// with a greater start height. The in flight ones are enqueued back at height
+// if the worker already reached it, their scan is cancelled as if they were
+// removed. It returns the number of moved requests
+func (queue *scanRequestQueue) rewind(height uint32, match func(req *ScanRequest) bool) int {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+	defer queue.wake()
+
+	moved := 0
+	for _, h := range append([]uint32{}, queue.heights...) {
+		if h <= height {
+			continue
+		}
+
+		for _, req := range queue.popHeight(h) {
+			if match(req) {
+				req.StartHeight = height
+				moved++
+			}
+			queue.push(req)
+		}
+	}
+
+	if queue.inFlightHeight < height {
+		return moved
+	}
+
+	for _, req := range queue.inFlight.list() {
+		if match(req) {
+			queue.inFlight.remove(req)
+			req.StartHeight = height
+			queue.push(req)
+			moved++
+		}
+	}
+	return moved
+}
+
+// peek returns, without removing it, a request with the lowest start height
 func (queue *scanRequestQueue) peek() *ScanRequest {
 	queue.locker.Lock()
 	defer queue.locker.Unlock()
 
-	if len(queue.requests) == 0 {
+	if len(queue.heights) == 0 {
 		return nil
 	}
 
-	return queue.requests[0]
+	return queue.byHeight[queue.heights[0]][0]
+}
+
+// nextHeight returns the lowest start height >= height of the queued
+// requests, false is returned if there is none
+func (queue *scanRequestQueue) nextHeight(height uint32) (uint32, bool) {
+	queue.locker.Lock()
+	defer queue.locker.Unlock()
+
+	i := sort.Search(len(queue.heights), func(i int) bool {
+		return queue.heights[i] >= height
+	})
+	if i == len(queue.heights) {
+		return 0, false
+	}
+
+	return queue.heights[i], true
 }
 
-func (queue *scanRequestQueue) isEmpty() bool {
+// minStartHeights returns, for each client, the lowest start height of its
+// requests, in flight ones included
+func (queue *scanRequestQueue) minStartHeights() map[uuid.UUID]uint32 {
 	queue.locker.Lock()
 	defer queue.locker.Unlock()
 
-	return len(queue.requests) == 0
+	heights := make(map[uuid.UUID]uint32)
+	// heights are sorted, the first one found for a client is the lowest
+	for _, height := range queue.heights {
+		for _, req := range queue.byHeight[height] {
+			if _, ok := heights[req.ClientID]; !ok {
+				heights[req.ClientID] = height
+			}
+		}
+	}
+
+	for req := range queue.inFlight.requests {
+		if height, ok := heights[req.ClientID]; !ok || req.StartHeight < height {
+			heights[req.ClientID] = req.StartHeight
+		}
+	}
+
+	return heights
+}
+
+// push adds the request to the height index, the lock must be held
+func (queue *scanRequestQueue) push(req *ScanRequest) {
+	height := req.StartHeight
+	if _, ok := queue.byHeight[height]; !ok {
+		i := sort.Search(len(queue.heights), func(i int) bool {
+			return queue.heights[i] >= height
+		})
+		queue.heights = append(queue.heights, 0)
+		copy(queue.heights[i+1:], queue.heights[i:])
+		queue.heights[i] = height
+	}
+
+	queue.byHeight[height] = append(queue.byHeight[height], req)
+}
+
+// popHeight removes and returns the requests with the given start height,
+// the lock must be held
+func (queue *scanRequestQueue) popHeight(height uint32) []*ScanRequest {
+	reqs, ok := queue.byHeight[height]
+	if !ok {
+		return nil
+	}
+	delete(queue.byHeight, height)
+
+	i := sort.Search(len(queue.heights), func(i int) bool {
+		return queue.heights[i] >= height
+	})
+	queue.heights = append(queue.heights[:i], queue.heights[i+1:]...)
+
+	return reqs
 }
@@ -0,0 +1,170 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+func TestRequestQueueRemove(t *testing.T) {
+	clientA, clientB := uuid.New(), uuid.New()
+	itemA := &UnspentWatchItem{outputScript: []byte{0x00, 0x14, 0x01}}
+	itemB := &UnspentWatchItem{outputScript: []byte{0x00, 0x14, 0x02}}
+
+	reqA := newScanRequest(WithRequestID(clientA), WithStartBlock(1), WithWatchItem(itemA))
+	reqB := newScanRequest(WithRequestID(clientB), WithStartBlock(1), WithWatchItem(itemA))
+
+	queue := newScanRequestQueue()
+	queue.enqueue(reqA)
+	queue.enqueue(newScanRequest(WithRequestID(clientA), WithStartBlock(2), WithWatchItem(itemB)))
+	queue.enqueue(reqB)
+
+	// requests at height 1 are being scanned
+	queue.dequeueAtHeight(1)
+	require.True(t, queue.isInFlight(reqA))
+	require.True(t, queue.isInFlight(reqB))
+
+	removed := queue.remove(func(req *ScanRequest) bool {
+		return req.ClientID == clientA && sameItem(req.Item, itemA)
+	})
+	require.Equal(t, 1, removed)
+	require.False(t, queue.isInFlight(reqA))
+	require.True(t, queue.isInFlight(reqB))
+
+	// nothing originated by a removed request is enqueued
+	require.False(t, queue.enqueueFrom(reqA, newScanRequest(WithRequestID(clientA))))
+
+	removed = queue.remove(func(req *ScanRequest) bool {
+		return req.ClientID == clientA
+	})
+	require.Equal(t, 1, removed)
+
+	// removed requests are not enqueued back at the end of the scan
+	queue.requeueInFlight(3)
+	require.Equal(t, reqB, queue.peek())
+	require.Equal(t, uint32(3), reqB.StartHeight)
+	require.False(t, queue.isInFlight(reqB))
+}
+
+func TestRequestQueueRewind(t *testing.T) {
+	clientA, clientB := uuid.New(), uuid.New()
+
+	queue := newScanRequestQueue()
+	queue.enqueue(newScanRequest(WithRequestID(clientA), WithStartBlock(3)))
+	queue.enqueue(newScanRequest(WithRequestID(clientA), WithStartBlock(8)))
+	queue.enqueue(newScanRequest(WithRequestID(clientA), WithStartBlock(12)))
+	queue.enqueue(newScanRequest(WithRequestID(clientB), WithStartBlock(12)))
+
+	// only the requests of the client beyond the fork point are moved back
+	moved := queue.rewind(5, func(req *ScanRequest) bool { return req.ClientID == clientA })
+	require.Equal(t, 2, moved)
+
+	height, ok := queue.nextHeight(4)
+	require.True(t, ok)
+	require.Equal(t, uint32(5), height)
+	require.Len(t, queue.dequeueUpToHeight(5), 3)
+
+	next := queue.peek()
+	require.NotNil(t, next)
+	require.Equal(t, clientB, next.ClientID)
+	require.Equal(t, uint32(12), next.StartHeight)
+}
+
+func TestRequestQueueHeights(t *testing.T) {
+	queue := newScanRequestQueue()
+	require.Nil(t, queue.peek())
+
+	queue.enqueue(newScanRequest(WithStartBlock(5)))
+	queue.enqueue(newScanRequest(WithStartBlock(2)))
+	queue.enqueue(newScanRequest(WithStartBlock(7)))
+	queue.enqueue(newScanRequest(WithStartBlock(5)))
+
+	require.Equal(t, uint32(2), queue.peek().StartHeight)
+
+	height, ok := queue.nextHeight(3)
+	require.True(t, ok)
+	require.Equal(t, uint32(5), height)
+
+	_, ok = queue.nextHeight(8)
+	require.False(t, ok)
+
+	require.Len(t, queue.dequeueUpToHeight(5), 3)
+	require.Equal(t, uint32(7), queue.peek().StartHeight)
+
+	// enqueued requests wake up the requests manager
+	select {
+	case <-queue.wakeCh:
+	default:
+		t.Fatal("expected wake signal")
+	}
+}
+
+func TestScanBatchMatch(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+	prevout := chainhash.Hash{0x02}
+
+	unspentA := newScanRequest(WithWatchItem(&UnspentWatchItem{outputScript: script}))
+	unspentB := newScanRequest(WithWatchItem(&UnspentWatchItem{outputScript: script}))
+	spent := newScanRequest(WithWatchItem(&SpentWatchItem{
+		hash:         &prevout,
+		index:        1,
+		outputScript: []byte{0x00, 0x14, 0x03},
+	}))
+
+	batch := newScanBatch()
+	for _, req := range []*ScanRequest{unspentA, unspentB, spent} {
+		batch.add(req)
+	}
+
+	// the filter is matched against unique scripts
+	require.Len(t, batch.itemsBytes(), 2)
+
+	tx := transaction.NewTx(2)
+	tx.AddInput(transaction.NewTxInput(prevout[:], 1))
+	tx.AddOutput(transaction.NewTxOutput(nil, nil, script))
+	tx.AddOutput(transaction.NewTxOutput(nil, nil, script))
+
+	require.ElementsMatch(t, []*ScanRequest{unspentA, unspentB, spent}, matchedRequests(batch.match(tx)))
+
+	batch.remove(unspentA)
+	batch.remove(spent)
+	require.Len(t, batch.itemsBytes(), 1)
+
+	matches := batch.match(tx)
+	require.Equal(t, []*ScanRequest{unspentB}, matchedRequests(matches))
+	require.Len(t, matches[0].details.Outputs, 2)
+	require.Empty(t, matches[0].details.Inputs)
+}
+
+func matchedRequests(matches []requestMatch) []*ScanRequest {
+	reqs := make([]*ScanRequest, 0, len(matches))
+	for _, m := range matches {
+		reqs = append(reqs, m.request)
+	}
+	return reqs
+}
+
+func TestRequestQueueCompletion(t *testing.T) {
+	item := &UnspentWatchItem{outputScript: []byte{0x00, 0x14, 0x01}}
+	bounded := newScanRequest(WithStartBlock(1), WithEndBlock(3), WithWatchItem(item))
+	unbounded := newScanRequest(WithStartBlock(1), WithWatchItem(item))
+	ended := newScanRequest(WithStartBlock(5), WithEndBlock(4), WithWatchItem(item))
+
+	queue := newScanRequestQueue()
+	queue.enqueue(bounded)
+	queue.enqueue(unbounded)
+	queue.enqueue(ended)
+
+	require.Empty(t, queue.dequeueAtHeight(1))
+	require.Empty(t, queue.completeInFlight(2))
+	require.Equal(t, []*ScanRequest{bounded}, queue.completeInFlight(3))
+	require.False(t, queue.isInFlight(bounded))
+	require.True(t, queue.isInFlight(unbounded))
+
+	// requests starting beyond their end height are never scanned
+	require.Equal(t, []*ScanRequest{ended}, queue.dequeueAtHeight(5))
+	require.False(t, queue.isInFlight(ended))
+}
@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"context"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultRescanWorkers is the default number of workers matching the
+	// filters of historical ranges in parallel
+	DefaultRescanWorkers = 4
+	// rescanChunkSize is the number of heights matched by a worker at once,
+	// requests starting more than a chunk behind the tip are rescanned
+	rescanChunkSize = 100
+)
+
+// WithRescanWorkers sets the number of workers matching in parallel the
+// filters of the requests starting far behind the chain tip
+func WithRescanWorkers(workers int) ServiceOption {
+	return func(s *scannerService) {
+		if workers > 0 {
+			s.rescanWorkers = workers
+		}
+	}
+}
+
+func isRescan(startHeight, tipHeight uint32) bool {
+	return startHeight+rescanChunkSize <= tipHeight
+}
+
+// filtersChunk is the result of the matching of the filters of the blocks
+// from height onwards, it stops before the first block whose filter is missing
+type filtersChunk struct {
+	height      uint32
+	blockHashes []*chainhash.Hash
+	matched     []bool
+	// missingFilter is true if the chunk stopped because of a missing filter
+	missingFilter bool
+	err           error
+}
+
+func (c *filtersChunk) contains(height uint32) bool {
+	return height >= c.height && height < c.height+uint32(len(c.matched))
+}
+
+// matchFiltersAhead splits the range [from, to] into chunks whose filters are
+// matched against the items by the pool of workers, the chunk results are
+// returned in height order. The returned function stops the pool.
+func (s *scannerService) matchFiltersAhead(
+	from, to uint32,
+	items [][]byte,
+) (<-chan chan filtersChunk, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ordered := make(chan chan filtersChunk, 2*s.rescanWorkers)
+	jobs := make(chan func(), s.rescanWorkers)
+
+	for i := 0; i < s.rescanWorkers; i++ {
+		go func() {
+			for job := range jobs {
+				job()
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		defer close(ordered)
+
+		for height := from; height <= to; height += rescanChunkSize {
+			start, end := height, height+rescanChunkSize-1
+			if end > to {
+				end = to
+			}
+
+			resultCh := make(chan filtersChunk, 1)
+			select {
+			case ordered <- resultCh:
+			case <-ctx.Done():
+				return
+			}
+
+			select {
+			case jobs <- func() { resultCh <- s.matchFiltersChunk(ctx, start, end, items) }:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ordered, cancel
+}
+
+func (s *scannerService) matchFiltersChunk(
+	ctx context.Context,
+	from, to uint32,
+	items [][]byte,
+) filtersChunk {
+	chunk := filtersChunk{
+		height:      from,
+		blockHashes: make([]*chainhash.Hash, 0, to-from+1),
+		matched:     make([]bool, 0, to-from+1),
+	}
+
+	for height := from; height <= to; height++ {
+		if ctx.Err() != nil {
+			chunk.err = ctx.Err()
+			return chunk
+		}
+
+		blockHash, err := s.blockHashAt(height)
+		if err != nil {
+			chunk.err = err
+			return chunk
+		}
+
+		matched, err := s.blockFilterMatches(items, height, blockHash)
+		if err != nil {
+			if err != repository.ErrFilterNotFound {
+				chunk.err = err
+				return chunk
+			}
+
+			// the genesis filter is never synced by the node
+			if height > 0 {
+				chunk.missingFilter = true
+				return chunk
+			}
+		}
+
+		chunk.blockHashes = append(chunk.blockHashes, blockHash)
+		chunk.matched = append(chunk.matched, matched)
+	}
+
+	return chunk
+}
+
+// rescanWorker is like requestWorker but the filters are matched ahead in
+// parallel, the matching blocks are resolved in height order. Every time new
+// items join the batch (eg. a new request or the range of a descriptor is
+// extended) the filters are matched again from the current height.
+// The requests reaching the chain tip are handed over to the requests queue.
+func (s *scannerService) rescanWorker(
+	queue *scanRequestQueue,
+	startHeight uint32,
+	reportsChan chan<- Report,
+) (uint32, error) {
+	defer s.handOverCaughtUpRequests()
+
+	nextHeight := startHeight
+
+	// the range is the one behind the tip at the time the rescan starts, new
+	// blocks are left to the requests manager
+	chainTip, err := s.headerDB.ChainTip(context.Background())
+	if err != nil {
+		return nextHeight, err
+	}
+
+	stopMatching := func() {}
+	defer func() { stopMatching() }()
+
+	var chunks <-chan chan filtersChunk
+	var chunk *filtersChunk
+	var itemsVersion uint64
+
+	for nextHeight <= chainTip.Height {
+		// add to the batch all the requests with start height = nextHeight
+		s.sendCompleted(reportsChan, nextHeight, queue.dequeueAtHeight(nextHeight)...)
+
+		itemsBytes, version := queue.inFlightItems()
+		if len(itemsBytes) == 0 {
+			// nothing to scan until the start height of the next requests
+			stopMatching()
+			chunks, chunk = nil, nil
+
+			height, ok := queue.nextHeight(nextHeight + 1)
+			if !ok || height > chainTip.Height {
+				nextHeight = chainTip.Height + 1
+				break
+			}
+
+			nextHeight = height
+			continue
+		}
+
+		// (re)start matching the filters ahead if new items joined the batch
+		if chunks == nil || version != itemsVersion {
+			stopMatching()
+			chunks, stopMatching = s.matchFiltersAhead(nextHeight, chainTip.Height, itemsBytes)
+			chunk = nil
+			itemsVersion = version
+		}
+
+		if chunk == nil || !chunk.contains(nextHeight) {
+			if chunk != nil && chunk.missingFilter {
+				log.Debugf("scanner: filter not found for block at height %v, waiting for it", nextHeight)
+				break
+			}
+
+			resultCh, ok := <-chunks
+			if !ok {
+				break
+			}
+			next := <-resultCh
+			if next.err != nil {
+				return nextHeight, next.err
+			}
+			chunk = &next
+
+			if !chunk.contains(nextHeight) {
+				log.Debugf("scanner: filter not found for block at height %v, waiting for it", nextHeight)
+				break
+			}
+		}
+
+		i := nextHeight - chunk.height
+		if chunk.matched[i] {
+			if err := s.resolveBlockMatches(queue, chunk.blockHashes[i], reportsChan); err != nil {
+				return nextHeight, err
+			}
+		}
+		s.sendCompleted(reportsChan, nextHeight, queue.completeInFlight(nextHeight)...)
+
+		nextHeight++
+	}
+
+	// enqueue the remaining requests, they have been scanned up to nextHeight - 1
+	queue.requeueInFlight(nextHeight)
+
+	return nextHeight, nil
+}
+
+// handOverCaughtUpRequests moves the requests of the rescan queue that are no
+// longer behind the chain tip to the requests queue
+func (s *scannerService) handOverCaughtUpRequests() {
+	chainTip, err := s.headerDB.ChainTip(context.Background())
+	if err != nil {
+		log.Errorf("scanner: failed to get chain tip: %v", err)
+		return
+	}
+
+	var fromHeight uint32
+	if chainTip.Height >= rescanChunkSize {
+		fromHeight = chainTip.Height - rescanChunkSize + 1
+	}
+
+	for _, req := range s.rescanQueue.dequeueFromHeight(fromHeight) {
+		s.requestsQueue.enqueue(req)
+	}
+}
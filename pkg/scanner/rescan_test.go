@@ -0,0 +1,318 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/go-elements/elementsutil"
+	"github.com/vulpemventures/go-elements/transaction"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+// fakeHeaderDB and fakeFilterDB implement the repository methods used to
+// match the filters
+type fakeHeaderDB struct {
+	repository.BlockHeaderRepository
+	hashes map[uint32]*chainhash.Hash
+}
+
+func (f *fakeHeaderDB) GetBlockHashByHeight(_ context.Context, height uint32) (*chainhash.Hash, error) {
+	return f.hashes[height], nil
+}
+
+func (f *fakeHeaderDB) ChainTip(context.Context) (*block.Header, error) {
+	return &block.Header{Height: uint32(len(f.hashes))}, nil
+}
+
+type fakeFilterDB struct {
+	repository.FilterRepository
+	filters      map[string]*repository.FilterEntry
+	prunedHeight uint32
+}
+
+func (f *fakeFilterDB) GetPrunedHeight(context.Context) (uint32, error) {
+	return f.prunedHeight, nil
+}
+
+func (f *fakeFilterDB) GetFilter(_ context.Context, key repository.FilterKey) (*repository.FilterEntry, error) {
+	entry, ok := f.filters[string(key.BlockHash)]
+	if !ok {
+		return nil, repository.ErrFilterNotFound
+	}
+	return entry, nil
+}
+
+func TestMatchFiltersAhead(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+
+	headerDB := &fakeHeaderDB{hashes: make(map[uint32]*chainhash.Hash)}
+	filterDB := &fakeFilterDB{filters: make(map[string]*repository.FilterEntry)}
+
+	// the script is in the blocks at height 2 and 4, the filter of the
+	// block at height 5 is missing
+	for height := uint32(1); height <= 5; height++ {
+		hash := &chainhash.Hash{byte(height)}
+		headerDB.hashes[height] = hash
+		if height == 5 {
+			continue
+		}
+
+		items := [][]byte{hash.CloneBytes()}
+		if height%2 == 0 {
+			items = append(items, script)
+		}
+		filterDB.filters[string(hash.CloneBytes())] = newFilterEntry(t, hash, items)
+	}
+
+	s := &scannerService{
+		headerDB:      headerDB,
+		filterDB:      filterDB,
+		genesisHash:   &chainhash.Hash{},
+		rescanWorkers: 2,
+	}
+
+	chunks, stop := s.matchFiltersAhead(1, 5, [][]byte{script})
+	defer stop()
+
+	chunk := <-<-chunks
+	require.NoError(t, chunk.err)
+	require.Equal(t, uint32(1), chunk.height)
+	require.Equal(t, []bool{false, true, false, true}, chunk.matched)
+	require.True(t, chunk.missingFilter)
+	require.True(t, chunk.contains(4))
+	require.False(t, chunk.contains(5))
+
+	_, ok := <-chunks
+	require.False(t, ok)
+}
+
+func newFilterEntry(t *testing.T, hash *chainhash.Hash, items [][]byte) *repository.FilterEntry {
+	filter, err := gcs.BuildGCSFilter(builder.DefaultP, builder.DefaultM, builder.DeriveKey(hash), items)
+	require.NoError(t, err)
+
+	entry, err := repository.NewFilterEntry(repository.FilterKey{
+		BlockHash:  hash.CloneBytes(),
+		FilterType: repository.RegularFilter,
+	}, filter)
+	require.NoError(t, err)
+	return entry
+}
+
+// fakeBlockService serves the blocks, the first requests fail
+type fakeBlockService struct {
+	blocks   map[chainhash.Hash]*block.Block
+	failures int
+	calls    int
+}
+
+func (f *fakeBlockService) GetBlock(hash *chainhash.Hash) (*block.Block, error) {
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, errors.New("connection refused")
+	}
+
+	return f.blocks[*hash], nil
+}
+
+func TestWorkerErrorKeepsRequests(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+
+	headerDB := &fakeHeaderDB{hashes: make(map[uint32]*chainhash.Hash)}
+	filterDB := &fakeFilterDB{filters: make(map[string]*repository.FilterEntry)}
+
+	// the script is in the block at height 2
+	for height := uint32(1); height <= 3; height++ {
+		hash := &chainhash.Hash{byte(height)}
+		headerDB.hashes[height] = hash
+
+		items := [][]byte{hash.CloneBytes()}
+		if height == 2 {
+			items = append(items, script)
+		}
+		filterDB.filters[string(hash.CloneBytes())] = newFilterEntry(t, hash, items)
+	}
+
+	s := &scannerService{
+		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
+		headerDB:      headerDB,
+		filterDB:      filterDB,
+		genesisHash:   &chainhash.Hash{},
+		blockService:  &fakeBlockService{failures: 1},
+		rescanWorkers: 2,
+	}
+
+	workers := map[string]func(*scanRequestQueue, uint32, chan<- Report) (uint32, error){
+		"requestWorker": s.requestWorker,
+		"rescanWorker":  s.rescanWorker,
+	}
+	for name, worker := range workers {
+		t.Run(name, func(t *testing.T) {
+			s.blockService = &fakeBlockService{failures: 1}
+			queue := newScanRequestQueue()
+			req := newScanRequest(
+				WithStartBlock(1),
+				WithWatchItem(&UnspentWatchItem{outputScript: script}),
+			)
+			queue.enqueue(req)
+
+			// the scan stops at the block that can't be fetched, the request
+			// is still in flight
+			stopHeight, err := worker(queue, 1, make(chan Report, 10))
+			require.Error(t, err)
+			require.Equal(t, uint32(2), stopHeight)
+			require.True(t, queue.isInFlight(req))
+
+			queue.requeueInFlight(stopHeight)
+			require.Equal(t, req, queue.peek())
+			require.Equal(t, uint32(2), req.StartHeight)
+		})
+	}
+}
+
+type fakeChainNotifier struct {
+	updates chan struct{}
+}
+
+func (f *fakeChainNotifier) NotifyChainUpdates() <-chan struct{} {
+	return f.updates
+}
+
+func TestRequestsManagerRetry(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+
+	headerDB := &fakeHeaderDB{hashes: make(map[uint32]*chainhash.Hash)}
+	filterDB := &fakeFilterDB{filters: make(map[string]*repository.FilterEntry)}
+	blockSvc := &fakeBlockService{blocks: make(map[chainhash.Hash]*block.Block), failures: 1}
+
+	// the script is funded in the block at height 2
+	tx := transaction.NewTx(2)
+	tx.AddOutput(transaction.NewTxOutput(nil, make([]byte, 9), script))
+	for height := uint32(1); height <= 3; height++ {
+		hash := &chainhash.Hash{byte(height)}
+		headerDB.hashes[height] = hash
+
+		items := [][]byte{hash.CloneBytes()}
+		txs := []*transaction.Transaction{}
+		if height == 2 {
+			items = append(items, script)
+			txs = append(txs, tx)
+		}
+		filterDB.filters[string(hash.CloneBytes())] = newFilterEntry(t, hash, items)
+		blockSvc.blocks[*hash] = &block.Block{
+			Header:           &block.Header{Height: height},
+			TransactionsData: &block.Transactions{Transactions: txs},
+		}
+	}
+
+	notifier := &fakeChainNotifier{updates: make(chan struct{})}
+	s := New(filterDB, headerDB, blockSvc, &chainhash.Hash{}, WithChainNotifier(notifier)).(*scannerService)
+
+	reports := make(chan Report, 10)
+	go s.requestsManager(s.requestsQueue, s.requestWorker, reports)
+	defer close(s.quitCh)
+
+	s.Watch(
+		WithStartBlock(1),
+		WithWatchItem(&UnspentWatchItem{outputScript: script}),
+	)
+
+	// the block can't be fetched, the request waits for the next chain event
+	select {
+	case report := <-reports:
+		t.Fatalf("unexpected report at height %v", report.BlockHeight)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	notifier.updates <- struct{}{}
+
+	select {
+	case report := <-reports:
+		require.NoError(t, report.Err)
+		require.Equal(t, uint32(2), report.BlockHeight)
+		require.Equal(t, tx.TxHash(), report.Transaction.TxHash())
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the request to complete after the chain event")
+	}
+}
+
+func TestWorkerFilteredReportKeepsRequest(t *testing.T) {
+	script := []byte{0x00, 0x14, 0x01}
+	assetA := "5ac9f65c0efcc4775e0baec4ec03abdde22473cd3cf33c0419ca290e0751b225"
+	assetB := issuedAsset
+
+	headerDB := &fakeHeaderDB{hashes: make(map[uint32]*chainhash.Hash)}
+	filterDB := &fakeFilterDB{filters: make(map[string]*repository.FilterEntry)}
+	blockSvc := &fakeBlockService{blocks: make(map[chainhash.Hash]*block.Block)}
+
+	// the script is paid in asset A at height 1, in asset B at height 2
+	payments := map[uint32]string{1: assetA, 2: assetB}
+	txs := make(map[uint32]*transaction.Transaction)
+	for height := uint32(1); height <= 3; height++ {
+		hash := &chainhash.Hash{byte(height)}
+		headerDB.hashes[height] = hash
+
+		items := [][]byte{hash.CloneBytes()}
+		blockTxs := []*transaction.Transaction{}
+		if asset, ok := payments[height]; ok {
+			assetBytes, err := elementsutil.AssetHashToBytes(asset)
+			require.NoError(t, err)
+			value, err := elementsutil.ValueToBytes(1000)
+			require.NoError(t, err)
+
+			tx := transaction.NewTx(2)
+			tx.AddInput(transaction.NewTxInput(hash[:], 0))
+			tx.AddOutput(transaction.NewTxOutput(assetBytes, value, script))
+			txs[height] = tx
+			items = append(items, script)
+			blockTxs = append(blockTxs, tx)
+		}
+		filterDB.filters[string(hash.CloneBytes())] = newFilterEntry(t, hash, items)
+		blockSvc.blocks[*hash] = &block.Block{
+			Header:           &block.Header{Height: height},
+			TransactionsData: &block.Transactions{Transactions: blockTxs},
+		}
+	}
+
+	s := &scannerService{
+		requestsQueue:     newScanRequestQueue(),
+		rescanQueue:       newScanRequestQueue(),
+		headerDB:          headerDB,
+		filterDB:          filterDB,
+		genesisHash:       &chainhash.Hash{},
+		blockService:      blockSvc,
+		unconfirmed:       newUnconfirmedReports(),
+		unconfirmedSpends: newUnconfirmedSpends(),
+		confirmations:     newConfirmationTracker(),
+	}
+
+	queue := newScanRequestQueue()
+	req := newScanRequest(
+		WithStartBlock(1),
+		WithWatchItem(&AssetWatchItem{UnspentWatchItem: UnspentWatchItem{outputScript: script}, asset: assetB}),
+	)
+	queue.enqueue(req)
+
+	reports := make(chan Report, 10)
+	_, err := s.requestWorker(queue, 1, reports)
+	require.NoError(t, err)
+	close(reports)
+
+	// the output in asset A doesn't use up the request
+	sent := make([]Report, 0)
+	for report := range reports {
+		sent = append(sent, report)
+	}
+	require.Len(t, sent, 1)
+	require.Equal(t, uint32(2), sent[0].BlockHeight)
+	require.Equal(t, txs[2].TxHash(), sent[0].Transaction.TxHash())
+	require.Equal(t, AssetUtxo, sent[0].EventType())
+	require.False(t, queue.isInFlight(req))
+}
@@ -0,0 +1,200 @@
+package scanner
+
+import (
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/vulpemventures/go-elements/transaction"
+)
+
+type outpointKey struct {
+	hash  chainhash.Hash
+	index uint32
+}
+
+// scanBatch indexes the requests being scanned by the script or outpoint they
+// watch, so that every block filter is matched against the unique scripts of
+// the batch and block transactions are looked up instead of being matched
+// against every request. It is not safe for concurrent use.
+type scanBatch struct {
+	requests   map[*ScanRequest]struct{}
+	byScript   map[string][]*ScanRequest
+	byOutpoint map[outpointKey][]*ScanRequest
+	// others are the requests with a custom WatchItem, matched one by one
+	others []*ScanRequest
+	// byEndHeight indexes the bounded requests by end height
+	byEndHeight map[uint32][]*ScanRequest
+
+	// items counts the requests by item bytes, itemsCache is reset on changes
+	items      map[string]int
+	itemsCache [][]byte
+	// version is incremented every time a new item joins the batch
+	version uint64
+}
+
+func newScanBatch() *scanBatch {
+	return &scanBatch{
+		requests:   make(map[*ScanRequest]struct{}),
+		byScript:   make(map[string][]*ScanRequest),
+		byOutpoint: make(map[outpointKey][]*ScanRequest),
+		others:     make([]*ScanRequest, 0),
+		items:      make(map[string]int),
+
+		byEndHeight: make(map[uint32][]*ScanRequest),
+	}
+}
+
+func (b *scanBatch) len() int {
+	return len(b.requests)
+}
+
+func (b *scanBatch) has(req *ScanRequest) bool {
+	_, ok := b.requests[req]
+	return ok
+}
+
+func (b *scanBatch) add(req *ScanRequest) {
+	if b.has(req) {
+		return
+	}
+	b.requests[req] = struct{}{}
+
+	switch item := req.Item.(type) {
+	case scriptItem:
+		key := string(item.script())
+		b.byScript[key] = append(b.byScript[key], req)
+	case outpointItem:
+		key := item.outpoint()
+		b.byOutpoint[key] = append(b.byOutpoint[key], req)
+	default:
+		b.others = append(b.others, req)
+	}
+
+	if req.isBounded() {
+		b.byEndHeight[req.EndHeight] = append(b.byEndHeight[req.EndHeight], req)
+	}
+
+	key := string(req.Item.Bytes())
+	if b.items[key] == 0 {
+		b.version++
+	}
+	b.items[key]++
+	b.itemsCache = nil
+}
+
+func (b *scanBatch) remove(req *ScanRequest) {
+	if !b.has(req) {
+		return
+	}
+	delete(b.requests, req)
+
+	switch item := req.Item.(type) {
+	case scriptItem:
+		key := string(item.script())
+		if reqs := removeRequest(b.byScript[key], req); len(reqs) > 0 {
+			b.byScript[key] = reqs
+		} else {
+			delete(b.byScript, key)
+		}
+	case outpointItem:
+		key := item.outpoint()
+		if reqs := removeRequest(b.byOutpoint[key], req); len(reqs) > 0 {
+			b.byOutpoint[key] = reqs
+		} else {
+			delete(b.byOutpoint, key)
+		}
+	default:
+		b.others = removeRequest(b.others, req)
+	}
+
+	if req.isBounded() {
+		if reqs := removeRequest(b.byEndHeight[req.EndHeight], req); len(reqs) > 0 {
+			b.byEndHeight[req.EndHeight] = reqs
+		} else {
+			delete(b.byEndHeight, req.EndHeight)
+		}
+	}
+
+	key := string(req.Item.Bytes())
+	if b.items[key]--; b.items[key] <= 0 {
+		delete(b.items, key)
+	}
+	b.itemsCache = nil
+}
+
+// endingAt returns the requests of the batch with the given end height
+func (b *scanBatch) endingAt(height uint32) []*ScanRequest {
+	return append([]*ScanRequest{}, b.byEndHeight[height]...)
+}
+
+// list returns the requests of the batch
+func (b *scanBatch) list() []*ScanRequest {
+	reqs := make([]*ScanRequest, 0, len(b.requests))
+	for req := range b.requests {
+		reqs = append(reqs, req)
+	}
+	return reqs
+}
+
+// itemsBytes returns the unique elements to search in the block filters
+func (b *scanBatch) itemsBytes() [][]byte {
+	if b.itemsCache == nil {
+		b.itemsCache = make([][]byte, 0, len(b.items))
+		for item := range b.items {
+			b.itemsCache = append(b.itemsCache, []byte(item))
+		}
+	}
+	return b.itemsCache
+}
+
+// requestMatch is a request matching a transaction, with the matching outputs
+// and inputs
+type requestMatch struct {
+	request *ScanRequest
+	details *MatchDetails
+}
+
+// match returns the requests of the batch matching the transaction, the
+// candidates looked up by script and outpoint are matched to get the details
+func (b *scanBatch) match(tx *transaction.Transaction) []requestMatch {
+	candidates := make([]*ScanRequest, 0)
+	seen := make(map[*ScanRequest]struct{})
+	appendOnce := func(reqs []*ScanRequest) {
+		for _, req := range reqs {
+			if _, ok := seen[req]; !ok {
+				seen[req] = struct{}{}
+				candidates = append(candidates, req)
+			}
+		}
+	}
+
+	for _, out := range tx.Outputs {
+		appendOnce(b.byScript[string(out.Script)])
+	}
+
+	for _, in := range tx.Inputs {
+		hash, err := chainhash.NewHash(in.Hash)
+		if err != nil {
+			continue
+		}
+		appendOnce(b.byOutpoint[outpointKey{*hash, in.Index}])
+	}
+
+	appendOnce(b.others)
+
+	matched := make([]requestMatch, 0, len(candidates))
+	for _, req := range candidates {
+		if details := req.Item.Match(tx); details != nil {
+			matched = append(matched, requestMatch{req, details})
+		}
+	}
+
+	return matched
+}
+
+func removeRequest(reqs []*ScanRequest, req *ScanRequest) []*ScanRequest {
+	for i, r := range reqs {
+		if r == req {
+			return append(reqs[:i], reqs[i+1:]...)
+		}
+	}
+	return reqs
+}
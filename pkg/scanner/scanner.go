@@ -3,6 +3,10 @@ package scanner
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync"
+	"time"
+
 	"github.com/google/uuid"
 
 	"github.com/vulpemventures/go-elements/descriptor"
@@ -20,8 +24,38 @@ import (
 const (
 	UnspentUtxo EventType = iota
 	SpentUtxo
+	// Issuance and Reissuance are reported for the inputs spending a watched
+	// outpoint to (re)issue an asset
+	Issuance
+	Reissuance
+	// AssetUtxo is reported for the outputs of a given asset paying to a
+	// watched script
+	AssetUtxo
+	// Pegin is reported for the outputs paying to a watched script in a
+	// transaction claiming a peg-in, Pegout for the inputs spending a watched
+	// outpoint in a transaction pegging out to the mainchain
+	Pegin
+	Pegout
+	// TxConfirmation is reported for the confirmations of a watched transaction
+	TxConfirmation
+	// Conflict is reported for the transactions spending a watched outpoint
+	// already spent by another seen transaction (see Report.ConflictTxHash)
+	Conflict
+)
 
-	numOsScripts = 100
+const (
+	// MaxFiltersPerFetch is the max number of filters asked to the FilterFetcher
+	// at once, the limit of a getcfilters message
+	MaxFiltersPerFetch = 1000
+
+	// filterFetchTimeout is the max time to wait for a range of filters
+	// fetched on demand, a failed fetch is tried filterFetchAttempts times
+	filterFetchTimeout  = 30 * time.Second
+	filterFetchAttempts = 3
+	filterFetchBackoff  = time.Second
+	// chainPollInterval is the frequency at which the requests that caught up
+	// are scanned again if no ChainNotifier is provided
+	chainPollInterval = 10 * time.Second
 )
 
 type EventType int
@@ -36,6 +70,66 @@ type Report struct {
 
 	// the request resolved by the report
 	Request *ScanRequest
+
+	// TxIndex is the position of the transaction in the block
+	TxIndex uint32
+	// Operation classifies the transaction as a transfer, an issuance, a
+	// reissuance or a burn of assets
+	Operation AssetOperation
+	// Outputs and Inputs are the ones of the transaction matching the
+	// request item, eg. the outputs paying to the watched script
+	Outputs []MatchedOutput
+	Inputs  []MatchedInput
+	// Pegins and Pegouts are the peg-in inputs and the peg-out outputs of
+	// the transaction, if any
+	Pegins  []PeginInput
+	Pegouts []PegoutOutput
+
+	// Confirmations is set for the requests tracking the confirmations (see
+	// WithConfirmationDepth and TxConfirmationWatchItem): the block of the
+	// match is reported with 1 confirmation, then the same report is sent
+	// again for every new block until the depth is reached
+	Confirmations uint32
+	// Reverted is set if the block of a sent report has been disconnected
+	// from the chain, the report is the one sent for the block
+	Reverted bool
+
+	// Unconfirmed is set if the transaction is in the mempool (see
+	// WithMempoolNotifier), BlockHash is nil. The request is not resolved:
+	// the transaction is reported again once confirmed, with SeenUnconfirmed set.
+	Unconfirmed     bool
+	SeenUnconfirmed bool
+	// ConflictTxHash is set if the transaction spends a watched outpoint
+	// already spent by this other transaction, seen in the mempool: the report
+	// is a Conflict (double-spend) alert. The transaction is Unconfirmed if
+	// both are in the mempool, otherwise it is the confirmed one.
+	ConflictTxHash *chainhash.Hash
+
+	// Derivation is set if the matched script is derived from a wallet
+	// descriptor, it says which branch and index it is
+	Derivation *ScriptDerivation
+
+	// Completed is set if the request has been scanned up to its end height
+	// (or resolved, if not persistent), no more reports are sent for it
+	Completed bool
+
+	// Err is set if the request can't be resolved, eg. repository.ErrPruned
+	// if the filters of the blocks to scan have been pruned; the request is
+	// removed from the queue
+	Err error
+
+	// filtered is set if the request is resolved by the report but the item
+	// doesn't want it to be sent (see reportFilter)
+	filtered bool
+}
+
+// EventType returns the event reported: Conflict for the conflict alerts,
+// the one of the request item otherwise
+func (r Report) EventType() EventType {
+	if r.ConflictTxHash != nil {
+		return Conflict
+	}
+	return r.Request.Item.EventType()
 }
 
 type Service interface {
@@ -53,16 +147,109 @@ type Service interface {
 		eventType []EventType,
 		blockStart int,
 	) error
+	// WatchDescriptorWallets is like WatchDescriptorWallet for several descriptors
+	// (eg. receive and change branches) watched by the same client, multipath
+	// descriptors (eg. wpkh(xpub/<0;1>/*)) are supported, as well as ct()
+	// ones whose outputs are unblinded with the slip77 master key. The options
+	// are applied to every request (eg. WithBlindingKeys), AssetUtxo events
+	// require the asset given with WithAssetTracking
+	WatchDescriptorWallets(
+		requestID uuid.UUID,
+		descriptors []string,
+		eventType []EventType,
+		blockStart int,
+		opts ...ScanRequestOption,
+	) error
+	// Unwatch removes all the queued and in flight requests of the client,
+	// persistent ones included, a report already being sent may still be delivered
+	Unwatch(requestID uuid.UUID)
+	// UnwatchItem removes the queued and in flight requests of the client
+	// watching for the given item
+	UnwatchItem(requestID uuid.UUID, item WatchItem)
+	// ResolveStartHeight returns the start height of a request built with the
+	// given options, resolving its start time or block hash if any
+	ResolveStartHeight(opts ...ScanRequestOption) (uint32, error)
+	// ScannedHeight returns the height up to which all the requests of the
+	// given client have been scanned, false is returned if nothing has been scanned yet
+	ScannedHeight(requestID uuid.UUID) (uint32, bool)
+}
+
+// FilterFetcher downloads on demand the filters of the blocks from startHeight
+// up to the one of stopHash (at most MaxFiltersPerFetch), caching them in the
+// filters repository (eg. a node syncing headers only).
+type FilterFetcher interface {
+	FetchFilters(ctx context.Context, startHeight uint32, stopHash chainhash.Hash) ([]*repository.FilterEntry, error)
+}
+
+// ChainNotifier signals that new block headers or filters have been stored
+// (eg. the node syncing them).
+type ChainNotifier interface {
+	NotifyChainUpdates() <-chan struct{}
+}
+
+type ServiceOption func(*scannerService)
+
+// WithGapLimit sets the number of unused scripts watched after the last used
+// one of range descriptors, DefaultGapLimit is used otherwise
+func WithGapLimit(gapLimit uint32) ServiceOption {
+	return func(s *scannerService) {
+		if gapLimit > 0 {
+			s.gapLimit = gapLimit
+		}
+	}
+}
+
+// WithChainNotifier makes the requests that caught up with the chain wait
+// for new blocks or filters instead of polling the repositories
+func WithChainNotifier(notifier ChainNotifier) ServiceOption {
+	return func(s *scannerService) {
+		s.chainNotifier = notifier
+	}
+}
+
+// WithFilterFetcher makes the scanner fetch the filters missing in the
+// repository instead of waiting for them to be synced, the requests starting
+// below the pruned height are scanned with the fetched filters too
+func WithFilterFetcher(fetcher FilterFetcher) ServiceOption {
+	return func(s *scannerService) {
+		s.filterFetcher = fetcher
+		s.fetchedFilters = newFilterCache(2 * MaxFiltersPerFetch)
+	}
 }
 
 type scannerService struct {
-	started       bool
+	started bool
+	// requestsQueue holds the requests that caught up with the chain,
+	// rescanQueue the ones starting far behind the tip
 	requestsQueue *scanRequestQueue
+	rescanQueue   *scanRequestQueue
 	filterDB      repository.FilterRepository
 	headerDB      repository.BlockHeaderRepository
 	genesisHash   *chainhash.Hash
 	blockService  blockservice.BlockService
-	quitCh        chan struct{}
+	filterFetcher FilterFetcher
+	// fetchedFilters holds the filters fetched ahead of the scanned height
+	fetchedFilters *filterCache
+	chainNotifier  ChainNotifier
+	// mempoolNotifier, if set, sends the unconfirmed transactions to match
+	mempoolNotifier MempoolNotifier
+	gapLimit        uint32
+	rescanWorkers   int
+	quitCh          chan struct{}
+
+	// scannedHeights is a snapshot, taken at the end of every scan, of the
+	// height up to which the requests of each client have been scanned
+	scannedHeights     map[uuid.UUID]uint32
+	scannedHeightsLock *sync.RWMutex
+
+	// confirmations tracks the reports until they reach the confirmation
+	// depth of their request
+	confirmations *confirmationTracker
+	// unconfirmed holds the unconfirmed transactions reported
+	unconfirmed *unconfirmedReports
+	// unconfirmedSpends holds the unconfirmed transactions spending the
+	// watched outpoints, to detect the conflicting ones
+	unconfirmedSpends *unconfirmedSpends
 }
 
 var _ Service = (*scannerService)(nil)
@@ -72,15 +259,31 @@ func New(
 	headerDB repository.BlockHeaderRepository,
 	blockSvc blockservice.BlockService,
 	genesisHash *chainhash.Hash,
+	opts ...ServiceOption,
 ) Service {
-	return &scannerService{
+	s := &scannerService{
 		requestsQueue: newScanRequestQueue(),
+		rescanQueue:   newScanRequestQueue(),
 		filterDB:      filterDB,
 		headerDB:      headerDB,
 		blockService:  blockSvc,
 		quitCh:        make(chan struct{}),
 		genesisHash:   genesisHash,
+		gapLimit:      DefaultGapLimit,
+		rescanWorkers: DefaultRescanWorkers,
+
+		scannedHeights:     make(map[uuid.UUID]uint32),
+		scannedHeightsLock: new(sync.RWMutex),
+		confirmations:      newConfirmationTracker(),
+		unconfirmed:        newUnconfirmedReports(),
+		unconfirmedSpends:  newUnconfirmedSpends(),
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
 func (s *scannerService) Start() (<-chan Report, error) {
@@ -90,10 +293,14 @@ func (s *scannerService) Start() (<-chan Report, error) {
 		return nil, fmt.Errorf("scanner already started")
 	}
 
-	s.quitCh = make(chan struct{}, 1)
+	s.quitCh = make(chan struct{})
 	resultCh := make(chan Report)
-	// start the requests manager
-	go s.requestsManager(resultCh)
+	// start the requests managers, rescans never delay the processing of new blocks
+	go s.requestsManager(s.requestsQueue, s.requestWorker, resultCh)
+	go s.requestsManager(s.rescanQueue, s.rescanWorker, resultCh)
+	if s.mempoolNotifier != nil {
+		go s.mempoolListener(s.mempoolNotifier.NotifyUnconfirmedTxs(), resultCh)
+	}
 
 	s.started = true
 	return resultCh, nil
@@ -102,14 +309,128 @@ func (s *scannerService) Start() (<-chan Report, error) {
 func (s *scannerService) Stop() {
 	log.Debugln("scanner: stopping scanner ...")
 
-	s.quitCh <- struct{}{}
+	close(s.quitCh)
 	s.started = false
 	//s.requestsQueue = newScanRequestQueue() TODO: commented cause data race
 }
 
 func (s *scannerService) Watch(opts ...ScanRequestOption) {
 	req := newScanRequest(opts...)
-	s.requestsQueue.enqueue(req)
+	// the start height is resolved by the requests manager, errors are reported
+	if !req.isStartResolved() {
+		s.requestsQueue.enqueueUnresolved(req)
+		return
+	}
+
+	s.queueFor(req.StartHeight).enqueue(req)
+}
+
+func (s *scannerService) ResolveStartHeight(opts ...ScanRequestOption) (uint32, error) {
+	req := newScanRequest(opts...)
+	if err := s.resolveStartHeight(req); err != nil {
+		return 0, err
+	}
+
+	return req.StartHeight, nil
+}
+
+// resolveStartHeight sets the start height of the request from its start time
+// or block hash
+func (s *scannerService) resolveStartHeight(req *ScanRequest) error {
+	ctx := context.Background()
+
+	if req.StartBlockHash != nil {
+		header, err := s.headerDB.GetBlockHeader(ctx, *req.StartBlockHash)
+		if err != nil {
+			return err
+		}
+
+		req.StartHeight = header.Height
+		req.StartBlockHash = nil
+	}
+
+	if !req.StartTime.IsZero() {
+		height, err := s.headerDB.GetHeightByTime(ctx, req.StartTime)
+		if err != nil {
+			return err
+		}
+
+		req.StartHeight = height
+		req.StartTime = time.Time{}
+	}
+
+	return nil
+}
+
+// resolveQueuedRequests resolves the start height of the queued requests and
+// moves them to the queue to be scanned from, an error report is sent for the
+// ones that can't be resolved
+func (s *scannerService) resolveQueuedRequests(queue *scanRequestQueue, reportsChan chan<- Report) {
+	for _, req := range queue.dequeueUnresolved() {
+		if err := s.resolveStartHeight(req); err != nil {
+			reportsChan <- Report{
+				Request: req,
+				Err:     err,
+			}
+			continue
+		}
+
+		s.queueFor(req.StartHeight).enqueue(req)
+	}
+}
+
+// watchFrom adds a new request originated by the resolution of parent, it is
+// dropped if parent has been removed in the meantime
+func (s *scannerService) watchFrom(parent *ScanRequest, opts ...ScanRequestOption) {
+	req := newScanRequest(opts...)
+	if parent == nil {
+		s.queueFor(req.StartHeight).enqueue(req)
+		return
+	}
+
+	// the request is handled together with its parent
+	if !s.requestsQueue.enqueueFrom(parent, req) {
+		s.rescanQueue.enqueueFrom(parent, req)
+	}
+}
+
+// queueFor returns the rescan queue if the start height is far behind the
+// chain tip, the requests queue otherwise
+func (s *scannerService) queueFor(startHeight uint32) *scanRequestQueue {
+	tip, err := s.headerDB.ChainTip(context.Background())
+	if err != nil {
+		return s.requestsQueue
+	}
+
+	if isRescan(startHeight, tip.Height) {
+		return s.rescanQueue
+	}
+	return s.requestsQueue
+}
+
+func (s *scannerService) Unwatch(requestID uuid.UUID) {
+	match := func(req *ScanRequest) bool {
+		return req.ClientID == requestID
+	}
+	removed := s.requestsQueue.remove(match) + s.rescanQueue.remove(match)
+	log.Debugf("scanner: removed %v requests of %v", removed, requestID)
+	s.confirmations.remove(match)
+	s.unconfirmed.remove(requestID)
+	s.unconfirmedSpends.remove(requestID)
+
+	s.scannedHeightsLock.Lock()
+	defer s.scannedHeightsLock.Unlock()
+
+	delete(s.scannedHeights, requestID)
+}
+
+func (s *scannerService) UnwatchItem(requestID uuid.UUID, item WatchItem) {
+	match := func(req *ScanRequest) bool {
+		return req.ClientID == requestID && sameItem(req.Item, item)
+	}
+	removed := s.requestsQueue.remove(match) + s.rescanQueue.remove(match)
+	log.Debugf("scanner: removed %v requests of %v", removed, requestID)
+	s.confirmations.remove(match)
 }
 
 func (s *scannerService) WatchDescriptorWallet(
@@ -118,80 +439,267 @@ func (s *scannerService) WatchDescriptorWallet(
 	eventType []EventType,
 	blockStart int,
 ) error {
+	return s.WatchDescriptorWallets(requestID, []string{desc}, eventType, blockStart)
+}
+
+func (s *scannerService) WatchDescriptorWallets(
+	requestID uuid.UUID,
+	descriptors []string,
+	eventType []EventType,
+	blockStart int,
+	requestOpts ...ScanRequestOption,
+) error {
+	// the pruned filters are downloaded again if there is a filter fetcher
+	if s.filterFetcher == nil {
+		prunedHeight, err := s.filterDB.GetPrunedHeight(context.Background())
+		if err != nil {
+			return err
+		}
+
+		if prunedHeight > 0 && uint32(blockStart) <= prunedHeight {
+			return repository.ErrPruned
+		}
+	}
+
+	watchUnspent, watchPegin, watchAsset := false, false, false
+	spentEvents := make([]EventType, 0)
 	for _, v := range eventType {
 		switch v {
 		case UnspentUtxo:
-			wallet, err := descriptor.Parse(desc)
+			watchUnspent = true
+		case Pegin:
+			watchPegin = true
+		case AssetUtxo:
+			watchAsset = true
+		case SpentUtxo, Issuance, Reissuance, Pegout:
+			spentEvents = append(spentEvents, v)
+		}
+	}
+	watchSpent := len(spentEvents) > 0
+
+	if !watchUnspent && !watchSpent && !watchPegin && !watchAsset {
+		return nil
+	}
+
+	if watchAsset && newScanRequest(requestOpts...).TrackedAsset == "" {
+		return ErrMissingTrackedAsset
+	}
+
+	// all descriptors are parsed before watching anything
+	branches := make([]branchDescriptor, 0, len(descriptors))
+	wallets := make([]descriptor.Wallet, 0, len(descriptors))
+	sources := make([]string, 0, len(descriptors))
+	blindingKeys := make([]*BlindingKeys, 0, len(descriptors))
+	for _, desc := range descriptors {
+		inner, keys, err := splitConfidentialDescriptor(desc)
+		if err != nil {
+			return err
+		}
+
+		expanded, err := expandMultipath(inner)
+		if err != nil {
+			return err
+		}
+
+		for _, v := range expanded {
+			wallet, err := parseWallet(v.descriptor)
 			if err != nil {
 				return err
 			}
 
-			var scripts []descriptor.ScriptResponse
-
-			if wallet.IsRange() {
-				scripts, err = wallet.Script(descriptor.WithRange(numOsScripts))
-				if err != nil {
-					return err
-				}
-
-				for _, v := range scripts {
-					s.Watch(
-						WithRequestID(requestID),
-						WithStartBlock(uint32(blockStart)),
-						WithWatchItem(&UnspentWatchItem{
-							outputScript: v.Script,
-						}),
-						WithPersistentWatch(),
-					)
-				}
-			} else {
-				scripts, err = wallet.Script(nil)
-				if err != nil {
-					return err
-				}
-
-				s.Watch(
-					WithRequestID(requestID),
-					WithStartBlock(uint32(blockStart)),
-					WithWatchItem(&UnspentWatchItem{
-						outputScript: scripts[0].Script,
-					}),
-					WithPersistentWatch(),
-				)
+			branches = append(branches, v)
+			wallets = append(wallets, wallet)
+			sources = append(sources, desc)
+			blindingKeys = append(blindingKeys, keys)
+		}
+	}
+
+	// derivations maps the derived scripts to their derivation
+	derivations := make(map[string]*ScriptDerivation)
+
+	baseOpts := append([]ScanRequestOption{
+		WithRequestID(requestID),
+		WithStartBlock(uint32(blockStart)),
+		WithPersistentWatch(),
+	}, requestOpts...)
+	// outpoints spent are discovered through the ones funded by the scripts
+	if watchSpent {
+		baseOpts = append(baseOpts, WithSpentTracking(spentEvents...))
+	}
+	// the double spends of the reported utxos are reported even if their
+	// spending is not
+	if (watchUnspent || watchAsset) && !containsEvent(spentEvents, SpentUtxo) {
+		baseOpts = append(baseOpts, withConflictTracking())
+	}
+	if watchPegin {
+		baseOpts = append(baseOpts, WithPeginTracking())
+	}
+	// the asset given in the options is watched only for AssetUtxo events
+	if !watchAsset {
+		baseOpts = append(baseOpts, WithAssetTracking(""))
+	}
+	if !watchUnspent {
+		baseOpts = append(baseOpts, WithSilentWatch())
+	}
+
+	req := newScanRequest(baseOpts...)
+
+	for i, wallet := range wallets {
+		opts := baseOpts
+		if keys := blindingKeys[i]; keys != nil {
+			opts = append(opts[:len(opts):len(opts)], WithBlindingKeys(*keys))
+		}
+
+		if !wallet.IsRange() {
+			scripts, err := wallet.Script(nil)
+			if err != nil {
+				return err
+			}
+
+			derivation := &ScriptDerivation{
+				Descriptor: sources[i],
+				Branch:     branches[i].branch,
 			}
+			derivations[string(scripts[0].Script)] = derivation
 
+			s.watchDerivedScripts(nil, nil, []derivedScript{{
+				script:     scripts[0].Script,
+				derivation: derivation,
+			}}, opts...)
+
+			continue
+		}
+
+		// range descriptors are derived up to the gap limit, the range is
+		// extended as soon as one of the derived scripts receives funds. A
+		// restored range is derived after the last used index saved
+		rangeDesc := newRangeDescriptor(wallet, sources[i], branches[i].branch, s.gapLimit)
+		var scripts []derivedScript
+		var err error
+		if usedIndex, ok := req.walletState.lastUsedIndex(sources[i], branches[i].branch); ok {
+			scripts, err = rangeDesc.extend(usedIndex)
+		} else {
+			scripts, err = rangeDesc.initialWindow()
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, v := range scripts {
+			derivations[string(v.script)] = v.derivation
+		}
+
+		s.watchDerivedScripts(nil, rangeDesc, scripts, opts...)
+	}
+
+	// the outpoints funded before the start height are not found by the scan,
+	// their spending is tracked from the saved state
+	if req.SpentTracking && req.walletState != nil {
+		for _, v := range req.walletState.Unspents {
+			if v.BlockHeight >= req.StartHeight {
+				continue
+			}
+
+			hash := v.Hash
+			s.watchSpentOutpoint(nil, req, SpentWatchItem{
+				hash:         &hash,
+				index:        v.Index,
+				outputScript: v.Script,
+				derivation:   derivations[string(v.Script)],
+			}, req.StartHeight)
 		}
 	}
 
 	return nil
 }
 
+func (s *scannerService) ScannedHeight(requestID uuid.UUID) (uint32, bool) {
+	s.scannedHeightsLock.RLock()
+	defer s.scannedHeightsLock.RUnlock()
+
+	height, ok := s.scannedHeights[requestID]
+	return height, ok
+}
+
+// updateScannedHeights takes a snapshot of the scan progress of every client
+// the in flight requests are accounted from their start height
+func (s *scannerService) updateScannedHeights() {
+	nextHeights := s.requestsQueue.minStartHeights()
+	for clientID, height := range s.rescanQueue.minStartHeights() {
+		if nextHeight, ok := nextHeights[clientID]; !ok || height < nextHeight {
+			nextHeights[clientID] = height
+		}
+	}
+
+	scannedHeights := make(map[uuid.UUID]uint32, len(nextHeights))
+	for clientID, nextHeight := range nextHeights {
+		if nextHeight > 0 {
+			scannedHeights[clientID] = nextHeight - 1
+		}
+	}
+
+	s.scannedHeightsLock.Lock()
+	defer s.scannedHeightsLock.Unlock()
+
+	s.scannedHeights = scannedHeights
+}
+
 // requestsManager is responsible to resolve the requests that are waiting for in the queue.
-func (s *scannerService) requestsManager(ch chan<- Report) {
-	defer close(s.quitCh)
+// Once the requests caught up with the chain, it waits for new requests or
+// for new blocks/filters before scanning again.
+func (s *scannerService) requestsManager(
+	queue *scanRequestQueue,
+	worker func(queue *scanRequestQueue, startHeight uint32, reportsChan chan<- Report) (uint32, error),
+	ch chan<- Report,
+) {
+	var chainUpdates <-chan struct{}
+	var pollCh <-chan time.Time
+	if s.chainNotifier != nil {
+		chainUpdates = s.chainNotifier.NotifyChainUpdates()
+	} else {
+		ticker := time.NewTicker(chainPollInterval)
+		defer ticker.Stop()
+		pollCh = ticker.C
+	}
+
+	// the requests with start height >= waitHeight are parked until a chain
+	// event, they have been scanned up to the tip or are waiting for a filter
+	waitHeight := uint32(math.MaxUint32)
 
 	for {
-		s.requestsQueue.cond.L.Lock()
-		for s.requestsQueue.isEmpty() {
-			logrus.Debug("scanner: scanner queue is empty, waiting for new requests")
-			s.requestsQueue.cond.Wait() // wait for new requests
+		s.resolveQueuedRequests(queue, ch)
+		s.sendConfirmations(ch)
+
+		if err := s.rejectPrunedRequests(queue, ch); err != nil {
+			logrus.Errorf("error while rejecting pruned requests: %v", err)
+		}
+
+		// get the next request without removing it from the queue
+		nextRequest := queue.peek()
+		if nextRequest == nil || nextRequest.StartHeight >= waitHeight {
+			logrus.Debug("scanner: requests caught up, waiting for new requests or blocks")
 
-			// check if we should quit the routine
 			select {
 			case <-s.quitCh:
-				s.requestsQueue.cond.L.Unlock()
 				return
-			default:
+			case <-queue.wakeCh:
+			case <-chainUpdates:
+				waitHeight = math.MaxUint32
+			case <-pollCh:
+				waitHeight = math.MaxUint32
 			}
+			continue
 		}
-		s.requestsQueue.cond.L.Unlock()
 
-		// get the next request without removing it from the queue
-		nextRequest := s.requestsQueue.peek()
-		err := s.requestWorker(nextRequest.StartHeight, ch)
+		stopHeight, err := worker(queue, nextRequest.StartHeight, ch)
 		if err != nil {
 			logrus.Errorf("error while scanning: %v", err)
+			// the in flight requests have been scanned up to the height reached,
+			// they are scanned again from there at the next chain event
+			queue.requeueInFlight(stopHeight)
 		}
+		waitHeight = stopHeight
+		s.updateScannedHeights()
 
 		// check if we should quit the routine
 		select {
@@ -200,73 +708,99 @@ func (s *scannerService) requestsManager(ch chan<- Report) {
 		default:
 			continue
 		}
+	}
+}
+
+// rejectPrunedRequests removes from the queue the requests starting at a
+// height whose filter has been pruned, an error report is sent for each of them.
+// Nothing is rejected if the pruned filters can be fetched again.
+func (s *scannerService) rejectPrunedRequests(queue *scanRequestQueue, reportsChan chan<- Report) error {
+	if s.filterFetcher != nil {
+		return nil
+	}
+
+	prunedHeight, err := s.filterDB.GetPrunedHeight(context.Background())
+	if err != nil {
+		return err
+	}
 
+	if prunedHeight == 0 {
+		return nil
 	}
+
+	for _, req := range queue.dequeueUpToHeight(prunedHeight) {
+		reportsChan <- Report{
+			BlockHeight: req.StartHeight,
+			Request:     req,
+			Err:         repository.ErrPruned,
+		}
+	}
+
+	return nil
 }
 
-// will check if any blocks has the requested item
-// if yes, will extract the transaction that match the item
-// TODO handle properly errors (enqueue the unresolved requests ??)
-func (s *scannerService) requestWorker(startHeight uint32, reportsChan chan<- Report) error {
-	nextBatch := make([]*ScanRequest, 0)
+// requestWorker sweeps the chain from startHeight: the requests starting at
+// each height join the in flight batch, every block filter is matched once
+// against the scripts of the whole batch and matching blocks are fetched once
+// it returns the height at which the scan stopped: the next one of the chain
+// tip, or the one of a block whose filter is missing. On error the requests
+// scanned up to the returned height are left in flight
+func (s *scannerService) requestWorker(
+	queue *scanRequestQueue,
+	startHeight uint32,
+	reportsChan chan<- Report,
+) (uint32, error) {
 	nextHeight := startHeight
 
 	chainTip, err := s.headerDB.ChainTip(context.Background())
 	if err != nil {
-		return err
+		return nextHeight, err
 	}
 
 	for nextHeight <= chainTip.Height {
-		// append all the requests with start height = nextHeight
-		nextBatch = append(nextBatch, s.requestsQueue.dequeueAtHeight(nextHeight)...)
-
-		itemsBytes := make([][]byte, len(nextBatch))
-		for i, req := range nextBatch {
-			itemsBytes[i] = req.Item.Bytes()
-		}
+		// add to the batch all the requests with start height = nextHeight
+		s.sendCompleted(reportsChan, nextHeight, queue.dequeueAtHeight(nextHeight)...)
 
-		// get the block hash for height
-		var blockHash *chainhash.Hash
-		if nextHeight == 0 {
-			blockHash = s.genesisHash
-		} else {
-			blockHash, err = s.headerDB.GetBlockHashByHeight(context.Background(), nextHeight)
-			if err != nil {
-				return err
+		itemsBytes, _ := queue.inFlightItems()
+		if len(itemsBytes) == 0 {
+			// nothing to scan until the start height of the next requests
+			height, ok := queue.nextHeight(nextHeight + 1)
+			if !ok || height > chainTip.Height {
+				nextHeight = chainTip.Height + 1
+				break
 			}
+
+			nextHeight = height
+			continue
 		}
 
-		// check with filterDB if the block has one of the items
-		matched, err := s.blockFilterMatches(itemsBytes, blockHash)
+		blockHash, err := s.blockHashAt(nextHeight)
 		if err != nil {
-			return err
+			return nextHeight, err
 		}
 
-		if matched {
-			reports, remainReqs, err := s.extractBlockMatches(blockHash, nextBatch)
-			if err != nil {
-				return err
+		// check with filterDB if the block has one of the items
+		matched, err := s.blockFilterMatches(itemsBytes, nextHeight, blockHash)
+		if err != nil {
+			if err != repository.ErrFilterNotFound {
+				return nextHeight, err
 			}
 
-			for _, report := range reports {
-				// send the report to the output channel
-				reportsChan <- report
-
-				// if the request is persistent, the scanner will keep watching the item at the next block height
-				if report.Request.IsPersistent {
-					s.Watch(
-						WithRequestID(report.Request.ClientID),
-						WithStartBlock(report.BlockHeight+1),
-						WithWatchItem(report.Request.Item),
-						WithPersistentWatch(),
-					)
-				}
+			// the genesis filter is never synced by the node, for any other block
+			// the filter may not be downloaded yet: stop here and retry from
+			// this height at the next scan
+			if nextHeight > 0 {
+				log.Debugf("scanner: filter not found for block %v, waiting for it", blockHash)
+				break
 			}
+		}
 
-			// if some requests remain, put them back in the next batch
-			// this will remove the resolved requests from the batch
-			nextBatch = remainReqs
+		if matched {
+			if err := s.resolveBlockMatches(queue, blockHash, reportsChan); err != nil {
+				return nextHeight, err
+			}
 		}
+		s.sendCompleted(reportsChan, nextHeight, queue.completeInFlight(nextHeight)...)
 
 		// increment the height to scan
 		// if nothing was found, we can just continue with same batch and next height
@@ -274,19 +808,280 @@ func (s *scannerService) requestWorker(startHeight uint32, reportsChan chan<- Re
 
 		chainTip, err = s.headerDB.ChainTip(context.Background())
 		if err != nil {
+			return nextHeight, err
+		}
+	}
+
+	// enqueue the remaining requests, they have been scanned up to nextHeight - 1
+	queue.requeueInFlight(nextHeight)
+
+	return nextHeight, nil
+}
+
+func (s *scannerService) blockHashAt(height uint32) (*chainhash.Hash, error) {
+	if height == 0 {
+		return s.genesisHash, nil
+	}
+
+	return s.headerDB.GetBlockHashByHeight(context.Background(), height)
+}
+
+// resolveBlockMatches sends the reports of the in flight requests matching
+// the block and removes them from the batch
+func (s *scannerService) resolveBlockMatches(
+	queue *scanRequestQueue,
+	blockHash *chainhash.Hash,
+	reportsChan chan<- Report,
+) error {
+	reports, err := s.extractBlockMatches(queue, blockHash)
+	if err != nil {
+		return err
+	}
+
+	for _, report := range reports {
+		if !queue.isInFlight(report.Request) {
+			continue
+		}
+
+		if err := s.extendDescriptorRange(report); err != nil {
 			return err
 		}
+
+		if report.Request.SpentTracking {
+			s.watchSpentOutpoints(report)
+		}
+
+		// send the report to the output channel
+		report.SeenUnconfirmed = s.unconfirmed.confirm(reportKey(report))
+		sent := !report.Request.Silent && !report.filtered
+		if sent && !report.Request.conflictsOnly {
+			reportsChan <- report
+		}
+		// the confirmed transaction conflicts with the unconfirmed one
+		// spending the same outpoints
+		if conflictTxHash := s.unconfirmedSpends.confirm(report); conflictTxHash != nil && sent {
+			conflict := report
+			conflict.ConflictTxHash = conflictTxHash
+			reportsChan <- conflict
+		}
+		if sent && !report.Request.conflictsOnly {
+			s.confirmations.track(report, report.Request.confirmationDepth())
+		}
+
+		// if the request is persistent, the scanner will keep watching the item at the next block height
+		if report.Request.IsPersistent && report.resolvesRequest() &&
+			!report.Request.endsAt(report.BlockHeight) {
+			s.watchFrom(
+				report.Request,
+				WithRequestID(report.Request.ClientID),
+				WithStartBlock(report.BlockHeight+1),
+				WithWatchItem(report.Request.Item),
+				WithPersistentWatch(),
+				withFlagsOf(report.Request),
+			)
+		}
 	}
 
-	// enqueue the remaining requests
-	for _, req := range nextBatch {
-		s.requestsQueue.enqueue(req)
+	// the resolved requests leave the batch, the bounded ones not watched at
+	// the next height are completed
+	resolved := make(map[*ScanRequest]struct{})
+	for _, report := range reports {
+		req := report.Request
+		if _, ok := resolved[req]; ok || !report.resolvesRequest() || !queue.isInFlight(req) {
+			continue
+		}
+		resolved[req] = struct{}{}
+		queue.resolved(req)
+
+		if req.isBounded() && (!req.IsPersistent || req.endsAt(report.BlockHeight)) {
+			s.sendCompleted(reportsChan, report.BlockHeight, req)
+		}
 	}
 
 	return nil
 }
 
-func (s *scannerService) blockFilterMatches(items [][]byte, blockHash *chainhash.Hash) (bool, error) {
+// resolvesRequest returns false if the report is filtered and its request
+// keeps watching the next blocks, eg. the output paying the script is not of
+// the watched asset. The spending of a watched outpoint resolves the request
+// anyway, the outpoint can't be spent again.
+func (r Report) resolvesRequest() bool {
+	if !r.filtered {
+		return true
+	}
+
+	_, spent := r.Request.Item.(outpointItem)
+	return spent
+}
+
+// sendCompleted sends a Completed report for each request
+func (s *scannerService) sendCompleted(reportsChan chan<- Report, height uint32, reqs ...*ScanRequest) {
+	for _, req := range reqs {
+		reportsChan <- Report{
+			BlockHeight: height,
+			Request:     req,
+			Completed:   true,
+		}
+	}
+}
+
+func (s *scannerService) watchDerivedScripts(
+	parent *ScanRequest,
+	rangeDesc *rangeDescriptor,
+	scripts []derivedScript,
+	opts ...ScanRequestOption,
+) {
+	req := newScanRequest(opts...)
+	for _, v := range scripts {
+		item := UnspentWatchItem{
+			outputScript: v.script,
+			derivation:   v.derivation,
+			descriptor:   rangeDesc,
+		}
+		s.watchFrom(parent, append(opts, WithWatchItem(&item))...)
+
+		// the peg-ins and asset outputs are reported by requests of their
+		// own, the range is extended by the one of the unspent item
+		if req.PeginTracking {
+			s.watchFrom(parent, append(
+				opts,
+				withDerivedWatch(),
+				WithWatchItem(&PeginWatchItem{UnspentWatchItem: item}),
+			)...)
+		}
+		if req.TrackedAsset != "" {
+			s.watchFrom(parent, append(
+				opts,
+				withDerivedWatch(),
+				WithWatchItem(&AssetWatchItem{UnspentWatchItem: item, asset: req.TrackedAsset}),
+			)...)
+		}
+	}
+}
+
+// extendDescriptorRange derives and watches new scripts of the range
+// descriptor if the reported script is within the gap limit of the last derived one
+func (s *scannerService) extendDescriptorRange(report Report) error {
+	item, ok := report.Request.Item.(*UnspentWatchItem)
+	if !ok || item.descriptor == nil {
+		return nil
+	}
+
+	scripts, err := item.descriptor.extend(item.derivation.Index)
+	if err != nil {
+		return err
+	}
+
+	if len(scripts) > 0 {
+		log.Debugf(
+			"scanner: extending descriptor range of %v up to index %v",
+			report.Request.ClientID, scripts[len(scripts)-1].derivation.Index,
+		)
+	}
+
+	// new scripts may receive funds in the same block
+	s.watchDerivedScripts(
+		report.Request,
+		item.descriptor,
+		scripts,
+		WithRequestID(report.Request.ClientID),
+		WithStartBlock(report.BlockHeight),
+		WithPersistentWatch(),
+		withFlagsOf(report.Request),
+	)
+
+	return nil
+}
+
+// watchSpentOutpoints registers a SpentWatchItem (or Issuance/PegoutWatchItem,
+// depending on the tracked events) for every output of the reported
+// transaction paying to the script of the (unspent) watch item
+func (s *scannerService) watchSpentOutpoints(report Report) {
+	item, ok := report.Request.Item.(*UnspentWatchItem)
+	if !ok {
+		return
+	}
+
+	txHash := report.Transaction.TxHash()
+	for _, out := range report.Outputs {
+		// the outpoint may be spent in the same block it is created
+		s.watchSpentOutpoint(report.Request, report.Request, SpentWatchItem{
+			hash:         &txHash,
+			index:        out.Index,
+			outputScript: item.outputScript,
+			derivation:   item.derivation,
+		}, report.BlockHeight)
+	}
+}
+
+// watchSpentOutpoint watches the spending of the outpoint from the given
+// height for the spent events tracked by req, the requests are dropped if
+// parent has been removed
+func (s *scannerService) watchSpentOutpoint(
+	parent *ScanRequest,
+	req *ScanRequest,
+	spent SpentWatchItem,
+	startHeight uint32,
+) {
+	for _, event := range req.spentEvents() {
+		var spentItem WatchItem
+		switch event {
+		case Issuance, Reissuance:
+			spentItem = &IssuanceWatchItem{
+				SpentWatchItem: spent,
+				reissuance:     event == Reissuance,
+			}
+		case Pegout:
+			spentItem = &PegoutWatchItem{SpentWatchItem: spent}
+		default:
+			spentItem = &SpentWatchItem{
+				hash:         spent.hash,
+				index:        spent.index,
+				outputScript: spent.outputScript,
+				derivation:   spent.derivation,
+			}
+		}
+
+		s.watchFrom(
+			parent,
+			WithRequestID(req.ClientID),
+			WithStartBlock(startHeight),
+			WithEndBlock(req.EndHeight),
+			WithWatchItem(spentItem),
+		)
+	}
+
+	if req.conflictTracking && !containsEvent(req.spentEvents(), SpentUtxo) {
+		s.watchFrom(
+			parent,
+			WithRequestID(req.ClientID),
+			WithStartBlock(startHeight),
+			WithEndBlock(req.EndHeight),
+			WithWatchItem(&SpentWatchItem{
+				hash:         spent.hash,
+				index:        spent.index,
+				outputScript: spent.outputScript,
+				derivation:   spent.derivation,
+			}),
+			withConflictsOnly(),
+		)
+	}
+}
+
+func containsEvent(events []EventType, event EventType) bool {
+	for _, v := range events {
+		if v == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *scannerService) blockFilterMatches(
+	items [][]byte,
+	height uint32,
+	blockHash *chainhash.Hash,
+) (bool, error) {
 	filterToFetchKey := repository.FilterKey{
 		BlockHash:  blockHash.CloneBytes(),
 		FilterType: repository.RegularFilter,
@@ -294,10 +1089,14 @@ func (s *scannerService) blockFilterMatches(items [][]byte, blockHash *chainhash
 
 	filter, err := s.filterDB.GetFilter(context.Background(), filterToFetchKey)
 	if err != nil {
-		if err == repository.ErrFilterNotFound {
-			return false, nil
+		if err != repository.ErrFilterNotFound || s.filterFetcher == nil {
+			return false, err
+		}
+
+		filter, err = s.fetchFilter(height, blockHash)
+		if err != nil {
+			return false, err
 		}
-		return false, err
 	}
 
 	gcsFilter, err := filter.GcsFilter()
@@ -314,38 +1113,125 @@ func (s *scannerService) blockFilterMatches(items [][]byte, blockHash *chainhash
 	return matched, nil
 }
 
-func (s *scannerService) extractBlockMatches(blockHash *chainhash.Hash, requests []*ScanRequest) ([]Report, []*ScanRequest, error) {
+// fetchFilter returns the filter of the block fetched on demand, together
+// with the ones of the next blocks. A failed fetch is tried again, if the
+// filter still can't be fetched ErrFilterNotFound is returned so the block is
+// scanned again later
+func (s *scannerService) fetchFilter(height uint32, blockHash *chainhash.Hash) (*repository.FilterEntry, error) {
+	if filter, ok := s.fetchedFilters.get(*blockHash); ok {
+		return filter, nil
+	}
+
+	// the genesis filter is never served
+	if height == 0 {
+		return nil, repository.ErrFilterNotFound
+	}
+
+	chainTip, err := s.headerDB.ChainTip(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	stopHeight := height + MaxFiltersPerFetch - 1
+	if stopHeight > chainTip.Height {
+		stopHeight = chainTip.Height
+	}
+
+	stopHash, err := s.blockHashAt(stopHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		filters, err := s.fetchFilterRange(height, stopHash)
+		if err == nil {
+			s.fetchedFilters.add(filters...)
+			if filter, ok := s.fetchedFilters.get(*blockHash); ok {
+				return filter, nil
+			}
+			return nil, repository.ErrFilterNotFound
+		}
+
+		log.Debugf(
+			"scanner: failed to fetch filters from block %v (attempt %v): %v",
+			height, attempt, err,
+		)
+		if attempt == filterFetchAttempts {
+			return nil, repository.ErrFilterNotFound
+		}
+
+		select {
+		case <-s.quitCh:
+			return nil, repository.ErrFilterNotFound
+		case <-time.After(filterFetchBackoff):
+		}
+	}
+}
+
+func (s *scannerService) fetchFilterRange(
+	startHeight uint32,
+	stopHash *chainhash.Hash,
+) ([]*repository.FilterEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), filterFetchTimeout)
+	defer cancel()
+
+	return s.filterFetcher.FetchFilters(ctx, startHeight, *stopHash)
+}
+
+// extractBlockMatches returns a report for every transaction of the block
+// matching one of the in flight requests
+func (s *scannerService) extractBlockMatches(
+	queue *scanRequestQueue,
+	blockHash *chainhash.Hash,
+) ([]Report, error) {
 	block, err := s.blockService.GetBlock(blockHash)
 	if err != nil {
 		if err == blockservice.ErrorBlockNotFound {
-			return nil, requests, nil // skip requests if block svc is not able to find the block
+			return nil, nil // skip requests if block svc is not able to find the block
 		}
 
-		return nil, nil, err
+		return nil, err
 	}
 
 	results := make([]Report, 0)
 
-	remainRequests := make([]*ScanRequest, 0)
-
-	for _, req := range requests {
-		reqMatchedAtLeastOneTime := false
-		for _, tx := range block.TransactionsData.Transactions {
-			if req.Item.Match(tx) {
-				reqMatchedAtLeastOneTime = true
-				results = append(results, Report{
-					Transaction: tx,
-					BlockHash:   blockHash,
-					BlockHeight: block.Header.Height,
-					Request:     req,
-				})
+	for i, tx := range block.TransactionsData.Transactions {
+		for _, match := range queue.matchInFlight(tx) {
+			report := newTxReport(tx, match)
+			report.BlockHash = blockHash
+			report.BlockHeight = block.Header.Height
+			report.TxIndex = uint32(i)
+			if match.request.confirmationDepth() > 0 {
+				report.Confirmations = 1
 			}
-		}
 
-		if !reqMatchedAtLeastOneTime {
-			remainRequests = append(remainRequests, req)
+			results = append(results, report)
 		}
 	}
 
-	return results, remainRequests, nil
+	return results, nil
+}
+
+// newTxReport returns the report of the transaction matching the request,
+// the outputs are unblinded with the request keys
+func newTxReport(tx *transaction.Transaction, match requestMatch) Report {
+	if keys := match.request.BlindingKeys; keys != nil {
+		keys.unblindOutputs(tx, match.details.Outputs)
+	}
+
+	report := Report{
+		Transaction: tx,
+		Operation:   classifyOperation(tx),
+		Outputs:     match.details.Outputs,
+		Inputs:      match.details.Inputs,
+		Pegins:      extractPegins(tx),
+		Pegouts:     extractPegouts(tx),
+		Request:     match.request,
+		Derivation:  itemDerivation(match.request.Item),
+	}
+	if filter, ok := match.request.Item.(reportFilter); ok {
+		report.filtered = !filter.filterReport(&report)
+	}
+
+	return report
 }
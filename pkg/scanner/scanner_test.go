@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/vulpemventures/go-elements/address"
 	"github.com/vulpemventures/go-elements/network"
 	"github.com/vulpemventures/go-elements/payment"
 	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
@@ -46,6 +47,11 @@ func TestWatch(t *testing.T) {
 		t.Fatalf("expected txid %s, got %s", txid, nextReport.Transaction.TxHash().String())
 	}
 
+	// the faucet pays to a confidential address
+	if len(nextReport.Outputs) != 1 || !nextReport.Outputs[0].IsConfidential() {
+		t.Fatalf("expected a confidential matched output, got %+v", nextReport.Outputs)
+	}
+
 	s.Stop()
 	if err := n.Stop(); err != nil {
 		t.Fatal(err)
@@ -248,3 +254,244 @@ loop:
 		t.Fatal(err)
 	}
 }
+
+func TestWalletDescriptorSpent(t *testing.T) {
+	n, s, reportCh := testutil.MakeNigiriTestServices(
+		testutil.PeerAddrLocal,
+		testutil.EsploraUrlLocal,
+		"regtest",
+	)
+
+	privkey, err := btcec.NewPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubkey := privkey.PubKey()
+
+	wpkhWalletDescriptor := fmt.Sprintf("wpkh(%v)", hex.EncodeToString(pubkey.SerializeCompressed()))
+
+	tip, err := n.GetChainTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// funding of the descriptor is not reported, only its spending
+	if err := s.WatchDescriptorWallet(
+		uuid.New(),
+		wpkhWalletDescriptor,
+		[]scanner.EventType{scanner.SpentUtxo},
+		int(tip.Height),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	txHex, txID, err := testutil.CreateTxFromKey(privkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.SendTransaction(txHex); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(time.Second * 3)
+	if err := testutil.GenerateToAddr("el1qq0mjw2fwsc20vr4q2ypq9w7dslg6436zaahl083qehyghv7td3wnaawhrpxphtjlh4xjwm6mu29tp9uczkl8cxfyatqc3vgms"); err != nil {
+		t.Fatal(err)
+	}
+
+	nextReport := <-reportCh
+
+	assert.Equal(t, scanner.SpentUtxo, nextReport.Request.Item.EventType())
+	assert.Equal(t, txID, nextReport.Transaction.TxHash().String())
+	assert.Len(t, nextReport.Inputs, 1)
+
+	s.Stop()
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second * 3)
+}
+
+func TestWalletDescriptorGapLimit(t *testing.T) {
+	n, s, reportCh := testutil.MakeNigiriTestServices(
+		testutil.PeerAddrLocal,
+		testutil.EsploraUrlLocal,
+		"regtest",
+	)
+
+	masterPrivateKey, err := testutil.GenerateMasterPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	childKey, err := masterPrivateKey.Derive(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// index 15 is within the initial window, index 30 is watched only after
+	// the range is extended by the funding of index 15
+	addresses := make([]string, 0)
+	for _, i := range []uint32{15, 30} {
+		child, err := childKey.Derive(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pubKey, err := child.ECPubKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p2wpkh := payment.FromPublicKey(pubKey, &network.Regtest, nil)
+		addr, err := p2wpkh.WitnessPubKeyHash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		addresses = append(addresses, addr)
+	}
+
+	masterPubKey, err := masterPrivateKey.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wpkhWalletDescriptor := fmt.Sprintf("wpkh(%v/1/*)", masterPubKey.String())
+
+	tip, err := n.GetChainTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.WatchDescriptorWallet(
+		uuid.New(),
+		wpkhWalletDescriptor,
+		[]scanner.EventType{scanner.UnspentUtxo},
+		int(tip.Height),
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, addr := range addresses {
+		txID, err := testutil.Faucet(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case r := <-reportCh:
+			assert.Equal(t, txID, r.Transaction.TxHash().String())
+			assert.Equal(t, wpkhWalletDescriptor, r.Derivation.Descriptor)
+			assert.Equal(t, uint32(1), r.Derivation.Branch)
+			assert.Equal(t, []uint32{15, 30}[i], r.Derivation.Index)
+		case <-time.After(time.Minute):
+			t.Fatalf("expected report for address %v", addr)
+		}
+	}
+
+	s.Stop()
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second * 3)
+}
+
+func TestWatchEndHeight(t *testing.T) {
+	const address = "el1qq0mjw2fwsc20vr4q2ypq9w7dslg6436zaahl083qehyghv7td3wnaawhrpxphtjlh4xjwm6mu29tp9uczkl8cxfyatqc3vgms"
+
+	n, s, reportCh := testutil.MakeNigiriTestServices(
+		testutil.PeerAddrLocal,
+		testutil.EsploraUrlLocal,
+		"regtest",
+	)
+
+	watchItem, err := scanner.NewUnspentWatchItemFromAddress(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tip, err := n.GetChainTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the watch ends with the next block, whatever it contains
+	s.Watch(
+		scanner.WithStartBlock(tip.Height+1),
+		scanner.WithEndBlock(tip.Height+1),
+		scanner.WithWatchItem(watchItem),
+		scanner.WithPersistentWatch(),
+	)
+	txid, err := testutil.Faucet(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nextReport := <-reportCh
+	assert.False(t, nextReport.Completed)
+	assert.Equal(t, txid, nextReport.Transaction.TxHash().String())
+
+	nextReport = <-reportCh
+	assert.True(t, nextReport.Completed)
+	assert.Equal(t, tip.Height+1, nextReport.BlockHeight)
+
+	s.Stop()
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second * 3)
+}
+
+func TestWatchTxConfirmation(t *testing.T) {
+	const addr = "el1qq0mjw2fwsc20vr4q2ypq9w7dslg6436zaahl083qehyghv7td3wnaawhrpxphtjlh4xjwm6mu29tp9uczkl8cxfyatqc3vgms"
+
+	n, s, reportCh := testutil.MakeNigiriTestServices(
+		testutil.PeerAddrLocal,
+		testutil.EsploraUrlLocal,
+		"regtest",
+	)
+
+	tip, err := n.GetChainTip()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	txid, err := testutil.Faucet(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := address.ToOutputScript(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watchItem, err := scanner.NewTxConfirmationWatchItem(txid, script, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Watch(scanner.WithStartBlock(tip.Height+1), scanner.WithWatchItem(watchItem))
+
+	nextReport := <-reportCh
+	assert.Equal(t, scanner.TxConfirmation, nextReport.Request.Item.EventType())
+	assert.Equal(t, txid, nextReport.Transaction.TxHash().String())
+	assert.Equal(t, uint32(1), nextReport.Confirmations)
+	assert.Len(t, nextReport.Outputs, 1)
+
+	// the next block confirms the transaction again
+	if _, err := testutil.Faucet(addr); err != nil {
+		t.Fatal(err)
+	}
+
+	confirmedHeight := nextReport.BlockHeight
+	nextReport = <-reportCh
+	assert.Equal(t, txid, nextReport.Transaction.TxHash().String())
+	assert.Equal(t, uint32(2), nextReport.Confirmations)
+	assert.Equal(t, confirmedHeight, nextReport.BlockHeight)
+
+	s.Stop()
+	if err := n.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second * 3)
+}
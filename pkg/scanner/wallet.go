@@ -0,0 +1,161 @@
+package scanner
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/vulpemventures/go-elements/address"
+	"github.com/vulpemventures/go-elements/descriptor"
+)
+
+const (
+	// P2WPKH, P2SHP2WPKH and P2PKH are the script types of the addresses
+	// derived from an extended public key
+	P2WPKH     ScriptType = "p2wpkh"
+	P2SHP2WPKH ScriptType = "p2sh-p2wpkh"
+	P2PKH      ScriptType = "p2pkh"
+)
+
+var (
+	ErrUnsupportedScriptType = errors.New("unsupported script type")
+	ErrInvalidExtendedKey    = errors.New("invalid extended public key")
+)
+
+type ScriptType string
+
+// ExtendedKeyDescriptor returns the descriptor of the scripts of the given
+// type derived from the extended public key, both the receive (0) and change
+// (1) branches are watched. The default script type is P2WPKH.
+func ExtendedKeyDescriptor(xpub string, scriptType ScriptType) (string, error) {
+	key, err := hdkeychain.NewKeyFromString(xpub)
+	if err != nil || key.IsPrivate() {
+		return "", ErrInvalidExtendedKey
+	}
+
+	keyExpr := xpub + "/<0;1>/*"
+	switch scriptType {
+	case P2WPKH, "":
+		return "elwpkh(" + keyExpr + ")", nil
+	case P2SHP2WPKH:
+		return "elsh(wpkh(" + keyExpr + "))", nil
+	case P2PKH:
+		return "elpkh(" + keyExpr + ")", nil
+	default:
+		return "", ErrUnsupportedScriptType
+	}
+}
+
+// AddressDescriptor returns the descriptor of the script of the address,
+// confidential or not
+func AddressDescriptor(addr string) (string, error) {
+	if _, err := address.ToOutputScript(addr); err != nil {
+		return "", err
+	}
+
+	return "addr(" + addr + ")", nil
+}
+
+// parseWallet parses the descriptors supported by go-elements (elwpkh), plus
+// the elpkh, elsh(wpkh) and addr ones
+func parseWallet(desc string) (descriptor.Wallet, error) {
+	if i := strings.Index(desc, "#"); i >= 0 {
+		desc = desc[:i]
+	}
+
+	switch {
+	case strings.HasPrefix(desc, "elpkh(") && strings.HasSuffix(desc, ")"):
+		return parseWrappedWallet("elwpkh("+desc[len("elpkh("):], "pkh", p2pkhScript)
+	case strings.HasPrefix(desc, "elsh(wpkh(") && strings.HasSuffix(desc, "))"):
+		return parseWrappedWallet("elwpkh("+desc[len("elsh(wpkh("):len(desc)-1], "sh-wpkh", p2shScript)
+	case strings.HasPrefix(desc, "addr(") && strings.HasSuffix(desc, ")"):
+		script, err := address.ToOutputScript(desc[len("addr(") : len(desc)-1])
+		if err != nil {
+			return nil, err
+		}
+		return addressWallet{script}, nil
+	default:
+		return descriptor.Parse(desc)
+	}
+}
+
+func parseWrappedWallet(
+	wpkhDesc string,
+	walletType string,
+	wrap func(wpkhScript []byte) ([]byte, error),
+) (descriptor.Wallet, error) {
+	wallet, err := descriptor.Parse(wpkhDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	return wrappedWallet{wallet, walletType, wrap}, nil
+}
+
+// wrappedWallet derives the keys of a wpkh wallet, the scripts are those of
+// another type for the same keys
+type wrappedWallet struct {
+	descriptor.Wallet
+	walletType string
+	wrap       func(wpkhScript []byte) ([]byte, error)
+}
+
+func (w wrappedWallet) Type() string {
+	return w.walletType
+}
+
+func (w wrappedWallet) Script(opts *descriptor.ScriptOpts) ([]descriptor.ScriptResponse, error) {
+	scripts, err := w.Wallet.Script(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range scripts {
+		script, err := w.wrap(v.Script)
+		if err != nil {
+			return nil, err
+		}
+		scripts[i].Script = script
+	}
+
+	return scripts, nil
+}
+
+// p2pkhScript returns the p2pkh script of the key hash of the wpkh script
+func p2pkhScript(wpkhScript []byte) ([]byte, error) {
+	return txscript.NewScriptBuilder().
+		AddOp(txscript.OP_DUP).
+		AddOp(txscript.OP_HASH160).
+		AddData(wpkhScript[2:]).
+		AddOp(txscript.OP_EQUALVERIFY).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+}
+
+// p2shScript returns the p2sh script nesting the wpkh one
+func p2shScript(wpkhScript []byte) ([]byte, error) {
+	return txscript.NewScriptBuilder().
+		AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(wpkhScript)).
+		AddOp(txscript.OP_EQUAL).
+		Script()
+}
+
+// addressWallet watches the script of a single address
+type addressWallet struct {
+	script []byte
+}
+
+func (a addressWallet) Type() string {
+	return "addr"
+}
+
+func (a addressWallet) IsRange() bool {
+	return false
+}
+
+func (a addressWallet) Script(*descriptor.ScriptOpts) ([]descriptor.ScriptResponse, error) {
+	return []descriptor.ScriptResponse{{Script: a.script}}, nil
+}
@@ -0,0 +1,78 @@
+package scanner
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/address"
+	"github.com/vulpemventures/go-elements/descriptor"
+)
+
+func TestExtendedKeyDescriptor(t *testing.T) {
+	const xpub = "xpub69H7F5d8KSRgmmdJg2KhpAK8SR3DjMwAdkxj3ZuxV27CprR9LgpeyGmXUbC6wb7ERfvrnKZjXoUmmDznezpbZb7ap6r1D3tgFxHmwMkQTPH"
+
+	wpkhDesc, err := ExtendedKeyDescriptor(xpub, "")
+	require.NoError(t, err)
+	require.Equal(t, "elwpkh("+xpub+"/<0;1>/*)", wpkhDesc)
+
+	wpkhWallet, err := descriptor.Parse("elwpkh(" + xpub + "/1/*)")
+	require.NoError(t, err)
+	wpkhScripts, err := wpkhWallet.Script(descriptor.WithIndex(3))
+	require.NoError(t, err)
+	keyHash := wpkhScripts[0].Script[2:]
+
+	tests := []struct {
+		scriptType ScriptType
+		expected   []byte
+	}{
+		{P2WPKH, wpkhScripts[0].Script},
+		{P2PKH, append(append([]byte{0x76, 0xa9, 0x14}, keyHash...), 0x88, 0xac)},
+		{P2SHP2WPKH, append(append([]byte{0xa9, 0x14}, btcutil.Hash160(wpkhScripts[0].Script)...), 0x87)},
+	}
+	for _, tt := range tests {
+		desc, err := ExtendedKeyDescriptor(xpub, tt.scriptType)
+		require.NoError(t, err)
+
+		// the change branch is watched with the same gap limit
+		expanded, err := expandMultipath(desc)
+		require.NoError(t, err)
+		require.Len(t, expanded, 2)
+		require.Equal(t, uint32(1), expanded[1].branch)
+
+		wallet, err := parseWallet(expanded[1].descriptor)
+		require.NoError(t, err)
+		require.True(t, wallet.IsRange())
+
+		scripts, err := newRangeDescriptor(wallet, desc, 1, 5).initialWindow()
+		require.NoError(t, err)
+		require.Len(t, scripts, 5)
+		require.Equal(t, tt.expected, scripts[3].script)
+	}
+
+	_, err = ExtendedKeyDescriptor(xpub, "p2tr")
+	require.ErrorIs(t, err, ErrUnsupportedScriptType)
+	_, err = ExtendedKeyDescriptor("xpub", P2WPKH)
+	require.ErrorIs(t, err, ErrInvalidExtendedKey)
+}
+
+func TestAddressDescriptor(t *testing.T) {
+	const addr = "el1qq0mjw2fwsc20vr4q2ypq9w7dslg6436zaahl083qehyghv7td3wnaawhrpxphtjlh4xjwm6mu29tp9uczkl8cxfyatqc3vgms"
+
+	desc, err := AddressDescriptor(addr)
+	require.NoError(t, err)
+	require.Equal(t, "addr("+addr+")", desc)
+
+	wallet, err := parseWallet(desc)
+	require.NoError(t, err)
+	require.False(t, wallet.IsRange())
+
+	expected, err := address.ToOutputScript(addr)
+	require.NoError(t, err)
+	scripts, err := wallet.Script(nil)
+	require.NoError(t, err)
+	require.Equal(t, expected, scripts[0].Script)
+
+	_, err = AddressDescriptor("invalid")
+	require.Error(t, err)
+}
@@ -6,14 +6,17 @@ import (
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/vulpemventures/go-elements/address"
 	"github.com/vulpemventures/go-elements/transaction"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // WatchItem is an interface containing the common methods using by Scanner to watch specific item.
 type WatchItem interface {
 	// Bytes returns the element search in the block filter
 	Bytes() []byte
-	// Match is used to check if a transaction matches the watch item
-	Match(tx *transaction.Transaction) bool
+	// Match is used to check if a transaction matches the watch item, it
+	// returns the matching outputs and inputs or nil if the tx doesn't match
+	Match(tx *transaction.Transaction) *MatchDetails
 	// EventType returns the type of event that will be reported by the scanner
 	EventType() EventType
 }
@@ -23,6 +26,8 @@ type SpentWatchItem struct {
 	hash         *chainhash.Hash // tx hash of the outpoint
 	index        uint32          // index of the outpoint
 	outputScript []byte          // the way the outpoint should be spent
+	// derivation is set if the outpoint script is derived from a wallet descriptor
+	derivation *ScriptDerivation
 }
 
 func NewSpentWatchItemFromInput(
@@ -45,27 +50,38 @@ func (o *SpentWatchItem) Bytes() []byte {
 	return o.outputScript
 }
 
-func (o *SpentWatchItem) Match(tx *transaction.Transaction) bool {
-	for _, txInput := range tx.Inputs {
-		chainHashTxInput, err := chainhash.NewHash(txInput.Hash)
-		if err != nil {
+func (o *SpentWatchItem) Match(tx *transaction.Transaction) *MatchDetails {
+	for i, txInput := range tx.Inputs {
+		if !bytes.Equal(txInput.Hash, o.hash[:]) || txInput.Index != o.index {
 			continue
 		}
 
-		if o.hash.IsEqual(chainHashTxInput) && o.index == txInput.Index {
-			return true
+		// the spending is reported even if its issuance can't be parsed
+		input, err := newMatchedInput(i, txInput)
+		if err != nil {
+			log.Warnf("scanner: invalid issuance in input %v of tx %v: %v", i, tx.TxHash(), err)
 		}
+		return &MatchDetails{Inputs: []MatchedInput{input}}
 	}
-	return false
+	return nil
 }
 
 func (o *SpentWatchItem) EventType() EventType {
 	return SpentUtxo
 }
 
+func (o *SpentWatchItem) outpoint() outpointKey {
+	return outpointKey{*o.hash, o.index}
+}
+
 // UnspentWatchItem is used to recognise new unspent output related to a specific address/script
 type UnspentWatchItem struct {
 	outputScript []byte
+
+	// derivation is set if the script is derived from a wallet descriptor,
+	// descriptor is set too if it is a range one
+	derivation *ScriptDerivation
+	descriptor *rangeDescriptor
 }
 
 func NewUnspentWatchItemFromAddress(addr string) (WatchItem, error) {
@@ -83,15 +99,76 @@ func (u *UnspentWatchItem) Bytes() []byte {
 	return u.outputScript
 }
 
-func (u *UnspentWatchItem) Match(tx *transaction.Transaction) bool {
-	for _, txOutput := range tx.Outputs {
+func (u *UnspentWatchItem) Match(tx *transaction.Transaction) *MatchDetails {
+	var details *MatchDetails
+	for i, txOutput := range tx.Outputs {
 		if bytes.Equal(u.outputScript, txOutput.Script) {
-			return true
+			if details == nil {
+				details = &MatchDetails{}
+			}
+			details.Outputs = append(details.Outputs, newMatchedOutput(i, txOutput))
 		}
 	}
-	return false
+	return details
 }
 
 func (u *UnspentWatchItem) EventType() EventType {
 	return UnspentUtxo
 }
+
+func (u *UnspentWatchItem) script() []byte {
+	return u.outputScript
+}
+
+// outpointItem is implemented by the items watching the spending of an outpoint
+type outpointItem interface {
+	outpoint() outpointKey
+}
+
+// scriptItem is implemented by the items watching the outputs paying to a script
+type scriptItem interface {
+	script() []byte
+}
+
+// itemDerivation returns the descriptor derivation of the item script, if any
+func itemDerivation(item WatchItem) *ScriptDerivation {
+	switch v := item.(type) {
+	case *UnspentWatchItem:
+		return v.derivation
+	case *SpentWatchItem:
+		return v.derivation
+	case *IssuanceWatchItem:
+		return v.derivation
+	case *AssetWatchItem:
+		return v.derivation
+	case *PeginWatchItem:
+		return v.derivation
+	case *PegoutWatchItem:
+		return v.derivation
+	default:
+		return nil
+	}
+}
+
+// sameItem returns true if the items watch for the same event on the same
+// script (and outpoint, asset or transaction for the items watching them)
+func sameItem(a, b WatchItem) bool {
+	if a.EventType() != b.EventType() || !bytes.Equal(a.Bytes(), b.Bytes()) {
+		return false
+	}
+
+	if !sameAsset(a, b) || !sameTx(a, b) {
+		return false
+	}
+
+	spentA, ok := a.(outpointItem)
+	if !ok {
+		return true
+	}
+	spentB, ok := b.(outpointItem)
+	if !ok {
+		return false
+	}
+
+	return spentA.outpoint() == spentB.outpoint()
+}
@@ -0,0 +1,394 @@
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/btcsuite/btcd/btcutil/gcs/builder"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	log "github.com/sirupsen/logrus"
+	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+)
+
+// A snapshot file is made of:
+//   - magic (4 bytes) | version (uint32) | network magic (4 bytes) | end height (uint32)
+//   - for each height from 1 to end height:
+//     header length (uint32) | serialized header | filter length (uint32) | filter NBytes
+//     a filter length equal to 0 means the filter of the block is not part of the snapshot
+//   - sha256 checksum (32 bytes) of all the previous bytes
+// all integers are little endian.
+
+const (
+	// Version is the current version of the snapshot format
+	Version uint32 = 1
+
+	// writeBatchSize is the number of headers written at once during import
+	writeBatchSize = 2000
+	// maxEntrySize protects against allocating huge buffers for corrupted files
+	maxEntrySize = 32 * 1024 * 1024
+)
+
+var (
+	fileMagic = [4]byte{'n', 'e', 's', 'n'}
+
+	ErrInvalidMagic        = errors.New("snapshot: invalid file magic")
+	ErrUnsupportedVersion  = errors.New("snapshot: unsupported version")
+	ErrNetworkMismatch     = errors.New("snapshot: network mismatch")
+	ErrInvalidChecksum     = errors.New("snapshot: invalid checksum")
+	ErrBrokenLinkage       = errors.New("snapshot: headers are not linked")
+	ErrCheckpointMismatch  = errors.New("snapshot: header does not match checkpoint")
+	ErrConflictingChain    = errors.New("snapshot: conflicts with the headers in repository")
+	ErrEntryTooLarge       = errors.New("snapshot: entry too large")
+	ErrInvalidSnapshotTip  = errors.New("snapshot: end height must be greater than 0")
+	ErrHeaderHeightInvalid = errors.New("snapshot: unexpected header height")
+)
+
+// Info describes the content of a snapshot
+type Info struct {
+	Version   uint32
+	Network   protocol.Magic
+	EndHeight uint32
+	// NumFilters is the number of filters included in the snapshot
+	NumFilters uint32
+}
+
+// Export writes to w the headers and filters, from height 1 up to endHeight.
+// If endHeight is 0, the current chain tip is used.
+func Export(
+	ctx context.Context,
+	w io.Writer,
+	network protocol.Magic,
+	headerDB repository.BlockHeaderRepository,
+	filterDB repository.FilterRepository,
+	endHeight uint32,
+) (*Info, error) {
+	if endHeight == 0 {
+		tip, err := headerDB.ChainTip(ctx)
+		if err != nil {
+			return nil, err
+		}
+		endHeight = tip.Height
+	}
+
+	if endHeight == 0 {
+		return nil, ErrInvalidSnapshotTip
+	}
+
+	hasher := sha256.New()
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, hasher)
+
+	info := &Info{
+		Version:   Version,
+		Network:   network,
+		EndHeight: endHeight,
+	}
+
+	if _, err := out.Write(fileMagic[:]); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(out, binary.LittleEndian, Version); err != nil {
+		return nil, err
+	}
+	if _, err := out.Write(network[:]); err != nil {
+		return nil, err
+	}
+	if err := binary.Write(out, binary.LittleEndian, endHeight); err != nil {
+		return nil, err
+	}
+
+	for height := uint32(1); height <= endHeight; height++ {
+		hash, err := headerDB.GetBlockHashByHeight(ctx, height)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block hash at height %d: %w", height, err)
+		}
+
+		header, err := headerDB.GetBlockHeader(ctx, *hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block header %s: %w", hash, err)
+		}
+
+		headerBytes, err := header.Serialize()
+		if err != nil {
+			return nil, err
+		}
+
+		var filterBytes []byte
+		filter, err := filterDB.GetFilter(ctx, repository.FilterKey{
+			BlockHash:  hash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		})
+		if err != nil {
+			if err != repository.ErrFilterNotFound {
+				return nil, err
+			}
+			log.Warnf("snapshot: filter not found for block %s, exporting header only", hash)
+		} else {
+			filterBytes = filter.NBytes
+			info.NumFilters++
+		}
+
+		if err := writeEntry(out, headerBytes); err != nil {
+			return nil, err
+		}
+		if err := writeEntry(out, filterBytes); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := bw.Write(hasher.Sum(nil)); err != nil {
+		return nil, err
+	}
+
+	return info, bw.Flush()
+}
+
+// Verify checks the checksum, the network, the headers linkage and the
+// checkpoints of the snapshot without importing it.
+func Verify(r io.Reader, network protocol.Magic) (*Info, error) {
+	return readSnapshot(r, network, nil)
+}
+
+// Import verifies the snapshot and then writes its headers and filters in the
+// repositories. Headers already in the repository are skipped, but they must
+// belong to the same chain of the snapshot.
+func Import(
+	ctx context.Context,
+	r io.ReadSeeker,
+	network protocol.Magic,
+	headerDB repository.BlockHeaderRepository,
+	filterDB repository.FilterRepository,
+) (*Info, error) {
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+
+	tip, err := headerDB.ChainTip(ctx)
+	if err != nil {
+		if err != repository.ErrNoBlocksHeaders {
+			return nil, err
+		}
+		tip = nil
+	}
+
+	// nothing is written until the whole snapshot is verified, the headers
+	// overlapping the local chain included
+	if _, err := readSnapshot(r, network, func(header *block.Header, hash chainhash.Hash, _ []byte) error {
+		if tip == nil || header.Height > tip.Height {
+			return nil
+		}
+
+		localHash, err := headerDB.GetBlockHashByHeight(ctx, header.Height)
+		if err != nil {
+			return err
+		}
+		if !localHash.IsEqual(&hash) {
+			return ErrConflictingChain
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	batch := make([]block.Header, 0, writeBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := headerDB.WriteHeaders(ctx, batch...); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	info, err := readSnapshot(r, network, func(header *block.Header, hash chainhash.Hash, filter []byte) error {
+		if tip == nil || header.Height > tip.Height {
+			batch = append(batch, *header)
+			if len(batch) >= writeBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(filter) == 0 {
+			return nil
+		}
+
+		return filterDB.PutFilter(ctx, &repository.FilterEntry{
+			Key: repository.FilterKey{
+				BlockHash:  hash.CloneBytes(),
+				FilterType: repository.RegularFilter,
+			},
+			NBytes: filter,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// readSnapshot parses and verifies the snapshot, calling onEntry (if not nil)
+// for every header in height order.
+func readSnapshot(
+	r io.Reader,
+	network protocol.Magic,
+	onEntry func(header *block.Header, hash chainhash.Hash, filter []byte) error,
+) (*Info, error) {
+	hasher := sha256.New()
+	in := &hashingReader{r: bufio.NewReader(r), hasher: hasher}
+
+	var magic [4]byte
+	if _, err := io.ReadFull(in, magic[:]); err != nil {
+		return nil, err
+	}
+	if magic != fileMagic {
+		return nil, ErrInvalidMagic
+	}
+
+	info := &Info{}
+	if err := binary.Read(in, binary.LittleEndian, &info.Version); err != nil {
+		return nil, err
+	}
+	if info.Version != Version {
+		return nil, ErrUnsupportedVersion
+	}
+	if _, err := io.ReadFull(in, info.Network[:]); err != nil {
+		return nil, err
+	}
+	if info.Network != network {
+		return nil, ErrNetworkMismatch
+	}
+	if err := binary.Read(in, binary.LittleEndian, &info.EndHeight); err != nil {
+		return nil, err
+	}
+	if info.EndHeight == 0 {
+		return nil, ErrInvalidSnapshotTip
+	}
+
+	checkpoints := protocol.GetCheckpoints(network)
+	prevHash, err := chainhash.NewHashFromStr(checkpoints[0])
+	if err != nil {
+		return nil, err
+	}
+
+	for height := uint32(1); height <= info.EndHeight; height++ {
+		headerBytes, err := readEntry(in)
+		if err != nil {
+			return nil, err
+		}
+		filterBytes, err := readEntry(in)
+		if err != nil {
+			return nil, err
+		}
+
+		header, err := block.DeserializeHeader(bytes.NewBuffer(headerBytes))
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Height != height {
+			return nil, fmt.Errorf("%w: expected %d, got %d", ErrHeaderHeightInvalid, height, header.Height)
+		}
+
+		if !bytes.Equal(header.PrevBlockHash, prevHash.CloneBytes()) {
+			return nil, fmt.Errorf("%w at height %d", ErrBrokenLinkage, height)
+		}
+
+		hash, err := header.Hash()
+		if err != nil {
+			return nil, err
+		}
+
+		if checkpoint, ok := checkpoints[height]; ok && checkpoint != hash.String() {
+			return nil, fmt.Errorf("%w at height %d", ErrCheckpointMismatch, height)
+		}
+
+		if len(filterBytes) > 0 {
+			if _, err := gcs.FromNBytes(builder.DefaultP, builder.DefaultM, filterBytes); err != nil {
+				return nil, fmt.Errorf("snapshot: invalid filter at height %d: %w", height, err)
+			}
+			info.NumFilters++
+		}
+
+		if onEntry != nil {
+			if err := onEntry(header, hash, filterBytes); err != nil {
+				return nil, err
+			}
+		}
+
+		prevHash = &hash
+	}
+
+	expectedChecksum := hasher.Sum(nil)
+	var checksum [sha256.Size]byte
+	if _, err := io.ReadFull(in.r, checksum[:]); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(checksum[:], expectedChecksum) {
+		return nil, ErrInvalidChecksum
+	}
+
+	return info, nil
+}
+
+func writeEntry(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+func readEntry(r io.Reader) ([]byte, error) {
+	var length uint32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+
+	if length > maxEntrySize {
+		return nil, ErrEntryTooLarge
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// hashingReader hashes all the bytes read through it
+type hashingReader struct {
+	r      io.Reader
+	hasher hash.Hash
+}
+
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.hasher.Write(p[:n])
+	return n, err
+}
@@ -0,0 +1,230 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/gcs"
+	"github.com/stretchr/testify/require"
+	"github.com/vulpemventures/go-elements/block"
+	"github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/inmemory"
+	"github.com/vulpemventures/neutrino-elements/pkg/protocol"
+	"github.com/vulpemventures/neutrino-elements/pkg/repository"
+	"github.com/vulpemventures/neutrino-elements/pkg/snapshot"
+)
+
+var (
+	ctx = context.Background()
+
+	// regtest headers from height 1 to 5
+	regtestHeaders = []string{
+		"000000b021cab1e5da4718ea140d9716931702422f0e6ad915c8d9b583cac2706b2a9000ac20a615d9b0d4df3e3ac2cb7018a07bd314d6bb715a57adead7c03e208b3658c192d56201000000022200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a00000017a91472c44f957fc011d97e3406667dca5b1c930c4026870151014202fcba7ecf41bc7e1be4ee122d9d22e3333671eb0a3a87b5cdf099d59874e1940f02fcba7ecf41bc7e1be4ee122d9d22e3333671eb0a3a87b5cdf099d59874e1940f00010151",
+		"000000b00cbe7961ae265e4ff0a23ee6e73b6dcea894919747542cad9a1ec9f584fe555ecebbf12fff089fc6aca1e9f1c8e0dbfd00c001a8eeec2ab7b14d405c6ec4c091c552da6202000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+		"000000a0f51d387048f065d5b6a284f90d5c795deb55f913a83e6c17dcada6854c1e6e9d09ae9d6bdae43a2c6188ea6af1097980d7810fe0f95198fe3f22c7c35df0bdcdc552da6203000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+		"000000a009ac04fc51e004185689547548f45cf7780d323ff2e44c215db474c09729729629e7595e1920771b14a5065bf55a364dd07469d1f09b6b433372183b3ab1d5f8c652da6204000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+		"000000a0a3cbd75af5a7d40788c985ddbb56ac09b33126857359ff454ec872571b93edfeea5886799f0eebf85b795d6e75fe65bbbb8766e77f53acf6d20be1268672323dc652da6205000000012200204ae81572f06e1b88fd5ced7a1a000945432e83e1551e6f721ee9c00b8cc332604a000000fbee9cea00d8efdc49cfbec328537e0d7032194de6ebf3cf42e5c05bb89a08b100010151",
+	}
+)
+
+func TestExportImport(t *testing.T) {
+	headerDB, filterDB := newTestRepositories(t)
+
+	buf := new(bytes.Buffer)
+	info, err := snapshot.Export(ctx, buf, protocol.MagicRegtest, headerDB, filterDB, 0)
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), info.EndHeight)
+	require.Equal(t, uint32(4), info.NumFilters)
+
+	newHeaderDB := inmemory.NewHeaderInmemory()
+	newFilterDB := inmemory.NewFilterInmemory()
+
+	info, err = snapshot.Import(ctx, bytes.NewReader(buf.Bytes()), protocol.MagicRegtest, newHeaderDB, newFilterDB)
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), info.EndHeight)
+	require.Equal(t, uint32(4), info.NumFilters)
+
+	tip, err := newHeaderDB.ChainTip(ctx)
+	require.NoError(t, err)
+	require.Equal(t, uint32(5), tip.Height)
+
+	for height := uint32(1); height <= 4; height++ {
+		hash, err := newHeaderDB.GetBlockHashByHeight(ctx, height)
+		require.NoError(t, err)
+
+		_, err = newFilterDB.GetFilter(ctx, repository.FilterKey{
+			BlockHash:  hash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		})
+		require.NoError(t, err)
+	}
+
+	// importing again on top of the same chain is a no-op
+	_, err = snapshot.Import(ctx, bytes.NewReader(buf.Bytes()), protocol.MagicRegtest, newHeaderDB, newFilterDB)
+	require.NoError(t, err)
+}
+
+func TestExportPartial(t *testing.T) {
+	headerDB, filterDB := newTestRepositories(t)
+
+	buf := new(bytes.Buffer)
+	info, err := snapshot.Export(ctx, buf, protocol.MagicRegtest, headerDB, filterDB, 3)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), info.EndHeight)
+
+	info, err = snapshot.Verify(bytes.NewReader(buf.Bytes()), protocol.MagicRegtest)
+	require.NoError(t, err)
+	require.Equal(t, uint32(3), info.EndHeight)
+	require.Equal(t, uint32(3), info.NumFilters)
+}
+
+func TestImportInvalid(t *testing.T) {
+	headerDB, filterDB := newTestRepositories(t)
+
+	buf := new(bytes.Buffer)
+	_, err := snapshot.Export(ctx, buf, protocol.MagicRegtest, headerDB, filterDB, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		snapshot    func() []byte
+		network     protocol.Magic
+		expectedErr error
+	}{
+		{
+			name: "corrupted checksum",
+			snapshot: func() []byte {
+				b := append([]byte{}, buf.Bytes()...)
+				b[len(b)-1] ^= 0xff
+				return b
+			},
+			network:     protocol.MagicRegtest,
+			expectedErr: snapshot.ErrInvalidChecksum,
+		},
+		{
+			name: "invalid magic",
+			snapshot: func() []byte {
+				b := append([]byte{}, buf.Bytes()...)
+				b[0] = 'x'
+				return b
+			},
+			network:     protocol.MagicRegtest,
+			expectedErr: snapshot.ErrInvalidMagic,
+		},
+		{
+			name: "network mismatch",
+			snapshot: func() []byte {
+				return buf.Bytes()
+			},
+			network:     protocol.MagicLiquid,
+			expectedErr: snapshot.ErrNetworkMismatch,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(tt *testing.T) {
+			newHeaderDB := inmemory.NewHeaderInmemory()
+			_, err := snapshot.Import(
+				ctx,
+				bytes.NewReader(test.snapshot()),
+				test.network,
+				newHeaderDB,
+				inmemory.NewFilterInmemory(),
+			)
+			require.True(tt, errors.Is(err, test.expectedErr), err)
+
+			_, err = newHeaderDB.ChainTip(ctx)
+			require.Equal(tt, repository.ErrNoBlocksHeaders, err)
+		})
+	}
+}
+
+func TestImportConflictingShorterSnapshot(t *testing.T) {
+	headerDB, filterDB := newTestRepositories(t)
+
+	buf := new(bytes.Buffer)
+	_, err := snapshot.Export(ctx, buf, protocol.MagicRegtest, headerDB, filterDB, 3)
+	require.NoError(t, err)
+
+	// the local chain is longer than the snapshot and forks from it at
+	// height 2
+	headers := decodeHeaders(t)
+	headers[1].Timestamp++
+	localHeaderDB := inmemory.NewHeaderInmemory()
+	localFilterDB := inmemory.NewFilterInmemory()
+	require.NoError(t, localHeaderDB.WriteHeaders(ctx, headers...))
+
+	_, err = snapshot.Import(ctx, bytes.NewReader(buf.Bytes()), protocol.MagicRegtest, localHeaderDB, localFilterDB)
+	require.True(t, errors.Is(err, snapshot.ErrConflictingChain), err)
+
+	// nothing has been written
+	hash, err := headers[0].Hash()
+	require.NoError(t, err)
+	_, err = localFilterDB.GetFilter(ctx, repository.FilterKey{
+		BlockHash:  hash.CloneBytes(),
+		FilterType: repository.RegularFilter,
+	})
+	require.ErrorIs(t, err, repository.ErrFilterNotFound)
+}
+
+func TestImportBrokenLinkage(t *testing.T) {
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	// skip height 1, the header at height 2 doesn't link to genesis
+	headers := decodeHeaders(t)
+	headers[1].Height = 1
+	require.NoError(t, headerDB.WriteHeaders(ctx, headers[1]))
+
+	buf := new(bytes.Buffer)
+	_, err := snapshot.Export(ctx, buf, protocol.MagicRegtest, headerDB, filterDB, 1)
+	require.NoError(t, err)
+
+	_, err = snapshot.Verify(bytes.NewReader(buf.Bytes()), protocol.MagicRegtest)
+	require.True(t, errors.Is(err, snapshot.ErrBrokenLinkage), err)
+}
+
+func decodeHeaders(t *testing.T) []block.Header {
+	headers := make([]block.Header, 0, len(regtestHeaders))
+	for _, v := range regtestHeaders {
+		b, err := hex.DecodeString(v)
+		require.NoError(t, err)
+
+		header, err := block.DeserializeHeader(bytes.NewBuffer(b))
+		require.NoError(t, err)
+
+		headers = append(headers, *header)
+	}
+
+	return headers
+}
+
+// newTestRepositories returns repositories with the regtest headers and the
+// filters of all of them but the last one
+func newTestRepositories(t *testing.T) (repository.BlockHeaderRepository, repository.FilterRepository) {
+	headerDB := inmemory.NewHeaderInmemory()
+	filterDB := inmemory.NewFilterInmemory()
+
+	headers := decodeHeaders(t)
+	require.NoError(t, headerDB.WriteHeaders(ctx, headers...))
+
+	var key [gcs.KeySize]byte
+	for _, header := range headers[:len(headers)-1] {
+		hash, err := header.Hash()
+		require.NoError(t, err)
+
+		filter, err := gcs.BuildGCSFilter(19, 784931, key, [][]byte{hash.CloneBytes()})
+		require.NoError(t, err)
+
+		entry, err := repository.NewFilterEntry(repository.FilterKey{
+			BlockHash:  hash.CloneBytes(),
+			FilterType: repository.RegularFilter,
+		}, filter)
+		require.NoError(t, err)
+		require.NoError(t, filterDB.PutFilter(ctx, entry))
+	}
+
+	return headerDB, filterDB
+}
@@ -48,6 +48,13 @@ func CreateTx() (string, string, error) {
 	if err != nil {
 		return "", "", err
 	}
+
+	return CreateTxFromKey(privkey)
+}
+
+// CreateTxFromKey funds the p2wpkh address of the given key and returns a
+// transaction spending the funded utxo
+func CreateTxFromKey(privkey *btcec.PrivateKey) (string, string, error) {
 	pubkey := privkey.PubKey()
 	p2wpkh := payment.FromPublicKey(pubkey, &network.Regtest, nil)
 	addr, _ := p2wpkh.WitnessPubKeyHash()
@@ -431,7 +438,7 @@ func MakeNigiriTestServices(
 	if err != nil {
 		panic(err)
 	}
-	s := scanner.New(repoFilter, repoHeader, blockSvc, h)
+	s := scanner.New(repoFilter, repoHeader, blockSvc, h, scanner.WithChainNotifier(n))
 
 	reportCh, err := s.Start()
 	if err != nil {
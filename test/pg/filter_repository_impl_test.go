@@ -63,3 +63,34 @@ func (s *PgDbTestSuite) TestPutFilter() {
 
 	s.Equal(key.String(), f.Key.String())
 }
+
+func (s *PgDbTestSuite) TestDeleteFilters() {
+	keys, err := filterRepo.GetFilterKeys(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Contains(keys, "2df74a01a958")
+
+	if err := filterRepo.DeleteFilters(ctx, "2df74a01a958"); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	newKeys, err := filterRepo.GetFilterKeys(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.NotContains(newKeys, "2df74a01a958")
+	s.Equal(len(keys)-1, len(newKeys))
+}
+
+func (s *PgDbTestSuite) TestPrunedHeight() {
+	if err := filterRepo.SetPrunedHeight(ctx, 5); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	height, err := filterRepo.GetPrunedHeight(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(uint32(5), height)
+}
@@ -3,6 +3,8 @@ package pgtest
 import (
 	"bytes"
 	"encoding/hex"
+	"time"
+
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/vulpemventures/go-elements/block"
 )
@@ -52,6 +54,27 @@ func (s *PgDbTestSuite) TestGetBlockHashByHeight() {
 	s.Equal("278a266440efc99fae9f62a0812ead54c79b74ca961b9f6eb42e11e9b0c74875", hash.String())
 }
 
+func (s *PgDbTestSuite) TestGetHeightByTime() {
+	tests := []struct {
+		time   int64
+		height uint32
+	}{
+		{time: 1658163900, height: 0},
+		// the search starts MaxTimestampDrift earlier
+		{time: 1658475206, height: 2},
+		{time: 1658482500, height: 11},
+	}
+
+	for _, tt := range tests {
+		height, err := headerRepo.GetHeightByTime(ctx, time.Unix(tt.time, 0))
+		if err != nil {
+			s.FailNow(err.Error())
+		}
+
+		s.Equal(tt.height, height)
+	}
+}
+
 func (s *PgDbTestSuite) TestHasAllAncestors() {
 	hash, err := chainhash.NewHashFromStr("278a266440efc99fae9f62a0812ead54c79b74ca961b9f6eb42e11e9b0c74875")
 	if err != nil {
@@ -97,6 +120,53 @@ func (s *PgDbTestSuite) TestWriteHeaders() {
 	s.Equal("3a3712abba3d5161d58a324a4ac022bde782471e1d81bc5d4b45f2cf782c26db", hash.String())
 }
 
+func (s *PgDbTestSuite) TestWriteHeadersReorg() {
+	hash, err := headerRepo.GetBlockHashByHeight(ctx, 9)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	header, err := headerRepo.GetBlockHeader(ctx, *hash)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	// writing a stored header again is a no-op
+	if err := headerRepo.WriteHeaders(ctx, *header); err != nil {
+		s.FailNow(err.Error())
+	}
+	tip, err := headerRepo.ChainTip(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(uint32(10), tip.Height)
+
+	// the header of another block at the same height replaces it, together
+	// with the one on top of it
+	reorged := *header
+	reorged.Timestamp++
+	reorgedHash, err := reorged.Hash()
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	if err := headerRepo.WriteHeaders(ctx, reorged); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	hash, err = headerRepo.GetBlockHashByHeight(ctx, 9)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(reorgedHash.String(), hash.String())
+
+	tip, err = headerRepo.ChainTip(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(uint32(9), tip.Height)
+}
+
 func (s *PgDbTestSuite) TestLatestBlockLocator() {
 	locator, err := headerRepo.LatestBlockLocator(ctx)
 	if err != nil {
@@ -105,3 +175,16 @@ func (s *PgDbTestSuite) TestLatestBlockLocator() {
 
 	s.Equal(11, len(locator))
 }
+
+func (s *PgDbTestSuite) TestDeleteHeadersFromHeight() {
+	if err := headerRepo.DeleteHeadersFromHeight(ctx, 8); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	tip, err := headerRepo.ChainTip(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	s.Equal(uint32(7), tip.Height)
+}
@@ -0,0 +1,108 @@
+package pgtest
+
+import (
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+	"github.com/vulpemventures/neutrino-elements/pkg/scanner"
+)
+
+const fixtureSubscriptionID = "5b6a1c2e-7d0f-4c1e-9a3b-2f4d6e8a0b1c"
+
+func (s *PgDbTestSuite) TestGetSubscription() {
+	sub, err := subsRepo.GetSubscription(ctx, uuid.MustParse(fixtureSubscriptionID))
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	s.Equal([]scanner.EventType{scanner.UnspentUtxo}, sub.EventTypes)
+	s.Equal(
+		[]string{"wpkh(037470e26cc774eca62ca19e1a182461a5f3d3680acbc593ce3f38cd142c26c03d)"},
+		sub.WalletDescriptors,
+	)
+	s.Equal(uint32(5), sub.StartBlockHeight)
+	s.Equal(uint32(8), sub.LastScannedHeight)
+	s.Equal(uint32(9), sub.ResumeHeight())
+	s.Equal("http://127.0.0.1:62900", sub.EndpointUrl)
+}
+
+func (s *PgDbTestSuite) TestPutSubscription() {
+	sub := &domain.Subscription{
+		ID: uuid.New(),
+		WalletDescriptors: []string{
+			"wpkh(037470e26cc774eca62ca19e1a182461a5f3d3680acbc593ce3f38cd142c26c03d)",
+			"wpkh(03e5a2b9ec6a0ac5dc4b6c8d43dd0c7ac2b1a39ec1f2d06d3e0bd7e1f4f7a6f0e1)",
+		},
+		EventTypes:        []scanner.EventType{scanner.UnspentUtxo, scanner.SpentUtxo},
+		StartBlockHeight:  2,
+		EndpointUrl:       "http://127.0.0.1:62901",
+		BlindingKeys:      []string{"b2f6cb0a1b4f8d2bbd0d3bc3c8e8dd47f0e1c3d5a6b7c8d9e0f1a2b3c4d5e6f7"},
+		MasterBlindingKey: "c3a7dc1b2c5f9e3cce1e4cd4d9f9ee58f1f2d4e6b7c8d9eaf1f2a3b4c5d6e7f8",
+		ConfirmationDepth: 6,
+		AssetID:           "5ac9f65c0efcc4775e0baec4ec03abdde22473cd3cf33c0419ca290e0751b225",
+	}
+
+	if err := subsRepo.PutSubscription(ctx, sub); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	if err := subsRepo.UpdateLastScannedHeight(ctx, sub.ID, 10); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	subs, err := subsRepo.GetAllSubscriptions(ctx)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(2, len(subs))
+
+	stored, err := subsRepo.GetSubscription(ctx, sub.ID)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(sub.EventTypes, stored.EventTypes)
+	s.Equal(sub.WalletDescriptors, stored.WalletDescriptors)
+	s.Equal(sub.BlindingKeys, stored.BlindingKeys)
+	s.Equal(sub.MasterBlindingKey, stored.MasterBlindingKey)
+	s.Equal(sub.ConfirmationDepth, stored.ConfirmationDepth)
+	s.Equal(sub.AssetID, stored.AssetID)
+	s.Equal(uint32(10), stored.LastScannedHeight)
+}
+
+func (s *PgDbTestSuite) TestDeleteSubscription() {
+	id := uuid.MustParse(fixtureSubscriptionID)
+	if err := subsRepo.DeleteSubscription(ctx, id); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	_, err := subsRepo.GetSubscription(ctx, id)
+	s.Equal(domain.ErrSubscriptionNotFound, err)
+
+	s.Equal(domain.ErrSubscriptionNotFound, subsRepo.DeleteSubscription(ctx, id))
+}
+
+func (s *PgDbTestSuite) TestUpdateLastUsedIndex() {
+	id := uuid.MustParse(fixtureSubscriptionID)
+	desc := "wpkh(037470e26cc774eca62ca19e1a182461a5f3d3680acbc593ce3f38cd142c26c03d)"
+
+	// the highest index is kept
+	for _, index := range []uint32{4, 9, 2} {
+		if err := subsRepo.UpdateLastUsedIndex(ctx, id, scanner.ScriptDerivation{
+			Descriptor: desc,
+			Branch:     1,
+			Index:      index,
+		}); err != nil {
+			s.FailNow(err.Error())
+		}
+	}
+
+	sub, err := subsRepo.GetSubscription(ctx, id)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal([]scanner.ScriptDerivation{{Descriptor: desc, Branch: 1, Index: 9}}, sub.LastUsedIndexes)
+
+	s.Equal(
+		domain.ErrSubscriptionNotFound,
+		subsRepo.UpdateLastUsedIndex(ctx, uuid.New(), scanner.ScriptDerivation{Descriptor: desc}),
+	)
+}
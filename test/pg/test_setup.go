@@ -3,6 +3,7 @@ package pgtest
 import (
 	"context"
 	"github.com/stretchr/testify/suite"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
 	dbpg "github.com/vulpemventures/neutrino-elements/internal/infrastructure/storage/db/pg"
 	"github.com/vulpemventures/neutrino-elements/pkg/repository"
 	"github.com/vulpemventures/neutrino-elements/pkg/testutil"
@@ -12,6 +13,9 @@ var (
 	dbSvc      *dbpg.DbService
 	filterRepo repository.FilterRepository
 	headerRepo repository.BlockHeaderRepository
+	subsRepo   domain.SubscriptionRepository
+	utxoRepo   domain.UtxoRepository
+	txsRepo    domain.TxHistoryRepository
 
 	ctx = context.Background()
 )
@@ -60,6 +64,24 @@ func (s *PgDbTestSuite) SetupSuite() {
 		s.FailNow(err.Error())
 	}
 	headerRepo = hr
+
+	sr, err := dbpg.NewSubscriptionRepositoryImpl(dbSvc)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	subsRepo = sr
+
+	ur, err := dbpg.NewUtxoRepositoryImpl(dbSvc)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	utxoRepo = ur
+
+	tr, err := dbpg.NewTxHistoryRepositoryImpl(dbSvc)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	txsRepo = tr
 }
 
 func (s *PgDbTestSuite) TearDownSuite() {
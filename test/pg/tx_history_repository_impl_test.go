@@ -0,0 +1,72 @@
+package pgtest
+
+import (
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+)
+
+func (s *PgDbTestSuite) TestGetTxHistory() {
+	id := uuid.MustParse(fixtureSubscriptionID)
+
+	// the entries are sorted from the most recent one
+	txs, err := txsRepo.GetTxHistory(ctx, id, domain.TxHistoryFilter{Limit: 2})
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(2, len(txs))
+	s.Equal(uint32(2), txs[0].TxIndex)
+	s.Equal(domain.Outgoing, txs[1].Direction)
+	s.Equal(map[string]int64{fixtureAsset: -10000000}, txs[1].NetAmounts())
+
+	txs, err = txsRepo.GetTxHistory(ctx, id, domain.TxHistoryFilter{
+		After: &domain.TxHistoryCursor{BlockHeight: txs[1].BlockHeight, TxIndex: txs[1].TxIndex},
+		Limit: 2,
+	})
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(1, len(txs))
+	s.Equal(fixtureUtxoTxID, txs[0].TxID)
+
+	txs, err = txsRepo.GetTxHistory(ctx, id, domain.TxHistoryFilter{FromHeight: 7, ToHeight: 7})
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(2, len(txs))
+}
+
+func (s *PgDbTestSuite) TestPutTx() {
+	id := uuid.MustParse(fixtureSubscriptionID)
+
+	utxos, err := utxoRepo.GetTxUtxos(ctx, id, fixtureUtxoTxID)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	entry := domain.NewTxHistoryEntry(id, fixtureUtxoTxID, 6, 3, domain.Incoming, utxos)
+	s.Equal(domain.Incoming, entry.Direction)
+	if err := txsRepo.PutTx(ctx, entry); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	txs, err := txsRepo.GetTxHistory(ctx, id, domain.TxHistoryFilter{ToHeight: 6})
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(1, len(txs))
+	s.Equal(uint32(3), txs[0].TxIndex)
+	s.Equal(map[string]uint64{fixtureAsset: 100000000}, txs[0].Received)
+
+	if err := txsRepo.DeleteTx(ctx, id, fixtureUtxoTxID); err != nil {
+		s.FailNow(err.Error())
+	}
+	if err := txsRepo.DeleteTxHistory(ctx, id); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	txs, err = txsRepo.GetTxHistory(ctx, id, domain.TxHistoryFilter{})
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(0, len(txs))
+}
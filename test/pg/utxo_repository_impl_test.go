@@ -0,0 +1,86 @@
+package pgtest
+
+import (
+	"github.com/google/uuid"
+	"github.com/vulpemventures/neutrino-elements/internal/core/domain"
+)
+
+const (
+	fixtureUtxoTxID = "8a4d1e3c5f7b9d2e4f6a8c0e2b4d6f8a1c3e5b7d9f2a4c6e8b0d2f4a6c8e0b2d"
+	fixtureAsset    = "5ac9f65c0efcc4775e0baec4ec03abdde22473cd3cf33c0419ca290e0751b225"
+)
+
+func (s *PgDbTestSuite) TestGetUnspents() {
+	unspents, err := utxoRepo.GetUnspents(ctx, uuid.MustParse(fixtureSubscriptionID))
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+
+	s.Equal(2, len(unspents))
+	s.Equal(fixtureUtxoTxID, unspents[0].TxID)
+	s.Equal(uint32(6), unspents[0].BlockHeight)
+	s.True(unspents[1].Confidential)
+
+	// the confidential utxo is not counted
+	balance, err := utxoRepo.GetBalance(ctx, uuid.MustParse(fixtureSubscriptionID))
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(map[string]uint64{fixtureAsset: 100000000}, balance)
+}
+
+func (s *PgDbTestSuite) TestSpendUtxos() {
+	id := uuid.MustParse(fixtureSubscriptionID)
+	txID := "1f3e5d7c9b2a4e6d8f0c2b4a6e8d0f2c4b6a8e0d2f4c6b8a0e2d4f6c8b0a2e4d"
+
+	utxos := []*domain.Utxo{
+		{
+			SubscriptionID: id,
+			TxID:           txID,
+			VOut:           0,
+			Script:         []byte{0x51},
+			BlockHeight:    9,
+			Value:          5000,
+			Asset:          fixtureAsset,
+		},
+	}
+	if err := utxoRepo.AddUtxos(ctx, utxos); err != nil {
+		s.FailNow(err.Error())
+	}
+	// adding the same utxos again has no effect
+	if err := utxoRepo.AddUtxos(ctx, utxos); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	spent := []domain.Outpoint{{TxID: fixtureUtxoTxID, VOut: 0}}
+	if err := utxoRepo.SpendUtxos(ctx, id, spent, txID); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	balance, err := utxoRepo.GetBalance(ctx, id)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(map[string]uint64{fixtureAsset: 5000}, balance)
+
+	// the block of the spending transaction is reverted
+	if err := utxoRepo.RevertTx(ctx, id, txID); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	balance, err = utxoRepo.GetBalance(ctx, id)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(map[string]uint64{fixtureAsset: 100000000}, balance)
+
+	if err := utxoRepo.DeleteUtxos(ctx, id); err != nil {
+		s.FailNow(err.Error())
+	}
+
+	unspents, err := utxoRepo.GetUnspents(ctx, id)
+	if err != nil {
+		s.FailNow(err.Error())
+	}
+	s.Equal(0, len(unspents))
+}